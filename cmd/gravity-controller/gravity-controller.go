@@ -1,15 +1,24 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
 	"runtime"
 	"strings"
+	"syscall"
 
+	"github.com/fsnotify/fsnotify"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 
 	app "github.com/BrobridgeOrg/gravity-controller/pkg/app/instance"
+	"github.com/BrobridgeOrg/gravity-controller/pkg/config"
 )
 
+var printConfig = flag.Bool("print-config", false, "Print the effective configuration and exit")
+
 func init() {
 
 	// From the environment
@@ -31,19 +40,110 @@ func init() {
 
 func main() {
 
+	flag.Parse()
+
+	// Loading configurations
+	cfg, err := config.Load(viper.GetViper())
+	if err != nil {
+		log.Fatal(err)
+		return
+	}
+
+	if *printConfig {
+		data, err := cfg.Dump()
+		if err != nil {
+			log.Fatal(err)
+			return
+		}
+
+		fmt.Println(string(data))
+		return
+	}
+
+	log.SetLevel(cfg.GetLogLevel())
+
 	// Initializing application
-	a := app.NewAppInstance()
+	a := app.NewAppInstance(cfg)
 
-	err := a.Init()
+	err = a.Init()
 	if err != nil {
 		log.Fatal(err)
 		return
 	}
 
+	watchConfig(a)
+
+	// Stop on SIGINT and SIGTERM
+	term := make(chan os.Signal, 1)
+	signal.Notify(term, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		<-term
+		log.Info("Shutting down")
+		a.Stop()
+	}()
+
 	// Starting application
 	err = a.Run()
+	a.Uninit()
 	if err != nil {
 		log.Fatal(err)
 		return
 	}
 }
+
+func watchConfig(a *app.AppInstance) {
+
+	// Both triggers are funneled into one goroutine so reloads never overlap
+	reloads := make(chan bool, 1)
+
+	trigger := func() {
+		select {
+		case reloads <- true:
+		default:
+			// A reload is pending already
+		}
+	}
+
+	go func() {
+		for range reloads {
+
+			// Viper is not safe for concurrent use so file is read here as well
+			err := viper.ReadInConfig()
+			if err != nil {
+				log.Warn("No configuration file was loaded")
+			}
+
+			cfg, err := config.Load(viper.GetViper())
+			if err != nil {
+				log.Errorf("Failed to reload configuration: %v", err)
+				continue
+			}
+
+			a.Reload(cfg)
+		}
+	}()
+
+	// Watching configuration file
+	if len(viper.ConfigFileUsed()) > 0 {
+		viper.OnConfigChange(func(e fsnotify.Event) {
+			log.WithFields(log.Fields{
+				"file": e.Name,
+			}).Info("Configuration file was changed")
+
+			trigger()
+		})
+		viper.WatchConfig()
+	}
+
+	// Reload on SIGHUP
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+
+	go func() {
+		for range sig {
+			log.Info("Received SIGHUP, reloading configuration")
+			trigger()
+		}
+	}()
+}
@@ -6,10 +6,12 @@ require (
 	github.com/BrobridgeOrg/broc v0.0.2
 	github.com/BrobridgeOrg/gravity-api v0.2.26
 	github.com/BrobridgeOrg/gravity-sdk v1.0.4
+	github.com/fsnotify/fsnotify v1.4.7
 	github.com/golang/protobuf v1.5.2
 	github.com/nats-io/nats.go v1.16.0
 	github.com/sirupsen/logrus v1.8.1
 	github.com/spf13/viper v1.7.1
+	google.golang.org/protobuf v1.26.0
 )
 
 //replace github.com/BrobridgeOrg/gravity-api => ../gravity-api
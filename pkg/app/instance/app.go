@@ -1,22 +1,26 @@
 package instance
 
 import (
+	"sync"
+
+	"github.com/BrobridgeOrg/gravity-controller/pkg/config"
 	controller_service "github.com/BrobridgeOrg/gravity-controller/pkg/controller/service"
 	log "github.com/sirupsen/logrus"
 )
 
 type AppInstance struct {
 	done       chan bool
+	stopOnce   sync.Once
 	controller *controller_service.Controller
 }
 
-func NewAppInstance() *AppInstance {
+func NewAppInstance(config *config.Config) *AppInstance {
 
 	a := &AppInstance{
 		done: make(chan bool),
 	}
 
-	a.controller = controller_service.NewController(a)
+	a.controller = controller_service.NewController(a, config)
 
 	return a
 }
@@ -34,11 +38,26 @@ func (a *AppInstance) Init() error {
 }
 
 func (a *AppInstance) Uninit() {
+	a.controller.Close()
+}
+
+func (a *AppInstance) Stop() {
+	a.stopOnce.Do(func() {
+		close(a.done)
+	})
+}
+
+func (a *AppInstance) Reload(config *config.Config) {
+	a.controller.ApplyConfig(config)
 }
 
 func (a *AppInstance) Run() error {
 
-	<-a.done
+	select {
+	case <-a.done:
+	case err := <-a.controller.Errors():
+		return err
+	}
 
 	return nil
 }
@@ -0,0 +1,466 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const (
+	DefaultDomain              = "gravity"
+	DefaultPingInterval        = 10
+	DefaultMaxPingsOutstanding = 3
+	DefaultMaxReconnects       = -1
+	DefaultRequestTimeout      = 10
+	DefaultStorePath           = "./datastore"
+	DefaultPipelineCount       = 256
+	DefaultAuthChannel         = "gravity.auth"
+	DefaultLogLevel            = "info"
+	DefaultKeyRotationGrace    = 3600
+	DefaultReplayWindow        = 300
+	DefaultRateLimit           = 50
+	DefaultRateLimitBurst      = 100
+	DefaultSessionTTL          = 900
+	DefaultAuthCacheSize       = 10000
+	DefaultAuthCacheTTL        = 60
+	DefaultAuthNegativeTTL     = 5
+	DefaultAdapterStaleTimeout = 60
+	DefaultAdapterRetention    = 86400
+	DefaultAuditRetentionDays  = 30
+)
+
+type TLSConfig struct {
+	CAFile   string `json:"caFile"`
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+}
+
+type GravityConfig struct {
+	Domain              string    `json:"domain"`
+	AccessKey           string    `json:"accessKey"`
+	PreviousAccessKey   string    `json:"previousAccessKey"`
+	Host                string    `json:"host"`
+	Port                int       `json:"port"`
+	Servers             []string  `json:"servers"`
+	PingInterval        int64     `json:"pingInterval"`
+	MaxPingsOutstanding int       `json:"maxPingsOutstanding"`
+	MaxReconnects       int       `json:"maxReconnects"`
+	RequestTimeout      int64     `json:"requestTimeout"`
+	TLS                 TLSConfig `json:"tls"`
+	Credentials         string    `json:"credentials"`
+	NKeySeed            string    `json:"nkeySeed"`
+	Token               string    `json:"token"`
+}
+
+func (c *GravityConfig) EnabledTLS() bool {
+	return len(c.TLS.CAFile) > 0 || len(c.TLS.CertFile) > 0
+}
+
+type ControllerConfig struct {
+	PipelineCount uint64 `json:"pipelineCount"`
+	StorePath     string `json:"storePath"`
+}
+
+type AdapterManagerConfig struct {
+	AllowAnonymous bool  `json:"allowAnonymous"`
+	StaleTimeout   int64 `json:"staleTimeout"`
+	Retention      int64 `json:"retention"`
+}
+
+type SubscriberManagerConfig struct {
+	AllowAnonymous bool `json:"allowAnonymous"`
+}
+
+type AuthServiceConfig struct {
+	Enabled                bool   `json:"enabled"`
+	Channel                string `json:"channel"`
+	AccessKey              string `json:"accessKey"`
+	KeyRotationGracePeriod int64  `json:"keyRotationGracePeriod"`
+	CacheSize              int    `json:"cacheSize"`
+	CacheTTL               int64  `json:"cacheTTL"`
+	NegativeCacheTTL       int64  `json:"negativeCacheTTL"`
+}
+
+type SecurityConfig struct {
+	ReplayWindow       int64 `json:"replayWindow"`
+	AllowLegacyPackets bool  `json:"allowLegacyPackets"`
+}
+
+type MethodRateLimitConfig struct {
+	Method string  `json:"method" mapstructure:"method"`
+	Rate   float64 `json:"rate" mapstructure:"rate"`
+	Burst  int     `json:"burst" mapstructure:"burst"`
+}
+
+type RateLimitConfig struct {
+	Enabled bool                    `json:"enabled"`
+	Rate    float64                 `json:"rate"`
+	Burst   int                     `json:"burst"`
+	Methods []MethodRateLimitConfig `json:"methods"`
+}
+
+type QuotaConfig struct {
+	MaxSubscribersPerApp        int `json:"maxSubscribersPerApp"`
+	MaxCollectionsPerSubscriber int `json:"maxCollectionsPerSubscriber"`
+}
+
+type SessionConfig struct {
+	TTL int64 `json:"ttl"`
+}
+
+type AuditConfig struct {
+	File          string `json:"file"`
+	RetentionDays int    `json:"retentionDays"`
+}
+
+type LogConfig struct {
+	Level string `json:"level"`
+}
+
+type Config struct {
+	Gravity           GravityConfig           `json:"gravity"`
+	Controller        ControllerConfig        `json:"controller"`
+	AdapterManager    AdapterManagerConfig    `json:"adapter_manager"`
+	SubscriberManager SubscriberManagerConfig `json:"subscriber_manager"`
+	AuthService       AuthServiceConfig       `json:"auth_service"`
+	Security          SecurityConfig          `json:"security"`
+	RateLimit         RateLimitConfig         `json:"rate_limit"`
+	Quota             QuotaConfig             `json:"quota"`
+	Session           SessionConfig           `json:"session"`
+	Audit             AuditConfig             `json:"audit"`
+	Log               LogConfig               `json:"log"`
+}
+
+// Load reads all settings from v, falling back to defaults
+func Load(v *viper.Viper) (*Config, error) {
+
+	v.SetDefault("gravity.domain", DefaultDomain)
+	v.SetDefault("gravity.accessKey", "")
+	v.SetDefault("gravity.pingInterval", DefaultPingInterval)
+	v.SetDefault("gravity.maxPingsOutstanding", DefaultMaxPingsOutstanding)
+	v.SetDefault("gravity.maxReconnects", DefaultMaxReconnects)
+	v.SetDefault("gravity.requestTimeout", DefaultRequestTimeout)
+	v.SetDefault("gravity.servers", []string{})
+	v.SetDefault("gravity.tls.caFile", "")
+	v.SetDefault("gravity.tls.certFile", "")
+	v.SetDefault("gravity.tls.keyFile", "")
+	v.SetDefault("gravity.credentials", "")
+	v.SetDefault("gravity.nkeySeed", "")
+	v.SetDefault("gravity.token", "")
+	v.SetDefault("controller.pipelineCount", DefaultPipelineCount)
+	v.SetDefault("controller.storePath", DefaultStorePath)
+	v.SetDefault("adapter_manager.allowAnonymous", true)
+	v.SetDefault("adapter_manager.staleTimeout", DefaultAdapterStaleTimeout)
+	v.SetDefault("adapter_manager.retention", DefaultAdapterRetention)
+	v.SetDefault("subscriber_manager.allowAnonymous", true)
+	v.SetDefault("auth_service.enabled", false)
+	v.SetDefault("auth_service.channel", DefaultAuthChannel)
+	v.SetDefault("auth_service.accessKey", "")
+	v.SetDefault("auth_service.keyRotationGracePeriod", DefaultKeyRotationGrace)
+	v.SetDefault("auth_service.cacheSize", DefaultAuthCacheSize)
+	v.SetDefault("auth_service.cacheTTL", DefaultAuthCacheTTL)
+	v.SetDefault("auth_service.negativeCacheTTL", DefaultAuthNegativeTTL)
+	v.SetDefault("security.replayWindow", DefaultReplayWindow)
+	v.SetDefault("security.allowLegacyPackets", true)
+	v.SetDefault("rate_limit.enabled", false)
+	v.SetDefault("rate_limit.rate", DefaultRateLimit)
+	v.SetDefault("rate_limit.burst", DefaultRateLimitBurst)
+	v.SetDefault("quota.maxSubscribersPerApp", 0)
+	v.SetDefault("quota.maxCollectionsPerSubscriber", 0)
+	v.SetDefault("session.ttl", DefaultSessionTTL)
+	v.SetDefault("audit.file", "")
+	v.SetDefault("audit.retentionDays", DefaultAuditRetentionDays)
+	v.SetDefault("log.level", DefaultLogLevel)
+
+	config := &Config{
+		Gravity: GravityConfig{
+			Domain:              v.GetString("gravity.domain"),
+			AccessKey:           v.GetString("gravity.accessKey"),
+			PreviousAccessKey:   v.GetString("gravity.previousAccessKey"),
+			Host:                v.GetString("gravity.host"),
+			Port:                v.GetInt("gravity.port"),
+			PingInterval:        v.GetInt64("gravity.pingInterval"),
+			MaxPingsOutstanding: v.GetInt("gravity.maxPingsOutstanding"),
+			MaxReconnects:       v.GetInt("gravity.maxReconnects"),
+			RequestTimeout:      v.GetInt64("gravity.requestTimeout"),
+			Servers:             v.GetStringSlice("gravity.servers"),
+			TLS: TLSConfig{
+				CAFile:   v.GetString("gravity.tls.caFile"),
+				CertFile: v.GetString("gravity.tls.certFile"),
+				KeyFile:  v.GetString("gravity.tls.keyFile"),
+			},
+			Credentials: v.GetString("gravity.credentials"),
+			NKeySeed:    v.GetString("gravity.nkeySeed"),
+			Token:       v.GetString("gravity.token"),
+		},
+		Controller: ControllerConfig{
+			PipelineCount: v.GetUint64("controller.pipelineCount"),
+			StorePath:     v.GetString("controller.storePath"),
+		},
+		AdapterManager: AdapterManagerConfig{
+			AllowAnonymous: v.GetBool("adapter_manager.allowAnonymous"),
+			StaleTimeout:   v.GetInt64("adapter_manager.staleTimeout"),
+			Retention:      v.GetInt64("adapter_manager.retention"),
+		},
+		SubscriberManager: SubscriberManagerConfig{
+			AllowAnonymous: v.GetBool("subscriber_manager.allowAnonymous"),
+		},
+		AuthService: AuthServiceConfig{
+			Enabled:                v.GetBool("auth_service.enabled"),
+			Channel:                v.GetString("auth_service.channel"),
+			AccessKey:              v.GetString("auth_service.accessKey"),
+			KeyRotationGracePeriod: v.GetInt64("auth_service.keyRotationGracePeriod"),
+			CacheSize:              v.GetInt("auth_service.cacheSize"),
+			CacheTTL:               v.GetInt64("auth_service.cacheTTL"),
+			NegativeCacheTTL:       v.GetInt64("auth_service.negativeCacheTTL"),
+		},
+		Security: SecurityConfig{
+			ReplayWindow:       v.GetInt64("security.replayWindow"),
+			AllowLegacyPackets: v.GetBool("security.allowLegacyPackets"),
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: v.GetBool("rate_limit.enabled"),
+			Rate:    v.GetFloat64("rate_limit.rate"),
+			Burst:   v.GetInt("rate_limit.burst"),
+			Methods: make([]MethodRateLimitConfig, 0),
+		},
+		Quota: QuotaConfig{
+			MaxSubscribersPerApp:        v.GetInt("quota.maxSubscribersPerApp"),
+			MaxCollectionsPerSubscriber: v.GetInt("quota.maxCollectionsPerSubscriber"),
+		},
+		Session: SessionConfig{
+			TTL: v.GetInt64("session.ttl"),
+		},
+		Audit: AuditConfig{
+			File:          v.GetString("audit.file"),
+			RetentionDays: v.GetInt("audit.retentionDays"),
+		},
+		Log: LogConfig{
+			Level: v.GetString("log.level"),
+		},
+	}
+
+	// Limits for specific methods
+	err := v.UnmarshalKey("rate_limit.methods", &config.RateLimit.Methods)
+	if err != nil {
+		return nil, fmt.Errorf("config: rate_limit.methods is invalid: %v", err)
+	}
+
+	err = config.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+func (config *Config) Validate() error {
+
+	if len(config.Gravity.Domain) == 0 {
+		return errors.New("config: gravity.domain is required")
+	}
+
+	if len(config.Gravity.Servers) == 0 {
+
+		if len(config.Gravity.Host) == 0 {
+			return errors.New("config: gravity.host is required when gravity.servers is empty")
+		}
+
+		if config.Gravity.Port <= 0 || config.Gravity.Port > 65535 {
+			return fmt.Errorf("config: gravity.port must be between 1 and 65535, got %d", config.Gravity.Port)
+		}
+	}
+
+	for _, server := range config.Gravity.Servers {
+		if len(strings.TrimSpace(server)) == 0 {
+			return errors.New("config: gravity.servers contains an empty entry")
+		}
+	}
+
+	if (len(config.Gravity.TLS.CertFile) > 0) != (len(config.Gravity.TLS.KeyFile) > 0) {
+		return errors.New("config: gravity.tls.certFile and gravity.tls.keyFile must be set together")
+	}
+
+	// Only one authentication method is allowed
+	methods := make([]string, 0)
+	if len(config.Gravity.Credentials) > 0 {
+		methods = append(methods, "gravity.credentials")
+	}
+
+	if len(config.Gravity.NKeySeed) > 0 {
+		methods = append(methods, "gravity.nkeySeed")
+	}
+
+	if len(config.Gravity.Token) > 0 {
+		methods = append(methods, "gravity.token")
+	}
+
+	if len(methods) > 1 {
+		return fmt.Errorf("config: only one of %s can be set", strings.Join(methods, ", "))
+	}
+
+	files := map[string]string{
+		"gravity.tls.caFile":   config.Gravity.TLS.CAFile,
+		"gravity.tls.certFile": config.Gravity.TLS.CertFile,
+		"gravity.tls.keyFile":  config.Gravity.TLS.KeyFile,
+		"gravity.credentials":  config.Gravity.Credentials,
+		"gravity.nkeySeed":     config.Gravity.NKeySeed,
+	}
+
+	for name, filename := range files {
+
+		if len(filename) == 0 {
+			continue
+		}
+
+		_, err := os.Stat(filename)
+		if err != nil {
+			return fmt.Errorf("config: %s is not readable: %v", name, err)
+		}
+	}
+
+	if config.Gravity.PingInterval <= 0 {
+		return fmt.Errorf("config: gravity.pingInterval must be greater than 0, got %d", config.Gravity.PingInterval)
+	}
+
+	if config.Gravity.MaxPingsOutstanding <= 0 {
+		return fmt.Errorf("config: gravity.maxPingsOutstanding must be greater than 0, got %d", config.Gravity.MaxPingsOutstanding)
+	}
+
+	if config.Gravity.RequestTimeout <= 0 {
+		return fmt.Errorf("config: gravity.requestTimeout must be greater than 0, got %d", config.Gravity.RequestTimeout)
+	}
+
+	if config.AdapterManager.StaleTimeout <= 0 {
+		return fmt.Errorf("config: adapter_manager.staleTimeout must be greater than 0, got %d", config.AdapterManager.StaleTimeout)
+	}
+
+	if config.AdapterManager.Retention < 0 {
+		return fmt.Errorf("config: adapter_manager.retention must not be negative, got %d", config.AdapterManager.Retention)
+	}
+
+	if config.Controller.PipelineCount == 0 {
+		return errors.New("config: controller.pipelineCount must be greater than 0")
+	}
+
+	if len(config.Controller.StorePath) == 0 {
+		return errors.New("config: controller.storePath is required")
+	}
+
+	if config.AuthService.Enabled && len(config.AuthService.Channel) == 0 {
+		return errors.New("config: auth_service.channel is required when auth_service.enabled is true")
+	}
+
+	if config.AuthService.KeyRotationGracePeriod < 0 {
+		return fmt.Errorf("config: auth_service.keyRotationGracePeriod must not be negative, got %d", config.AuthService.KeyRotationGracePeriod)
+	}
+
+	if config.AuthService.CacheSize < 0 || config.AuthService.CacheTTL < 0 || config.AuthService.NegativeCacheTTL < 0 {
+		return errors.New("config: auth_service cache settings must not be negative, 0 disables caching")
+	}
+
+	if config.Security.ReplayWindow <= 0 {
+		return fmt.Errorf("config: security.replayWindow must be greater than 0, got %d", config.Security.ReplayWindow)
+	}
+
+	if config.RateLimit.Enabled {
+
+		if config.RateLimit.Rate <= 0 || config.RateLimit.Burst <= 0 {
+			return errors.New("config: rate_limit.rate and rate_limit.burst must be greater than 0")
+		}
+
+		for _, limit := range config.RateLimit.Methods {
+
+			if len(limit.Method) == 0 {
+				return errors.New("config: rate_limit.methods contains an entry without method")
+			}
+
+			if limit.Rate <= 0 || limit.Burst <= 0 {
+				return fmt.Errorf("config: rate and burst of rate_limit.methods %s must be greater than 0", limit.Method)
+			}
+		}
+	}
+
+	if config.Quota.MaxSubscribersPerApp < 0 || config.Quota.MaxCollectionsPerSubscriber < 0 {
+		return errors.New("config: quota must not be negative, 0 means unlimited")
+	}
+
+	if config.Session.TTL <= 0 {
+		return fmt.Errorf("config: session.ttl must be greater than 0, got %d", config.Session.TTL)
+	}
+
+	if config.Audit.RetentionDays < 0 {
+		return fmt.Errorf("config: audit.retentionDays must not be negative, got %d", config.Audit.RetentionDays)
+	}
+
+	_, err := log.ParseLevel(config.Log.Level)
+	if err != nil {
+		return fmt.Errorf("config: log.level is invalid: %v", err)
+	}
+
+	return nil
+}
+
+// GetLogLevel returns the parsed log level, it must be called on a validated config
+func (config *Config) GetLogLevel() log.Level {
+	level, _ := log.ParseLevel(config.Log.Level)
+	return level
+}
+
+// RestartRequired returns names of settings which differ from next but cannot be applied at runtime
+func (config *Config) RestartRequired(next *Config) []string {
+
+	changes := make([]string, 0)
+
+	check := func(name string, changed bool) {
+		if changed {
+			changes = append(changes, name)
+		}
+	}
+
+	check("gravity.domain", config.Gravity.Domain != next.Gravity.Domain)
+	check("gravity.accessKey", config.Gravity.AccessKey != next.Gravity.AccessKey)
+	check("gravity.host", config.Gravity.Host != next.Gravity.Host)
+	check("gravity.port", config.Gravity.Port != next.Gravity.Port)
+	check("gravity.servers", strings.Join(config.Gravity.Servers, ",") != strings.Join(next.Gravity.Servers, ","))
+	check("gravity.tls", config.Gravity.TLS != next.Gravity.TLS)
+	check("gravity.credentials", config.Gravity.Credentials != next.Gravity.Credentials)
+	check("gravity.nkeySeed", config.Gravity.NKeySeed != next.Gravity.NKeySeed)
+	check("gravity.token", config.Gravity.Token != next.Gravity.Token)
+	check("gravity.pingInterval", config.Gravity.PingInterval != next.Gravity.PingInterval)
+	check("gravity.maxPingsOutstanding", config.Gravity.MaxPingsOutstanding != next.Gravity.MaxPingsOutstanding)
+	check("gravity.maxReconnects", config.Gravity.MaxReconnects != next.Gravity.MaxReconnects)
+	check("controller.pipelineCount", config.Controller.PipelineCount != next.Controller.PipelineCount)
+	check("controller.storePath", config.Controller.StorePath != next.Controller.StorePath)
+	check("auth_service.channel", config.AuthService.Channel != next.AuthService.Channel)
+	check("auth_service.accessKey", config.AuthService.AccessKey != next.AuthService.AccessKey)
+	check("audit.file", config.Audit.File != next.Audit.File)
+
+	return changes
+}
+
+// Dump returns configurations in JSON format with secrets masked
+func (config *Config) Dump() ([]byte, error) {
+
+	c := *config
+	c.Gravity.AccessKey = mask(c.Gravity.AccessKey)
+	c.Gravity.PreviousAccessKey = mask(c.Gravity.PreviousAccessKey)
+	c.Gravity.Token = mask(c.Gravity.Token)
+	c.AuthService.AccessKey = mask(c.AuthService.AccessKey)
+
+	return json.MarshalIndent(&c, "", "  ")
+}
+
+func mask(secret string) string {
+
+	if len(secret) == 0 {
+		return ""
+	}
+
+	return "********"
+}
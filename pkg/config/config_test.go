@@ -0,0 +1,212 @@
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func newTestConfig(t *testing.T) *Config {
+
+	v := viper.New()
+	v.Set("gravity.host", "127.0.0.1")
+	v.Set("gravity.port", 4222)
+
+	config, err := Load(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return config
+}
+
+func TestLoadDefaults(t *testing.T) {
+
+	config := newTestConfig(t)
+
+	if config.Gravity.Domain != DefaultDomain {
+		t.Errorf("gravity.domain = %s, want %s", config.Gravity.Domain, DefaultDomain)
+	}
+
+	if config.AdapterManager.Retention != DefaultAdapterRetention {
+		t.Errorf("adapter_manager.retention = %d, want %d", config.AdapterManager.Retention, DefaultAdapterRetention)
+	}
+
+	if config.Security.ReplayWindow != DefaultReplayWindow {
+		t.Errorf("security.replayWindow = %d, want %d", config.Security.ReplayWindow, DefaultReplayWindow)
+	}
+}
+
+func TestLoadRateLimitMethods(t *testing.T) {
+
+	v := viper.New()
+	v.Set("gravity.host", "127.0.0.1")
+	v.Set("gravity.port", 4222)
+	v.Set("rate_limit.enabled", true)
+	v.Set("rate_limit.methods", []map[string]interface{}{
+		{"method": "subscriber_manager.register", "rate": 1.5, "burst": 3},
+	})
+
+	config, err := Load(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []MethodRateLimitConfig{
+		{Method: "subscriber_manager.register", Rate: 1.5, Burst: 3},
+	}
+
+	if len(config.RateLimit.Methods) != 1 || config.RateLimit.Methods[0] != expected[0] {
+		t.Errorf("rate_limit.methods = %+v, want %+v", config.RateLimit.Methods, expected)
+	}
+}
+
+func TestValidate(t *testing.T) {
+
+	file, err := ioutil.TempFile("", "gravity-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+
+	tests := []struct {
+		name   string
+		modify func(config *Config)
+		err    string
+	}{
+		{"valid", func(config *Config) {}, ""},
+		{"missing domain", func(config *Config) { config.Gravity.Domain = "" }, "gravity.domain is required"},
+		{"missing host", func(config *Config) { config.Gravity.Host = "" }, "gravity.host is required"},
+		{"invalid port", func(config *Config) { config.Gravity.Port = 70000 }, "gravity.port must be between"},
+		{"servers instead of host", func(config *Config) {
+			config.Gravity.Host = ""
+			config.Gravity.Port = 0
+			config.Gravity.Servers = []string{"nats://127.0.0.1:4222"}
+		}, ""},
+		{"empty server", func(config *Config) { config.Gravity.Servers = []string{"nats://127.0.0.1:4222", " "} }, "gravity.servers contains an empty entry"},
+		{"cert without key", func(config *Config) { config.Gravity.TLS.CertFile = file.Name() }, "must be set together"},
+		{"cert and key", func(config *Config) {
+			config.Gravity.TLS.CertFile = file.Name()
+			config.Gravity.TLS.KeyFile = file.Name()
+		}, ""},
+		{"missing ca file", func(config *Config) { config.Gravity.TLS.CAFile = file.Name() + ".missing" }, "gravity.tls.caFile is not readable"},
+		{"multiple authentication methods", func(config *Config) {
+			config.Gravity.Credentials = file.Name()
+			config.Gravity.Token = "token"
+		}, "only one of gravity.credentials, gravity.token can be set"},
+		{"invalid ping interval", func(config *Config) { config.Gravity.PingInterval = 0 }, "gravity.pingInterval"},
+		{"invalid request timeout", func(config *Config) { config.Gravity.RequestTimeout = -1 }, "gravity.requestTimeout"},
+		{"invalid stale timeout", func(config *Config) { config.AdapterManager.StaleTimeout = 0 }, "adapter_manager.staleTimeout"},
+		{"zero retention", func(config *Config) { config.AdapterManager.Retention = 0 }, ""},
+		{"negative retention", func(config *Config) { config.AdapterManager.Retention = -1 }, "adapter_manager.retention"},
+		{"zero pipelines", func(config *Config) { config.Controller.PipelineCount = 0 }, "controller.pipelineCount"},
+		{"missing store path", func(config *Config) { config.Controller.StorePath = "" }, "controller.storePath"},
+		{"auth service without channel", func(config *Config) {
+			config.AuthService.Enabled = true
+			config.AuthService.Channel = ""
+		}, "auth_service.channel"},
+		{"negative grace period", func(config *Config) { config.AuthService.KeyRotationGracePeriod = -1 }, "auth_service.keyRotationGracePeriod"},
+		{"negative cache size", func(config *Config) { config.AuthService.CacheSize = -1 }, "auth_service cache settings"},
+		{"invalid replay window", func(config *Config) { config.Security.ReplayWindow = 0 }, "security.replayWindow"},
+		{"invalid rate limit ignored while disabled", func(config *Config) { config.RateLimit.Rate = 0 }, ""},
+		{"invalid rate limit", func(config *Config) {
+			config.RateLimit.Enabled = true
+			config.RateLimit.Burst = 0
+		}, "rate_limit.rate and rate_limit.burst"},
+		{"method limit without method", func(config *Config) {
+			config.RateLimit.Enabled = true
+			config.RateLimit.Methods = []MethodRateLimitConfig{{Rate: 1, Burst: 1}}
+		}, "entry without method"},
+		{"invalid method limit", func(config *Config) {
+			config.RateLimit.Enabled = true
+			config.RateLimit.Methods = []MethodRateLimitConfig{{Method: "mgr.m", Rate: 1}}
+		}, "rate_limit.methods mgr.m"},
+		{"negative quota", func(config *Config) { config.Quota.MaxSubscribersPerApp = -1 }, "quota must not be negative"},
+		{"invalid session ttl", func(config *Config) { config.Session.TTL = 0 }, "session.ttl"},
+		{"negative audit retention", func(config *Config) { config.Audit.RetentionDays = -1 }, "audit.retentionDays"},
+		{"invalid log level", func(config *Config) { config.Log.Level = "verbose" }, "log.level is invalid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := newTestConfig(t)
+			tt.modify(config)
+
+			err := config.Validate()
+			if len(tt.err) == 0 {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Validate() = %v, want error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestDumpMasksSecrets(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		modify   func(config *Config)
+		path     []string
+		expected string
+	}{
+		{"access key", func(config *Config) { config.Gravity.AccessKey = "secret" }, []string{"gravity", "accessKey"}, "********"},
+		{"previous access key", func(config *Config) { config.Gravity.PreviousAccessKey = "secret" }, []string{"gravity", "previousAccessKey"}, "********"},
+		{"token", func(config *Config) { config.Gravity.Token = "secret" }, []string{"gravity", "token"}, "********"},
+		{"auth service access key", func(config *Config) { config.AuthService.AccessKey = "secret" }, []string{"auth_service", "accessKey"}, "********"},
+		{"empty secret", func(config *Config) { config.Gravity.AccessKey = "" }, []string{"gravity", "accessKey"}, ""},
+		{"other settings", func(config *Config) { config.Gravity.Host = "gravity.local" }, []string{"gravity", "host"}, "gravity.local"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := newTestConfig(t)
+			tt.modify(config)
+
+			data, err := config.Dump()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if strings.Contains(string(data), "secret") {
+				t.Fatalf("secret was dumped: %s", data)
+			}
+
+			var dump map[string]interface{}
+			err = json.Unmarshal(data, &dump)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			section := dump[tt.path[0]].(map[string]interface{})
+			if value := section[tt.path[1]]; value != tt.expected {
+				t.Errorf("%s = %v, want %q", strings.Join(tt.path, "."), value, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDumpKeepsConfig(t *testing.T) {
+
+	config := newTestConfig(t)
+	config.Gravity.AccessKey = "secret"
+
+	_, err := config.Dump()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Gravity.AccessKey != "secret" {
+		t.Errorf("gravity.accessKey was changed to %s by Dump", config.Gravity.AccessKey)
+	}
+}
@@ -1,20 +1,41 @@
 package controller
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
+
+// Status of adapter
+const (
+	AdapterStatusActive       = "active"
+	AdapterStatusStale        = "stale"
+	AdapterStatusUnregistered = "unregistered"
+)
 
 type Adapter struct {
-	controller *Controller
-	id         string
-	name       string
-	component  string
+	controller     *Controller
+	id             string
+	name           string
+	component      string
+	collections    []string
+	labels         map[string]string
+	lastSeen       time.Time
+	savedAt        time.Time
+	registered     bool
+	unregisteredAt time.Time
+	stale          bool
 }
 
 func NewAdapter(controller *Controller, component string, id string, name string) *Adapter {
 	return &Adapter{
-		controller: controller,
-		id:         id,
-		name:       name,
-		component:  component,
+		controller:  controller,
+		id:          id,
+		name:        name,
+		component:   component,
+		collections: make([]string, 0),
+		labels:      make(map[string]string),
+		lastSeen:    time.Now(),
+		registered:  true,
 	}
 }
 
@@ -28,9 +49,14 @@ func (adapter *Adapter) save() error {
 
 	// Preparing JSON string
 	data, err := json.Marshal(map[string]interface{}{
-		"id":        adapter.id,
-		"name":      adapter.name,
-		"component": adapter.component,
+		"id":             adapter.id,
+		"name":           adapter.name,
+		"component":      adapter.component,
+		"collections":    adapter.collections,
+		"labels":         adapter.labels,
+		"lastSeen":       adapter.lastSeen,
+		"registered":     adapter.registered,
+		"unregisteredAt": adapter.unregisteredAt,
 	})
 	if err != nil {
 		return err
@@ -41,6 +67,8 @@ func (adapter *Adapter) save() error {
 		return err
 	}
 
+	adapter.savedAt = time.Now()
+
 	return nil
 }
 
@@ -54,3 +82,33 @@ func (adapter *Adapter) release() error {
 
 	return store.Delete("adapters", []byte(adapter.id))
 }
+
+func (adapter *Adapter) hasCollection(collectionID string) bool {
+
+	for _, col := range adapter.collections {
+		if col == collectionID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (adapter *Adapter) healthCheck() {
+	adapter.lastSeen = time.Now()
+	adapter.stale = false
+}
+
+// getStatus returns status of adapter, adapter is stale if it has no health check within timeout
+func (adapter *Adapter) getStatus(staleTimeout time.Duration) string {
+
+	if !adapter.registered {
+		return AdapterStatusUnregistered
+	}
+
+	if time.Since(adapter.lastSeen) > staleTimeout {
+		return AdapterStatusStale
+	}
+
+	return AdapterStatusActive
+}
@@ -2,20 +2,34 @@ package controller
 
 import (
 	"encoding/json"
+	"errors"
 	"sync"
+	"time"
 
 	"github.com/BrobridgeOrg/broc"
 	"github.com/BrobridgeOrg/gravity-sdk/core/keyring"
 	log "github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
+)
+
+const (
+	// Interval of checking adapters which are stale or expired
+	DefaultAdapterCheckInterval = 5 * time.Second
+
+	// Last seen time is persisted on health check at most once per interval
+	DefaultAdapterSaveInterval = 30 * time.Second
+)
+
+var (
+	ErrAdapterNotFound     = errors.New("adapter manager: adapter not found")
+	ErrAdapterUnregistered = errors.New("adapter manager: adapter is unregistered")
 )
 
 type AdapterManager struct {
-	controller     *Controller
-	allowAnonymous bool
-	rpcEngine      *broc.Broc
-	adapters       map[string]*Adapter
-	mutex          sync.RWMutex
+	controller *Controller
+	rpcEngine  *broc.Broc
+	jsonEngine *broc.Broc
+	adapters   map[string]*Adapter
+	mutex      sync.RWMutex
 }
 
 func NewAdapterManager(controller *Controller) *AdapterManager {
@@ -28,15 +42,8 @@ func NewAdapterManager(controller *Controller) *AdapterManager {
 func (am *AdapterManager) Initialize() error {
 
 	// Load configurations
-	viper.SetDefault("adapter_manager.allowAnonymous", true)
-	am.allowAnonymous = viper.GetBool("adapter_manager.allowAnonymous")
-	if am.allowAnonymous {
-		key := am.controller.keyring.Get("anonymous")
-		if key == nil {
-			key = am.controller.keyring.Put("anonymous", "")
-		}
-
-		key.Permission().AddPermissions([]string{"ADAPTER"})
+	if am.isAnonymousAllowed() {
+		am.controller.setAnonymousPermission("ADAPTER", true)
 	}
 
 	// Restore states from store
@@ -47,7 +54,7 @@ func (am *AdapterManager) Initialize() error {
 
 	err = store.RegisterColumns([]string{"adapters"})
 	if err != nil {
-		return nil
+		return err
 	}
 
 	log.Info("Trying to restoring adapters...")
@@ -63,10 +70,44 @@ func (am *AdapterManager) Initialize() error {
 			data["name"].(string),
 		)
 
+		// Adapters which were saved by older versions are registered
+		if registered, ok := data["registered"].(bool); ok {
+			adapter.registered = registered
+		}
+
+		if lastSeen, ok := data["lastSeen"].(string); ok {
+			t, err := time.Parse(time.RFC3339Nano, lastSeen)
+			if err == nil {
+				adapter.lastSeen = t
+			}
+		}
+
+		if unregisteredAt, ok := data["unregisteredAt"].(string); ok {
+			t, err := time.Parse(time.RFC3339Nano, unregisteredAt)
+			if err == nil {
+				adapter.unregisteredAt = t
+			}
+		}
+
+		if collections, ok := data["collections"].([]interface{}); ok {
+			for _, col := range collections {
+				if c, ok := col.(string); ok {
+					adapter.collections = append(adapter.collections, c)
+				}
+			}
+
+			if adapter.registered {
+				am.controller.collectionIndex.SetAdapter(adapter.id, adapter.collections)
+			}
+		}
+
+		adapter.labels = parseLabels(data["labels"])
+
 		log.WithFields(log.Fields{
 			"id":        adapter.id,
 			"name":      adapter.name,
 			"component": adapter.component,
+			"status":    adapter.getStatus(am.getStaleTimeout()),
 		}).Info("Restored adapter")
 
 		return true
@@ -77,9 +118,123 @@ func (am *AdapterManager) Initialize() error {
 		return err
 	}
 
+	go am.watchStaleness()
+
+	return nil
+}
+
+func (am *AdapterManager) getStaleTimeout() time.Duration {
+	return time.Duration(am.controller.getConfig().AdapterManager.StaleTimeout) * time.Second
+}
+
+func (am *AdapterManager) getRetention() time.Duration {
+	return time.Duration(am.controller.getConfig().AdapterManager.Retention) * time.Second
+}
+
+func (am *AdapterManager) watchStaleness() {
+
+	ticker := time.NewTicker(DefaultAdapterCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-am.controller.shutdown:
+			return
+		case <-ticker.C:
+			am.checkStaleness()
+			am.pruneUnregistered()
+		}
+	}
+}
+
+// checkStaleness finds adapters which have no health check within timeout, every adapter is reported once until it recovers
+func (am *AdapterManager) checkStaleness() {
+
+	timeout := am.getStaleTimeout()
+
+	am.mutex.Lock()
+	stale := make([]*Adapter, 0)
+	lastSeen := make([]time.Time, 0)
+	for _, adapter := range am.adapters {
+		if adapter.stale || adapter.getStatus(timeout) != AdapterStatusStale {
+			continue
+		}
+
+		adapter.stale = true
+		stale = append(stale, adapter)
+		lastSeen = append(lastSeen, adapter.lastSeen)
+	}
+	am.mutex.Unlock()
+
+	for i, adapter := range stale {
+		log.WithFields(log.Fields{
+			"id":        adapter.id,
+			"name":      adapter.name,
+			"component": adapter.component,
+			"lastSeen":  lastSeen[i],
+		}).Warn("Adapter is stale")
+
+		am.controller.events.PublishAdapter(EventAdapterStale, adapter)
+	}
+}
+
+// pruneUnregistered removes adapters which were unregistered longer than retention
+func (am *AdapterManager) pruneUnregistered() {
+
+	retention := am.getRetention()
+
+	am.mutex.Lock()
+	defer am.mutex.Unlock()
+
+	for _, adapter := range am.adapters {
+		if adapter.registered || time.Since(adapter.unregisteredAt) < retention {
+			continue
+		}
+
+		err := am.remove(adapter)
+		if err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// remove takes off adapter from registry and store, lock has to be held by caller
+func (am *AdapterManager) remove(adapter *Adapter) error {
+
+	err := adapter.release()
+	if err != nil {
+		return err
+	}
+
+	delete(am.adapters, adapter.id)
+	am.controller.collectionIndex.SetAdapter(adapter.id, nil)
+
+	log.WithFields(log.Fields{
+		"id":        adapter.id,
+		"name":      adapter.name,
+		"component": adapter.component,
+	}).Info("Removed adapter")
+
 	return nil
 }
 
+func (am *AdapterManager) isAnonymousAllowed() bool {
+	return am.controller.getConfig().AdapterManager.AllowAnonymous
+}
+
+// SetAllowAnonymous updates permission of anonymous key, the setting itself is kept in configurations
+func (am *AdapterManager) SetAllowAnonymous(allowAnonymous bool) {
+
+	key := am.controller.setAnonymousPermission("ADAPTER", allowAnonymous)
+	if key != nil {
+		am.controller.synchronizerManager.UpdateKeyring(key)
+	}
+
+	log.WithFields(log.Fields{
+		"allowAnonymous": allowAnonymous,
+	}).Info("Applied anonymous access setting for adapters")
+}
+
 func (am *AdapterManager) addAdapter(component string, adapterID string, name string) *Adapter {
 
 	am.mutex.Lock()
@@ -101,7 +256,13 @@ func (am *AdapterManager) Register(component string, adapterID string, name stri
 
 	adapter := am.addAdapter(component, adapterID, name)
 
+	am.mutex.Lock()
+	adapter.registered = true
+	adapter.unregisteredAt = time.Time{}
+	adapter.healthCheck()
+	am.controller.collectionIndex.SetAdapter(adapterID, adapter.collections)
 	adapter.save()
+	am.mutex.Unlock()
 
 	// Update keyring to syncronizer
 	am.controller.synchronizerManager.UpdateKeyring(key)
@@ -115,6 +276,8 @@ func (am *AdapterManager) Register(component string, adapterID string, name stri
 	return nil
 }
 
+// Unregister keeps adapter for retention to report its status, it is removed
+// right away if retention is disabled.
 func (am *AdapterManager) Unregister(adapterID string) error {
 
 	am.mutex.Lock()
@@ -126,12 +289,61 @@ func (am *AdapterManager) Unregister(adapterID string) error {
 		return nil
 	}
 
-	adapter.release()
+	if am.getRetention() == 0 {
+		return am.remove(adapter)
+	}
 
-	// Remove adapter from registry
-	delete(am.adapters, adapterID)
+	adapter.registered = false
+	adapter.unregisteredAt = time.Now()
+	am.controller.collectionIndex.SetAdapter(adapterID, nil)
 
-	return nil
+	return adapter.save()
+}
+
+// HealthCheck records that adapter is alive
+func (am *AdapterManager) HealthCheck(adapterID string) error {
+
+	am.mutex.Lock()
+	defer am.mutex.Unlock()
+
+	adapter, ok := am.adapters[adapterID]
+	if !ok {
+		return ErrAdapterNotFound
+	}
+
+	if !adapter.registered {
+		return ErrAdapterUnregistered
+	}
+
+	if adapter.stale {
+		log.WithFields(log.Fields{
+			"id":        adapter.id,
+			"name":      adapter.name,
+			"component": adapter.component,
+		}).Info("Adapter recovered")
+	}
+
+	adapter.healthCheck()
+
+	// Last seen time survives restarts, it is persisted once in a while
+	if time.Since(adapter.savedAt) < DefaultAdapterSaveInterval {
+		return nil
+	}
+
+	return adapter.save()
+}
+
+func (am *AdapterManager) GetAdapter(adapterID string) *Adapter {
+
+	am.mutex.RLock()
+	defer am.mutex.RUnlock()
+
+	adapter, ok := am.adapters[adapterID]
+	if !ok {
+		return nil
+	}
+
+	return adapter
 }
 
 func (am *AdapterManager) GetAdapters() ([]*Adapter, error) {
@@ -146,3 +358,121 @@ func (am *AdapterManager) GetAdapters() ([]*Adapter, error) {
 
 	return adapters, nil
 }
+
+// UpdateCollections replaces collections which are produced by adapter
+func (am *AdapterManager) UpdateCollections(adapterID string, collections []string) error {
+
+	am.mutex.Lock()
+	defer am.mutex.Unlock()
+
+	adapter, ok := am.adapters[adapterID]
+	if !ok {
+		return ErrAdapterNotFound
+	}
+
+	adapter.collections = make([]string, 0, len(collections))
+	for _, col := range collections {
+		if len(col) == 0 || adapter.hasCollection(col) {
+			continue
+		}
+
+		adapter.collections = append(adapter.collections, col)
+	}
+
+	if adapter.registered {
+		am.controller.collectionIndex.SetAdapter(adapterID, adapter.collections)
+	}
+
+	return adapter.save()
+}
+
+// RemoveCollection drops collection from all adapters which produce it
+func (am *AdapterManager) RemoveCollection(collectionID string) {
+
+	am.mutex.Lock()
+	defer am.mutex.Unlock()
+
+	for _, adapter := range am.adapters {
+		if !adapter.hasCollection(collectionID) {
+			continue
+		}
+
+		collections := make([]string, 0, len(adapter.collections))
+		for _, col := range adapter.collections {
+			if col != collectionID {
+				collections = append(collections, col)
+			}
+		}
+
+		adapter.collections = collections
+		if adapter.registered {
+			am.controller.collectionIndex.SetAdapter(adapter.id, collections)
+		}
+
+		err := adapter.save()
+		if err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// GetCollectionAdapters returns adapters which produce collection
+func (am *AdapterManager) GetCollectionAdapters(collectionID string) []*Adapter {
+
+	refs := am.controller.collectionIndex.GetRefs(collectionID)
+
+	am.mutex.RLock()
+	defer am.mutex.RUnlock()
+
+	adapters := make([]*Adapter, 0, len(refs.Adapters))
+	for _, adapterID := range refs.Adapters {
+		if adapter, ok := am.adapters[adapterID]; ok {
+			adapters = append(adapters, adapter)
+		}
+	}
+
+	return adapters
+}
+
+// SetLabels changes labels of adapter and returns the result
+func (am *AdapterManager) SetLabels(adapterID string, changes map[string]*string) (map[string]string, error) {
+
+	am.mutex.Lock()
+	defer am.mutex.Unlock()
+
+	adapter, ok := am.adapters[adapterID]
+	if !ok {
+		return nil, ErrAdapterNotFound
+	}
+
+	labels, err := PatchLabels(adapter.labels, changes)
+	if err != nil {
+		return nil, err
+	}
+
+	adapter.labels = labels
+
+	err = adapter.save()
+	if err != nil {
+		return nil, err
+	}
+
+	return copyLabels(labels), nil
+}
+
+// GetAdapterCollections returns collections which are produced by adapter
+func (am *AdapterManager) GetAdapterCollections(adapterID string) ([]string, error) {
+
+	am.mutex.RLock()
+	defer am.mutex.RUnlock()
+
+	adapter, ok := am.adapters[adapterID]
+	if !ok {
+		return nil, ErrAdapterNotFound
+	}
+
+	collections := make([]string, len(adapter.collections))
+	copy(collections, adapter.collections)
+
+	return collections, nil
+}
@@ -1,7 +1,9 @@
 package controller
 
 import (
+	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/golang/protobuf/proto"
 	log "github.com/sirupsen/logrus"
@@ -9,32 +11,104 @@ import (
 	"github.com/BrobridgeOrg/broc"
 	packet_pb "github.com/BrobridgeOrg/gravity-api/packet"
 	pb "github.com/BrobridgeOrg/gravity-api/service/adapter_manager"
-	"github.com/BrobridgeOrg/gravity-controller/pkg/controller/service/middleware"
 )
 
+type HealthCheckRequest struct {
+	AdapterID string `json:"adapterID"`
+}
+
+type HealthCheckReply struct {
+	Success bool   `json:"success"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+type UpdateAdapterCollectionsRequest struct {
+	AdapterID   string   `json:"adapterID"`
+	Collections []string `json:"collections"`
+}
+
+type UpdateAdapterCollectionsReply struct {
+	Success bool   `json:"success"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+type AdapterInfo struct {
+	AdapterID   string            `json:"adapterID"`
+	Name        string            `json:"name"`
+	Component   string            `json:"component"`
+	Collections []string          `json:"collections"`
+	Labels      map[string]string `json:"labels"`
+	Status      string            `json:"status"`
+	LastSeen    time.Time         `json:"lastSeen"`
+}
+
+type ListAdaptersReply struct {
+	Success  bool           `json:"success"`
+	Reason   string         `json:"reason,omitempty"`
+	Adapters []*AdapterInfo `json:"adapters"`
+}
+
 func (am *AdapterManager) initialize_rpc() error {
 
 	log.Info("Initializing RPC Handlers for AdapterManager")
 
 	// Initializing authentication middleware
-	m := middleware.NewMiddleware(map[string]interface{}{
-		"Authentication": &middleware.Authentication{
-			Enabled: true,
-			Keyring: am.controller.keyring,
-		},
-	})
+	m := am.controller.newMiddleware()
 
 	// Initializing RPC engine to handle requests
 	am.rpcEngine = broc.NewBroc(am.controller.gravityClient.GetConnection())
 	am.rpcEngine.Use(m.PacketHandler)
 	am.rpcEngine.SetPrefix(fmt.Sprintf("%s.adapter_manager.", am.controller.domain))
 
+	// Methods which are not defined by gravity-api are encoded in JSON, they are
+	// served under a prefix of their own
+	am.jsonEngine = broc.NewBroc(am.controller.gravityClient.GetConnection())
+	am.jsonEngine.Use(m.PacketHandler)
+	am.jsonEngine.SetPrefix(fmt.Sprintf("%s.adapter_manager.json.", am.controller.domain))
+
 	// Register methods
-	am.rpcEngine.Register("register", m.RequiredAuth("ADAPTER"), am.rpc_register)
-	am.rpcEngine.Register("unregister", m.RequiredAuth("ADAPTER"), am.rpc_unregister)
-	am.rpcEngine.Register("getAdapters", m.RequiredAuth("SYSTEM", "ADAPTER_MANAGER"), am.rpc_getAdapters)
+	am.rpcEngine.Register("register",
+		m.RequiredMethod("adapter_manager.register"),
+		m.RateLimit("adapter_manager.register"),
+		am.rpc_register,
+	)
+	am.rpcEngine.Register("unregister",
+		m.RequiredMethod("adapter_manager.unregister"),
+		m.RateLimit("adapter_manager.unregister"),
+		am.rpc_unregister,
+	)
+	am.rpcEngine.Register("getAdapters",
+		m.RequiredMethod("adapter_manager.getAdapters"),
+		m.RateLimit("adapter_manager.getAdapters"),
+		am.rpc_getAdapters,
+	)
+	am.jsonEngine.Register("updateAdapterCollections",
+		m.RequiredMethod("adapter_manager.updateAdapterCollections"),
+		m.RateLimit("adapter_manager.updateAdapterCollections"),
+		am.rpc_updateAdapterCollections,
+	)
+	am.jsonEngine.Register("setAdapterLabels",
+		m.RequiredMethod("adapter_manager.setAdapterLabels"),
+		m.RateLimit("adapter_manager.setAdapterLabels"),
+		am.rpc_setAdapterLabels,
+	)
+	am.jsonEngine.Register("healthCheck",
+		m.RequiredMethod("adapter_manager.healthCheck"),
+		m.RateLimit("adapter_manager.healthCheck"),
+		am.rpc_healthCheck,
+	)
+	am.jsonEngine.Register("listAdapters",
+		m.RequiredMethod("adapter_manager.listAdapters"),
+		m.RateLimit("adapter_manager.listAdapters"),
+		am.rpc_listAdapters,
+	)
+
+	err := am.rpcEngine.Apply()
+	if err != nil {
+		return err
+	}
 
-	return am.rpcEngine.Apply()
+	return am.jsonEngine.Apply()
 }
 
 func (am *AdapterManager) rpc_register(ctx *broc.Context) (returnedValue interface{}, err error) {
@@ -49,8 +123,14 @@ func (am *AdapterManager) rpc_register(ctx *broc.Context) (returnedValue interfa
 		err = e
 	}()
 
-	// Parsing request data
 	var req pb.RegisterAdapterRequest
+
+	// Audit trail
+	defer func() {
+		am.controller.audit.RecordContext(ctx, "adapter_manager.register", req.AdapterID, reply.Success, reply.Reason)
+	}()
+
+	// Parsing request data
 	payload := ctx.Get("payload").(*packet_pb.Payload)
 	err = proto.Unmarshal(payload.Data, &req)
 	if err != nil {
@@ -62,7 +142,7 @@ func (am *AdapterManager) rpc_register(ctx *broc.Context) (returnedValue interfa
 	}
 
 	// Authenticate
-	key := am.controller.auth.Authenticate(req.AppID, req.Token, am.allowAnonymous)
+	key := am.controller.auth.Authenticate(req.AppID, req.Token, am.isAnonymousAllowed())
 	if key == nil {
 		reply.Success = false
 		reply.Reason = "Forbidden"
@@ -94,8 +174,14 @@ func (am *AdapterManager) rpc_unregister(ctx *broc.Context) (returnedValue inter
 		err = e
 	}()
 
-	// Parsing request data
 	var req pb.UnregisterAdapterRequest
+
+	// Audit trail
+	defer func() {
+		am.controller.audit.RecordContext(ctx, "adapter_manager.unregister", req.AdapterID, reply.Success, reply.Reason)
+	}()
+
+	// Parsing request data
 	payload := ctx.Get("payload").(*packet_pb.Payload)
 	err = proto.Unmarshal(payload.Data, &req)
 	if err != nil {
@@ -152,15 +238,212 @@ func (am *AdapterManager) rpc_getAdapters(ctx *broc.Context) (returnedValue inte
 		return
 	}
 
-	// Preparing results
-	adapters := make([]*pb.Adapter, len(results))
-	for i, adapter := range results {
+	am.mutex.RLock()
+	defer am.mutex.RUnlock()
 
-		adapters[i] = &pb.Adapter{
+	// Preparing results, unregistered adapters and status are reported by listAdapters
+	adapters := make([]*pb.Adapter, 0, len(results))
+	for _, adapter := range results {
+
+		if !adapter.registered {
+			continue
+		}
+
+		adapters = append(adapters, &pb.Adapter{
 			AdapterID: adapter.id,
 			Name:      adapter.name,
 			Component: adapter.component,
+		})
+	}
+
+	reply.Adapters = adapters
+
+	return
+}
+
+func (am *AdapterManager) rpc_healthCheck(ctx *broc.Context) (returnedValue interface{}, err error) {
+
+	// Reply
+	reply := HealthCheckReply{
+		Success: true,
+	}
+	defer func() {
+		data, e := json.Marshal(&reply)
+		returnedValue = data
+		err = e
+	}()
+
+	// Parsing request data
+	var req HealthCheckRequest
+	payload := ctx.Get("payload").(*packet_pb.Payload)
+	err = json.Unmarshal(payload.Data, &req)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = "UnknownParameter"
+		return
+	}
+
+	err = am.HealthCheck(req.AdapterID)
+	if err != nil {
+		reply.Success = false
+		reply.Reason = err.Error()
+		return
+	}
+
+	return
+}
+
+func (am *AdapterManager) rpc_updateAdapterCollections(ctx *broc.Context) (returnedValue interface{}, err error) {
+
+	// Reply
+	reply := UpdateAdapterCollectionsReply{
+		Success: true,
+	}
+	defer func() {
+		data, e := json.Marshal(&reply)
+		returnedValue = data
+		err = e
+	}()
+
+	var req UpdateAdapterCollectionsRequest
+
+	// Audit trail
+	defer func() {
+		am.controller.audit.RecordContext(ctx, "adapter_manager.updateAdapterCollections", req.AdapterID, reply.Success, reply.Reason)
+	}()
+
+	// Parsing request data
+	payload := ctx.Get("payload").(*packet_pb.Payload)
+	err = json.Unmarshal(payload.Data, &req)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = "UnknownParameter"
+		return
+	}
+
+	err = am.controller.collectionManager.Reference(func() error {
+		return am.UpdateCollections(req.AdapterID, req.Collections)
+	})
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = err.Error()
+		return
+	}
+
+	return
+}
+
+func (am *AdapterManager) rpc_setAdapterLabels(ctx *broc.Context) (returnedValue interface{}, err error) {
+
+	// Reply
+	reply := SetLabelsReply{
+		Success: true,
+	}
+	defer func() {
+		data, e := json.Marshal(&reply)
+		returnedValue = data
+		err = e
+	}()
+
+	var req SetLabelsRequest
+
+	// Audit trail
+	defer func() {
+		am.controller.audit.RecordContext(ctx, "adapter_manager.setAdapterLabels", req.ID, reply.Success, reply.Reason)
+	}()
+
+	// Parsing request data
+	payload := ctx.Get("payload").(*packet_pb.Payload)
+	err = json.Unmarshal(payload.Data, &req)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = "UnknownParameter"
+		return
+	}
+
+	labels, err := am.SetLabels(req.ID, req.Labels)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = err.Error()
+		return
+	}
+
+	reply.Labels = labels
+
+	return
+}
+
+func (am *AdapterManager) rpc_listAdapters(ctx *broc.Context) (returnedValue interface{}, err error) {
+
+	// Reply
+	reply := ListAdaptersReply{
+		Success: true,
+	}
+	defer func() {
+		data, e := json.Marshal(&reply)
+		returnedValue = data
+		err = e
+	}()
+
+	// Parsing request data
+	var req ListRequest
+	payload := ctx.Get("payload").(*packet_pb.Payload)
+	err = json.Unmarshal(payload.Data, &req)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = "UnknownParameter"
+		return
+	}
+
+	selector, err := ParseLabelSelector(req.Selector)
+	if err != nil {
+		reply.Success = false
+		reply.Reason = err.Error()
+		return
+	}
+
+	results, err := am.GetAdapters()
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = err.Error()
+		return
+	}
+
+	staleTimeout := am.getStaleTimeout()
+
+	am.mutex.RLock()
+	defer am.mutex.RUnlock()
+
+	adapters := make([]*AdapterInfo, 0, len(results))
+	for _, adapter := range results {
+
+		if !selector.Matches(adapter.labels) {
+			continue
 		}
+
+		adapters = append(adapters, &AdapterInfo{
+			AdapterID:   adapter.id,
+			Name:        adapter.name,
+			Component:   adapter.component,
+			Collections: append([]string{}, adapter.collections...),
+			Labels:      copyLabels(adapter.labels),
+			Status:      adapter.getStatus(staleTimeout),
+			LastSeen:    adapter.lastSeen,
+		})
 	}
 
 	reply.Adapters = adapters
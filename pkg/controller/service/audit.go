@@ -0,0 +1,377 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/BrobridgeOrg/broc"
+	packet_pb "github.com/BrobridgeOrg/gravity-api/packet"
+	"github.com/BrobridgeOrg/gravity-sdk/core/keyring"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultAuditQueryCount    = 100
+	DefaultAuditPruneInterval = time.Hour
+	MaxAuditPruneBatch        = 10000
+)
+
+// Width of timestamp part of record IDs
+const auditKeyWidth = 20
+
+var (
+	ErrInvalidStartID = errors.New("InvalidStartID")
+)
+
+type AuditRecord struct {
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	AppID     string    `json:"appID"`
+	Action    string    `json:"action"`
+	Target    string    `json:"target"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+type AuditQuery struct {
+	StartID   string
+	StartTime time.Time
+	EndTime   time.Time
+	AppID     string
+	Action    string
+	Count     int
+}
+
+type AuditLog struct {
+	controller *Controller
+	rpcEngine  *broc.Broc
+	file       *os.File
+	seq        uint64
+	mutex      sync.Mutex
+}
+
+func NewAuditLog(controller *Controller) *AuditLog {
+	return &AuditLog{
+		controller: controller,
+	}
+}
+
+func (al *AuditLog) Initialize() error {
+
+	store, err := al.controller.store.GetEngine().GetStore("gravity_audit")
+	if err != nil {
+		return err
+	}
+
+	err = store.RegisterColumns([]string{"records"})
+	if err != nil {
+		return err
+	}
+
+	// Optional JSON-lines file sink
+	filename := al.controller.getConfig().Audit.File
+	if len(filename) > 0 {
+
+		log.WithFields(log.Fields{
+			"file": filename,
+		}).Info("Writing audit records to file")
+
+		f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+
+		al.mutex.Lock()
+		al.file = f
+		al.mutex.Unlock()
+	}
+
+	go al.watchRetention()
+
+	return al.initializeRPC()
+}
+
+// Close stops writing records to file sink
+func (al *AuditLog) Close() {
+
+	al.mutex.Lock()
+	defer al.mutex.Unlock()
+
+	if al.file == nil {
+		return
+	}
+
+	err := al.file.Close()
+	if err != nil {
+		log.Error(err)
+	}
+
+	al.file = nil
+}
+
+func (al *AuditLog) watchRetention() {
+
+	ticker := time.NewTicker(DefaultAuditPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		days := al.controller.getConfig().Audit.RetentionDays
+		if days > 0 {
+			err := al.Prune(time.Duration(days) * 24 * time.Hour)
+			if err != nil {
+				log.Error(err)
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-al.controller.shutdown:
+			return
+		}
+	}
+}
+
+// Prune deletes records which are older than retention
+func (al *AuditLog) Prune(retention time.Duration) error {
+
+	store, err := al.controller.store.GetEngine().GetStore("gravity_audit")
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().Add(-retention).UnixNano()
+	if cutoff <= 0 {
+		return nil
+	}
+
+	total := 0
+	for {
+		// Collect keys first and delete them after listing
+		keys := make([][]byte, 0)
+		for _, prefix := range keyPrefixes(0, uint64(cutoff-1), auditKeyWidth) {
+			err := store.List("records", []byte(prefix), func(key []byte, value []byte) bool {
+				keys = append(keys, append([]byte{}, key...))
+				return len(keys) < MaxAuditPruneBatch
+			})
+			if err != nil {
+				return err
+			}
+
+			if len(keys) >= MaxAuditPruneBatch {
+				break
+			}
+		}
+
+		for _, key := range keys {
+			err := store.Delete("records", key)
+			if err != nil {
+				return err
+			}
+		}
+
+		total += len(keys)
+
+		if len(keys) < MaxAuditPruneBatch {
+			break
+		}
+	}
+
+	if total > 0 {
+		log.WithFields(log.Fields{
+			"count": total,
+		}).Info("Pruned audit records")
+	}
+
+	return nil
+}
+
+func (al *AuditLog) Record(appID string, action string, target string, success bool, reason string) {
+
+	now := time.Now()
+	seq := atomic.AddUint64(&al.seq, 1)
+
+	record := &AuditRecord{
+		// Keys are sortable by time so the store can be listed in order
+		ID:        fmt.Sprintf("%020d-%06d", now.UnixNano(), seq%1000000),
+		Timestamp: now,
+		AppID:     appID,
+		Action:    action,
+		Target:    target,
+		Success:   success,
+		Reason:    reason,
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	store, err := al.controller.store.GetEngine().GetStore("gravity_audit")
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	err = store.Put("records", []byte(record.ID), data)
+	if err != nil {
+		log.Error(err)
+	}
+
+	// File sink can be closed at any time
+	al.mutex.Lock()
+	defer al.mutex.Unlock()
+
+	if al.file == nil {
+		return
+	}
+
+	_, err = al.file.Write(append(data, '\n'))
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+func (al *AuditLog) RecordContext(ctx *broc.Context, action string, target string, success bool, reason string) {
+
+	appID := ""
+	if key, ok := ctx.Get("key").(*keyring.KeyInfo); ok {
+		// Packets of sessions carry token instead of appID
+		appID = key.GetAppID()
+	} else if packet, ok := ctx.Get("request").(*packet_pb.Packet); ok {
+		appID = packet.AppID
+	}
+
+	al.Record(appID, action, target, success, reason)
+}
+
+func (al *AuditLog) Query(q *AuditQuery) ([]*AuditRecord, string, error) {
+
+	store, err := al.controller.store.GetEngine().GetStore("gravity_audit")
+	if err != nil {
+		return nil, "", err
+	}
+
+	count := q.Count
+	if count <= 0 {
+		count = DefaultAuditQueryCount
+	}
+
+	// Seek to time range instead of scanning all records
+	lo := uint64(0)
+	if !q.StartTime.IsZero() && q.StartTime.UnixNano() > 0 {
+		lo = uint64(q.StartTime.UnixNano())
+	}
+
+	if len(q.StartID) > 0 {
+		ts, err := strconv.ParseUint(strings.SplitN(q.StartID, "-", 2)[0], 10, 64)
+		if err != nil {
+			return nil, "", ErrInvalidStartID
+		}
+
+		if ts > lo {
+			lo = ts
+		}
+	}
+
+	hi := uint64(math.MaxInt64)
+	if !q.EndTime.IsZero() {
+		if q.EndTime.UnixNano() < 0 {
+			return []*AuditRecord{}, "", nil
+		}
+
+		hi = uint64(q.EndTime.UnixNano())
+	}
+
+	records := make([]*AuditRecord, 0)
+	if lo > hi {
+		return records, "", nil
+	}
+
+	nextID := ""
+	full := false
+	for _, prefix := range keyPrefixes(lo, hi, auditKeyWidth) {
+		err = store.List("records", []byte(prefix), func(key []byte, value []byte) bool {
+
+			if len(q.StartID) > 0 && string(key) < q.StartID {
+				return true
+			}
+
+			var record AuditRecord
+			err := json.Unmarshal(value, &record)
+			if err != nil {
+				log.Errorf("Unrecognized audit record: %s", string(key))
+				return true
+			}
+
+			if len(q.AppID) > 0 && record.AppID != q.AppID {
+				return true
+			}
+
+			if len(q.Action) > 0 && record.Action != q.Action {
+				return true
+			}
+
+			if len(records) == count {
+				nextID = record.ID
+				full = true
+				return false
+			}
+
+			records = append(records, &record)
+
+			return true
+		})
+		if err != nil {
+			return nil, "", err
+		}
+
+		if full {
+			break
+		}
+	}
+
+	return records, nextID, nil
+}
+
+// keyPrefixes returns prefixes of zero-padded decimal keys which cover the
+// range from lo to hi in order, so the range can be listed without scanning
+// keys outside of it.
+func keyPrefixes(lo uint64, hi uint64, width int) []string {
+
+	prefixes := make([]string, 0)
+	for lo <= hi {
+
+		// Find the largest aligned block which fits in the range
+		digits := 0
+		size := uint64(1)
+		for digits < width-1 {
+			next := size * 10
+			if lo%next != 0 || next-1 > hi-lo {
+				break
+			}
+
+			size = next
+			digits++
+		}
+
+		key := fmt.Sprintf("%0*d", width, lo)
+		prefixes = append(prefixes, key[:width-digits])
+
+		if hi-lo < size {
+			break
+		}
+
+		lo += size
+	}
+
+	return prefixes
+}
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/BrobridgeOrg/broc"
+	packet_pb "github.com/BrobridgeOrg/gravity-api/packet"
+	audit_pb "github.com/BrobridgeOrg/gravity-controller/pkg/api/audit"
+	"github.com/golang/protobuf/proto"
+	log "github.com/sirupsen/logrus"
+)
+
+//go:generate protoc -I ../../api --go_out=../../api --go_opt=paths=source_relative audit/audit.proto
+
+func (al *AuditLog) initializeRPC() error {
+
+	log.Info("Initializing RPC Handlers for AuditLog")
+
+	// Initializing authentication middleware
+	m := al.controller.newMiddleware()
+
+	// Initializing RPC engine to handle requests
+	al.rpcEngine = broc.NewBroc(al.controller.gravityClient.GetConnection())
+	al.rpcEngine.Use(m.PacketHandler)
+	al.rpcEngine.SetPrefix(fmt.Sprintf("%s.audit.", al.controller.domain))
+
+	// Register methods
+	al.rpcEngine.Register("getAuditLog",
+		m.RequiredMethod("audit.getAuditLog"),
+		m.RateLimit("audit.getAuditLog"),
+		al.rpc_getAuditLog,
+	)
+
+	return al.rpcEngine.Apply()
+}
+
+func (al *AuditLog) rpc_getAuditLog(ctx *broc.Context) (returnedValue interface{}, err error) {
+
+	// Reply
+	reply := audit_pb.GetAuditLogReply{
+		Success: true,
+	}
+	defer func() {
+		data, e := proto.Marshal(&reply)
+		returnedValue = data
+		err = e
+	}()
+
+	// Parsing request data
+	var req audit_pb.GetAuditLogRequest
+	payload := ctx.Get("payload").(*packet_pb.Payload)
+	err = proto.Unmarshal(payload.Data, &req)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = "UnknownParameter"
+		return
+	}
+
+	q := &AuditQuery{
+		StartID: req.StartID,
+		AppID:   req.AppID,
+		Action:  req.Action,
+		Count:   int(req.Count),
+	}
+
+	if req.StartTime != 0 {
+		q.StartTime = time.Unix(0, req.StartTime)
+	}
+
+	if req.EndTime != 0 {
+		q.EndTime = time.Unix(0, req.EndTime)
+	}
+
+	records, nextID, err := al.Query(q)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = err.Error()
+		return
+	}
+
+	reply.Records = make([]*audit_pb.AuditRecord, 0, len(records))
+	for _, record := range records {
+		reply.Records = append(reply.Records, &audit_pb.AuditRecord{
+			Id:        record.ID,
+			Timestamp: record.Timestamp.UnixNano(),
+			AppID:     record.AppID,
+			Action:    record.Action,
+			Target:    record.Target,
+			Success:   record.Success,
+			Reason:    record.Reason,
+		})
+	}
+
+	reply.NextID = nextID
+
+	return
+}
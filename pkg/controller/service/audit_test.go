@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestKeyPrefixes(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		lo       uint64
+		hi       uint64
+		width    int
+		expected []string
+	}{
+		{"single key", 123, 123, 4, []string{"0123"}},
+		{"aligned block", 100, 199, 4, []string{"01"}},
+		{"whole range", 0, 9999, 4, []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9"}},
+		{"unaligned range", 95, 212, 4, []string{"0095", "0096", "0097", "0098", "0099", "01", "020", "0210", "0211", "0212"}},
+		{"empty range", 10, 9, 4, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefixes := keyPrefixes(tt.lo, tt.hi, tt.width)
+			if !reflect.DeepEqual(prefixes, tt.expected) {
+				t.Errorf("keyPrefixes(%d, %d) = %v, want %v", tt.lo, tt.hi, prefixes, tt.expected)
+			}
+		})
+	}
+}
+
+func TestKeyPrefixesCoverRange(t *testing.T) {
+
+	ranges := [][2]uint64{
+		{0, 0},
+		{7, 7},
+		{3, 4567},
+		{1000, 1999},
+		{999, 1001},
+		{5000, 9999},
+	}
+
+	for _, r := range ranges {
+		prefixes := keyPrefixes(r[0], r[1], 4)
+
+		// Every key is matched by exactly one prefix if and only if it is in range
+		for v := uint64(0); v < 10000; v++ {
+			key := fmt.Sprintf("%04d", v)
+
+			matched := 0
+			for _, prefix := range prefixes {
+				if strings.HasPrefix(key, prefix) {
+					matched++
+				}
+			}
+
+			inRange := v >= r[0] && v <= r[1]
+			if (inRange && matched != 1) || (!inRange && matched != 0) {
+				t.Fatalf("range %d-%d: key %s matched %d prefixes", r[0], r[1], key, matched)
+			}
+		}
+
+		// Prefixes are listed in order
+		for i := 1; i < len(prefixes); i++ {
+			if prefixes[i-1] >= prefixes[i] {
+				t.Fatalf("range %d-%d: prefixes are not in order: %v", r[0], r[1], prefixes)
+			}
+		}
+	}
+}
+
+func TestKeyPrefixesFullWidth(t *testing.T) {
+
+	// Timestamps in nanoseconds up to the end of int64
+	prefixes := keyPrefixes(1600000000000000000, 1<<63-1, auditKeyWidth)
+	if len(prefixes) == 0 || len(prefixes) > 20*9 {
+		t.Fatalf("unexpected number of prefixes: %d", len(prefixes))
+	}
+
+	if prefixes[0] != "016" {
+		t.Errorf("first prefix = %s, want 016", prefixes[0])
+	}
+}
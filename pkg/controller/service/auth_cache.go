@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	authenticator "github.com/BrobridgeOrg/gravity-sdk/authenticator"
+)
+
+type authCacheEntry struct {
+	key       string
+	appID     string
+	entity    *authenticator.Entity
+	err       error
+	expiresAt time.Time
+}
+
+// AuthCache keeps results of authentication by appID and token hash, failures
+// are cached as well for a shorter period. Least recently used entries are
+// evicted when cache is full.
+type AuthCache struct {
+	ttl         time.Duration
+	negativeTTL time.Duration
+	size        int
+	entries     map[string]*list.Element
+	lru         *list.List
+	mutex       sync.Mutex
+}
+
+func NewAuthCache(size int, ttl time.Duration, negativeTTL time.Duration) *AuthCache {
+	return &AuthCache{
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		size:        size,
+		entries:     make(map[string]*list.Element),
+		lru:         list.New(),
+	}
+}
+
+func authCacheKey(appID string, token []byte) string {
+	hash := sha256.Sum256(token)
+	return appID + "/" + hex.EncodeToString(hash[:])
+}
+
+// SetOptions changes limits and purges all entries
+func (ac *AuthCache) SetOptions(size int, ttl time.Duration, negativeTTL time.Duration) {
+
+	ac.mutex.Lock()
+	defer ac.mutex.Unlock()
+
+	ac.size = size
+	ac.ttl = ttl
+	ac.negativeTTL = negativeTTL
+	ac.entries = make(map[string]*list.Element)
+	ac.lru.Init()
+}
+
+// Get returns cached result and error of authentication, ok is false if nothing was cached
+func (ac *AuthCache) Get(appID string, token []byte) (entity *authenticator.Entity, ok bool, err error) {
+
+	ac.mutex.Lock()
+	defer ac.mutex.Unlock()
+
+	key := authCacheKey(appID, token)
+	elem, found := ac.entries[key]
+	if !found {
+		return nil, false, nil
+	}
+
+	entry := elem.Value.(*authCacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		ac.remove(elem)
+		return nil, false, nil
+	}
+
+	ac.lru.MoveToFront(elem)
+
+	return entry.entity, true, entry.err
+}
+
+func (ac *AuthCache) Put(appID string, token []byte, entity *authenticator.Entity, err error) {
+
+	ac.mutex.Lock()
+	defer ac.mutex.Unlock()
+
+	ttl := ac.ttl
+	if err != nil {
+		ttl = ac.negativeTTL
+	}
+
+	if ttl <= 0 || ac.size <= 0 {
+		return
+	}
+
+	key := authCacheKey(appID, token)
+	if elem, ok := ac.entries[key]; ok {
+		ac.remove(elem)
+	}
+
+	ac.entries[key] = ac.lru.PushFront(&authCacheEntry{
+		key:       key,
+		appID:     appID,
+		entity:    entity,
+		err:       err,
+		expiresAt: time.Now().Add(ttl),
+	})
+
+	for ac.lru.Len() > ac.size {
+		ac.remove(ac.lru.Back())
+	}
+}
+
+// Invalidate drops all results of app
+func (ac *AuthCache) Invalidate(appID string) {
+
+	ac.mutex.Lock()
+	defer ac.mutex.Unlock()
+
+	for elem := ac.lru.Front(); elem != nil; {
+		next := elem.Next()
+		if elem.Value.(*authCacheEntry).appID == appID {
+			ac.remove(elem)
+		}
+		elem = next
+	}
+}
+
+func (ac *AuthCache) Purge() {
+
+	ac.mutex.Lock()
+	defer ac.mutex.Unlock()
+
+	ac.entries = make(map[string]*list.Element)
+	ac.lru.Init()
+}
+
+func (ac *AuthCache) remove(elem *list.Element) {
+	entry := ac.lru.Remove(elem).(*authCacheEntry)
+	delete(ac.entries, entry.key)
+}
@@ -1,10 +1,13 @@
 package controller
 
 import (
+	"sync"
+	"time"
+
 	"github.com/BrobridgeOrg/broc"
+	"github.com/BrobridgeOrg/gravity-controller/pkg/config"
 	authenticator "github.com/BrobridgeOrg/gravity-sdk/authenticator"
 	"github.com/BrobridgeOrg/gravity-sdk/core/keyring"
-	"github.com/spf13/viper"
 )
 
 type Authentication struct {
@@ -12,8 +15,13 @@ type Authentication struct {
 	enabledAuthService bool
 	channel            string
 	accessKey          string
-	authenticator      *authenticator.Authenticator
+	remote             *authenticator.Authenticator
+	local              *LocalEntityStore
+	authenticator      EntityBackend
+	cache              *AuthCache
 	rpcEngine          *broc.Broc
+	jsonEngine         *broc.Broc
+	mutex              sync.RWMutex
 }
 
 func NewAuthentication() *Authentication {
@@ -24,23 +32,84 @@ func (auth *Authentication) Initialize(controller *Controller) error {
 
 	auth.controller = controller
 
-	viper.SetDefault("auth_service.enabled", false)
-	auth.enabledAuthService = viper.GetBool("auth_service.enabled")
-
 	// channel for authentication
-	auth.channel = viper.GetString("auth_service.channel")
+	auth.channel = controller.getConfig().AuthService.Channel
 
 	// Initializing authenticator
 	authOpts := authenticator.NewOptions()
 	authOpts.Domain = controller.domain
 	authOpts.Channel = auth.channel
-	authOpts.Key = keyring.NewKey("gravity", viper.GetString("auth_service.accessKey"))
-	auth.authenticator = authenticator.NewAuthenticatorWithClient(controller.gravityClient, authOpts)
+	authOpts.Key = keyring.NewKey("gravity", controller.getConfig().AuthService.AccessKey)
+	auth.remote = authenticator.NewAuthenticatorWithClient(controller.gravityClient, authOpts)
+
+	// Built-in entity store is used without authentication service
+	auth.local = NewLocalEntityStore(controller)
+	err := auth.local.Initialize()
+	if err != nil {
+		return err
+	}
+
+	auth.cache = NewAuthCache(0, 0, 0)
+	auth.SetCacheOptions(&controller.getConfig().AuthService)
+
+	auth.SetAuthServiceEnabled(controller.getConfig().AuthService.Enabled)
 
 	// Initializing RPC handler
 	return auth.InitializeRPC()
 }
 
+// SetAuthServiceEnabled switches entity backend between authentication service and built-in entity store
+func (auth *Authentication) SetAuthServiceEnabled(enabled bool) {
+
+	auth.mutex.Lock()
+	defer auth.mutex.Unlock()
+
+	auth.enabledAuthService = enabled
+
+	// Results came from another backend
+	auth.cache.Purge()
+
+	if enabled {
+		auth.authenticator = auth.remote
+		return
+	}
+
+	auth.authenticator = auth.local
+}
+
+func (auth *Authentication) getAuthenticator() EntityBackend {
+	auth.mutex.RLock()
+	defer auth.mutex.RUnlock()
+	return auth.authenticator
+}
+
+func (auth *Authentication) SetCacheOptions(authService *config.AuthServiceConfig) {
+	auth.cache.SetOptions(
+		authService.CacheSize,
+		time.Duration(authService.CacheTTL)*time.Second,
+		time.Duration(authService.NegativeCacheTTL)*time.Second,
+	)
+}
+
+// authenticate checks token of app with cached results first
+func (auth *Authentication) authenticate(appID string, token []byte) (*authenticator.Entity, error) {
+
+	entity, ok, err := auth.cache.Get(appID, token)
+	if ok {
+		return entity, err
+	}
+
+	entity, err = auth.getAuthenticator().Authenticate(appID, token)
+	auth.cache.Put(appID, token, entity, err)
+
+	return entity, err
+}
+
+// InvalidateCache drops cached results of app after entity was changed
+func (auth *Authentication) InvalidateCache(appID string) {
+	auth.cache.Invalidate(appID)
+}
+
 func (auth *Authentication) Authenticate(appID string, token []byte, allowAnonymous bool) *keyring.KeyInfo {
 
 	if allowAnonymous {
@@ -52,29 +121,24 @@ func (auth *Authentication) Authenticate(appID string, token []byte, allowAnonym
 		}
 	}
 
-	if auth.enabledAuthService {
-
-		// Authenticate application and token
-		entity, err := auth.authenticator.Authenticate(appID, token)
-		if err != nil {
-			return nil
-		}
-
-		// Add to keyring
-		key := auth.controller.keyring.Put(entity.AppID, entity.AccessKey)
+	// Authenticate application and token
+	entity, err := auth.authenticate(appID, token)
+	if err != nil {
+		return nil
+	}
 
-		// Load permissions
-		if v, ok := entity.Properties["permissions"]; ok {
-			key.Permission().AddPermissions(v.([]string))
-		}
+	// Add to keyring
+	key := auth.controller.keyring.Put(entity.AppID, entity.AccessKey)
 
-		// Load collection permissions
-		if v, ok := entity.Properties["collections"]; ok {
-			key.Collection().AddCollections(v.([]string))
-		}
+	// Load permissions
+	if v, ok := entity.Properties["permissions"]; ok {
+		key.Permission().AddPermissions(v.([]string))
+	}
 
-		return key
+	// Load collection permissions
+	if v, ok := entity.Properties["collections"]; ok {
+		key.Collection().AddCollections(v.([]string))
 	}
 
-	return nil
+	return key
 }
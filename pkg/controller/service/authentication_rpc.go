@@ -1,59 +1,113 @@
 package controller
 
 import (
+	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/BrobridgeOrg/broc"
 	packet_pb "github.com/BrobridgeOrg/gravity-api/packet"
 	auth_pb "github.com/BrobridgeOrg/gravity-api/service/auth"
-	"github.com/BrobridgeOrg/gravity-controller/pkg/controller/service/middleware"
 	authenticator "github.com/BrobridgeOrg/gravity-sdk/authenticator"
 	"github.com/golang/protobuf/proto"
 	log "github.com/sirupsen/logrus"
 )
 
+type FinalizeKeyRotationRequest struct {
+	AppID string `json:"appID"`
+}
+
+type FinalizeKeyRotationReply struct {
+	Success bool   `json:"success"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+type SearchEntitiesRequest struct {
+	Permission    string    `json:"permission"`
+	Collection    string    `json:"collection"`
+	NamePrefix    string    `json:"namePrefix"`
+	CreatedAfter  time.Time `json:"createdAfter"`
+	CreatedBefore time.Time `json:"createdBefore"`
+	SortBy        string    `json:"sortBy"`
+	Order         string    `json:"order"`
+	Cursor        string    `json:"cursor"`
+	Count         int       `json:"count"`
+}
+
+type SearchEntitiesReply struct {
+	Success    bool          `json:"success"`
+	Reason     string        `json:"reason,omitempty"`
+	Total      int           `json:"total"`
+	Entities   []*EntityInfo `json:"entities"`
+	NextCursor string        `json:"nextCursor,omitempty"`
+}
+
 func (auth *Authentication) InitializeRPC() error {
 
 	log.Info("Initializing RPC Handlers for AuthenticationManager")
 
 	// Initializing authentication middleware
-	m := middleware.NewMiddleware(map[string]interface{}{
-		"Authentication": &middleware.Authentication{
-			Enabled: true,
-			Keyring: auth.controller.keyring,
-		},
-	})
+	m := auth.controller.newMiddleware()
 
 	// Initializing RPC engine to handle requests
 	auth.rpcEngine = broc.NewBroc(auth.controller.gravityClient.GetConnection())
-	auth.rpcEngine.Use(auth.rpc_middleware)
 	auth.rpcEngine.Use(m.PacketHandler)
-	auth.rpcEngine.Use(m.RequiredAuth(
-		"SYSTEM",
-		"ADMIN",
-		"AUTHENTICATION_MANAGER_ADMIN",
-	))
-
 	auth.rpcEngine.SetPrefix(fmt.Sprintf("%s.authentication_manager.", auth.controller.domain))
 
-	// Register methods
-	auth.rpcEngine.Register("createEntity", auth.rpc_createEntity)
-	auth.rpcEngine.Register("updateEntity", auth.rpc_updateEntity)
-	auth.rpcEngine.Register("deleteEntity", auth.rpc_deleteEntity)
-	auth.rpcEngine.Register("getEntity", auth.rpc_getEntity)
-	auth.rpcEngine.Register("updateEntityKey", auth.rpc_updateEntityKey)
-	auth.rpcEngine.Register("getEntities", auth.rpc_getEntities)
-
-	return auth.rpcEngine.Apply()
-}
-
-func (auth *Authentication) rpc_middleware(ctx *broc.Context) (returnedValue interface{}, err error) {
+	// Methods which are not defined by gravity-api are encoded in JSON, they are
+	// served under a prefix of their own
+	auth.jsonEngine = broc.NewBroc(auth.controller.gravityClient.GetConnection())
+	auth.jsonEngine.Use(m.PacketHandler)
+	auth.jsonEngine.SetPrefix(fmt.Sprintf("%s.authentication_manager.json.", auth.controller.domain))
 
-	if !auth.enabledAuthService {
-		return nil, nil
+	// Register methods
+	auth.rpcEngine.Register("createEntity",
+		m.RequiredMethod("authentication_manager.createEntity"),
+		m.RateLimit("authentication_manager.createEntity"),
+		auth.rpc_createEntity,
+	)
+	auth.rpcEngine.Register("updateEntity",
+		m.RequiredMethod("authentication_manager.updateEntity"),
+		m.RateLimit("authentication_manager.updateEntity"),
+		auth.rpc_updateEntity,
+	)
+	auth.rpcEngine.Register("deleteEntity",
+		m.RequiredMethod("authentication_manager.deleteEntity"),
+		m.RateLimit("authentication_manager.deleteEntity"),
+		auth.rpc_deleteEntity,
+	)
+	auth.rpcEngine.Register("getEntity",
+		m.RequiredMethod("authentication_manager.getEntity"),
+		m.RateLimit("authentication_manager.getEntity"),
+		auth.rpc_getEntity,
+	)
+	auth.rpcEngine.Register("updateEntityKey",
+		m.RequiredMethod("authentication_manager.updateEntityKey"),
+		m.RateLimit("authentication_manager.updateEntityKey"),
+		auth.rpc_updateEntityKey,
+	)
+	auth.rpcEngine.Register("getEntities",
+		m.RequiredMethod("authentication_manager.getEntities"),
+		m.RateLimit("authentication_manager.getEntities"),
+		auth.rpc_getEntities,
+	)
+	auth.jsonEngine.Register("searchEntities",
+		m.RequiredMethod("authentication_manager.searchEntities"),
+		m.RateLimit("authentication_manager.searchEntities"),
+		auth.rpc_searchEntities,
+	)
+	auth.jsonEngine.Register("finalizeKeyRotation",
+		m.RequiredMethod("authentication_manager.finalizeKeyRotation"),
+		m.RateLimit("authentication_manager.finalizeKeyRotation"),
+		auth.rpc_finalizeKeyRotation,
+	)
+
+	err := auth.rpcEngine.Apply()
+	if err != nil {
+		return err
 	}
 
-	return ctx.Next()
+	return auth.jsonEngine.Apply()
 }
 
 func (auth *Authentication) rpc_createEntity(ctx *broc.Context) (returnedValue interface{}, err error) {
@@ -68,8 +122,14 @@ func (auth *Authentication) rpc_createEntity(ctx *broc.Context) (returnedValue i
 		err = e
 	}()
 
-	// Parsing request data
 	var req auth_pb.CreateEntityRequest
+
+	// Audit trail
+	defer func() {
+		auth.controller.audit.RecordContext(ctx, "authentication_manager.createEntity", req.Entity.GetAppID(), reply.Success, reply.Reason)
+	}()
+
+	// Parsing request data
 	payload := ctx.Get("payload").(*packet_pb.Payload)
 	err = proto.Unmarshal(payload.Data, &req)
 	if err != nil {
@@ -90,7 +150,7 @@ func (auth *Authentication) rpc_createEntity(ctx *broc.Context) (returnedValue i
 		return
 	}
 
-	err = auth.authenticator.CreateEntity(entity)
+	err = auth.getAuthenticator().CreateEntity(entity)
 	if err != nil {
 		log.Error(err)
 
@@ -114,8 +174,14 @@ func (auth *Authentication) rpc_updateEntity(ctx *broc.Context) (returnedValue i
 		err = e
 	}()
 
-	// Parsing request data
 	var req auth_pb.UpdateEntityRequest
+
+	// Audit trail
+	defer func() {
+		auth.controller.audit.RecordContext(ctx, "authentication_manager.updateEntity", req.Entity.GetAppID(), reply.Success, reply.Reason)
+	}()
+
+	// Parsing request data
 	payload := ctx.Get("payload").(*packet_pb.Payload)
 	err = proto.Unmarshal(payload.Data, &req)
 	if err != nil {
@@ -136,7 +202,7 @@ func (auth *Authentication) rpc_updateEntity(ctx *broc.Context) (returnedValue i
 		return
 	}
 
-	err = auth.authenticator.UpdateEntity(entity)
+	err = auth.getAuthenticator().UpdateEntity(entity)
 	if err != nil {
 		log.Error(err)
 
@@ -145,6 +211,9 @@ func (auth *Authentication) rpc_updateEntity(ctx *broc.Context) (returnedValue i
 		return
 	}
 
+	// Cached results are out of date
+	auth.InvalidateCache(entity.AppID)
+
 	return
 }
 
@@ -160,8 +229,14 @@ func (auth *Authentication) rpc_deleteEntity(ctx *broc.Context) (returnedValue i
 		err = e
 	}()
 
-	// Parsing request data
 	var req auth_pb.DeleteEntityRequest
+
+	// Audit trail
+	defer func() {
+		auth.controller.audit.RecordContext(ctx, "authentication_manager.deleteEntity", req.AppID, reply.Success, reply.Reason)
+	}()
+
+	// Parsing request data
 	payload := ctx.Get("payload").(*packet_pb.Payload)
 	err = proto.Unmarshal(payload.Data, &req)
 	if err != nil {
@@ -172,7 +247,7 @@ func (auth *Authentication) rpc_deleteEntity(ctx *broc.Context) (returnedValue i
 		return
 	}
 
-	err = auth.authenticator.DeleteEntity(req.AppID)
+	err = auth.getAuthenticator().DeleteEntity(req.AppID)
 	if err != nil {
 		log.Error(err)
 
@@ -181,6 +256,15 @@ func (auth *Authentication) rpc_deleteEntity(ctx *broc.Context) (returnedValue i
 		return
 	}
 
+	// Cached results are out of date
+	auth.InvalidateCache(req.AppID)
+
+	// Revoke access cluster-wide
+	err = auth.controller.RevokeKey(req.AppID)
+	if err != nil {
+		log.Error(err)
+	}
+
 	return
 }
 
@@ -208,7 +292,7 @@ func (auth *Authentication) rpc_getEntity(ctx *broc.Context) (returnedValue inte
 		return
 	}
 
-	entity, err := auth.authenticator.GetEntity(req.AppID)
+	entity, err := auth.getAuthenticator().GetEntity(req.AppID)
 	if err != nil {
 		log.Error(err)
 
@@ -234,8 +318,14 @@ func (auth *Authentication) rpc_updateEntityKey(ctx *broc.Context) (returnedValu
 		err = e
 	}()
 
-	// Parsing request data
 	var req auth_pb.UpdateEntityKeyRequest
+
+	// Audit trail
+	defer func() {
+		auth.controller.audit.RecordContext(ctx, "authentication_manager.updateEntityKey", req.AppID, reply.Success, reply.Reason)
+	}()
+
+	// Parsing request data
 	payload := ctx.Get("payload").(*packet_pb.Payload)
 	err = proto.Unmarshal(payload.Data, &req)
 	if err != nil {
@@ -246,7 +336,72 @@ func (auth *Authentication) rpc_updateEntityKey(ctx *broc.Context) (returnedValu
 		return
 	}
 
-	err = auth.authenticator.UpdateEntityKey(req.AppID, req.Key)
+	err = auth.getAuthenticator().UpdateEntityKey(req.AppID, req.Key)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = err.Error()
+		return
+	}
+
+	// Cached results are out of date
+	auth.InvalidateCache(req.AppID)
+
+	// Previous key is still valid during grace period
+	err = auth.controller.keyRotation.Rotate(req.AppID, string(req.Key))
+	if err == ErrKeyNotLoaded {
+		// Nothing to rotate, new key is loaded on next authentication
+		log.WithFields(log.Fields{
+			"appID": req.AppID,
+		}).Info("Key was not loaded, skipped rotation")
+
+		err = nil
+		return
+	}
+
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = err.Error()
+		return
+	}
+
+	return
+}
+
+func (auth *Authentication) rpc_finalizeKeyRotation(ctx *broc.Context) (returnedValue interface{}, err error) {
+
+	// Reply
+	reply := FinalizeKeyRotationReply{
+		Success: true,
+	}
+	defer func() {
+		data, e := json.Marshal(&reply)
+		returnedValue = data
+		err = e
+	}()
+
+	var req FinalizeKeyRotationRequest
+
+	// Audit trail
+	defer func() {
+		auth.controller.audit.RecordContext(ctx, "authentication_manager.finalizeKeyRotation", req.AppID, reply.Success, reply.Reason)
+	}()
+
+	// Parsing request data
+	payload := ctx.Get("payload").(*packet_pb.Payload)
+	err = json.Unmarshal(payload.Data, &req)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = "UnknownParameter"
+		return
+	}
+
+	err = auth.controller.keyRotation.Finalize(req.AppID)
 	if err != nil {
 		log.Error(err)
 
@@ -282,7 +437,7 @@ func (auth *Authentication) rpc_getEntities(ctx *broc.Context) (returnedValue in
 		return
 	}
 
-	entities, total, err := auth.authenticator.GetEntities(req.StartID, req.Count)
+	entities, total, err := auth.getAuthenticator().GetEntities(req.StartID, req.Count)
 	if err != nil {
 		log.Error(err)
 
@@ -300,3 +455,53 @@ func (auth *Authentication) rpc_getEntities(ctx *broc.Context) (returnedValue in
 
 	return
 }
+
+func (auth *Authentication) rpc_searchEntities(ctx *broc.Context) (returnedValue interface{}, err error) {
+
+	// Reply
+	reply := SearchEntitiesReply{
+		Success: true,
+	}
+	defer func() {
+		data, e := json.Marshal(&reply)
+		returnedValue = data
+		err = e
+	}()
+
+	// Parsing request data
+	var req SearchEntitiesRequest
+	payload := ctx.Get("payload").(*packet_pb.Payload)
+	err = json.Unmarshal(payload.Data, &req)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = "UnknownParameter"
+		return
+	}
+
+	entities, total, nextCursor, err := auth.SearchEntities(&EntityQuery{
+		Permission:    req.Permission,
+		Collection:    req.Collection,
+		NamePrefix:    req.NamePrefix,
+		CreatedAfter:  req.CreatedAfter,
+		CreatedBefore: req.CreatedBefore,
+		SortBy:        req.SortBy,
+		Descending:    req.Order == "desc",
+		Cursor:        req.Cursor,
+		Count:         req.Count,
+	})
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = err.Error()
+		return
+	}
+
+	reply.Total = total
+	reply.Entities = entities
+	reply.NextCursor = nextCursor
+
+	return
+}
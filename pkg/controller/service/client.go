@@ -2,36 +2,27 @@ package controller
 
 import (
 	"fmt"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/BrobridgeOrg/gravity-sdk/core"
+	"github.com/nats-io/nats.go"
 	log "github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
-)
-
-const (
-	DefaultPingInterval        = 10
-	DefaultMaxPingsOutstanding = 3
-	DefaultMaxReconnects       = -1
 )
 
 func (controller *Controller) initializeClient() error {
 
-	// default settings
-	viper.SetDefault("gravity.domain", "gravity")
-	viper.SetDefault("gravity.accessKey", "")
-	viper.SetDefault("gravity.pingInterval", DefaultPingInterval)
-	viper.SetDefault("gravity.maxPingsOutstanding", DefaultMaxPingsOutstanding)
-	viper.SetDefault("gravity.maxReconnects", DefaultMaxReconnects)
-
 	// Read configs
-	domain := viper.GetString("gravity.domain")
-	accessKey := viper.GetString("gravity.accessKey")
-	host := viper.GetString("gravity.host")
-	port := viper.GetInt("gravity.port")
-	pingInterval := viper.GetInt64("gravity.pingInterval")
-	maxPingsOutstanding := viper.GetInt("gravity.maxPingsOutstanding")
-	maxReconnects := viper.GetInt("gravity.maxReconnects")
+	gravityConfig := controller.getConfig().Gravity
+	domain := gravityConfig.Domain
+	accessKey := gravityConfig.AccessKey
+	host := gravityConfig.Host
+	port := gravityConfig.Port
+	servers := gravityConfig.Servers
+	pingInterval := gravityConfig.PingInterval
+	maxPingsOutstanding := gravityConfig.MaxPingsOutstanding
+	maxReconnects := gravityConfig.MaxReconnects
 
 	// Preparing options
 	options := core.NewOptions()
@@ -39,13 +30,25 @@ func (controller *Controller) initializeClient() error {
 	options.MaxPingsOutstanding = maxPingsOutstanding
 	options.MaxReconnects = maxReconnects
 
+	natsOptions, err := controller.getSecurityOptions()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidConnectionOptions, err)
+	}
+
+	options.NatsOptions = natsOptions
+
+	// Seed servers take precedence over single host
 	address := fmt.Sprintf("%s:%d", host, port)
+	if len(servers) > 0 {
+		address = strings.Join(servers, ",")
+	}
 
 	log.WithFields(log.Fields{
 		"address":             address,
 		"pingInterval":        options.PingInterval,
 		"maxPingsOutstanding": options.MaxPingsOutstanding,
 		"maxReconnects":       options.MaxReconnects,
+		"tls":                 gravityConfig.EnabledTLS(),
 	}).Info("Connecting to gravity...")
 
 	controller.domain = domain
@@ -57,3 +60,57 @@ func (controller *Controller) initializeClient() error {
 	// Connect
 	return controller.gravityClient.Connect(address, options)
 }
+
+func (controller *Controller) getSecurityOptions() ([]nats.Option, error) {
+
+	gravityConfig := controller.getConfig().Gravity
+	opts := make([]nats.Option, 0)
+
+	// Files are loaded while connecting, missing ones would be retried forever
+	files := []string{
+		gravityConfig.TLS.CAFile,
+		gravityConfig.TLS.CertFile,
+		gravityConfig.TLS.KeyFile,
+		gravityConfig.Credentials,
+	}
+
+	for _, file := range files {
+		if len(file) == 0 {
+			continue
+		}
+
+		_, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// TLS
+	if len(gravityConfig.TLS.CAFile) > 0 {
+		opts = append(opts, nats.RootCAs(gravityConfig.TLS.CAFile))
+	}
+
+	if len(gravityConfig.TLS.CertFile) > 0 {
+		opts = append(opts, nats.ClientCert(gravityConfig.TLS.CertFile, gravityConfig.TLS.KeyFile))
+	}
+
+	// Credentials
+	if len(gravityConfig.Credentials) > 0 {
+		opts = append(opts, nats.UserCredentials(gravityConfig.Credentials))
+	}
+
+	if len(gravityConfig.NKeySeed) > 0 {
+		opt, err := nats.NkeyOptionFromSeed(gravityConfig.NKeySeed)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, opt)
+	}
+
+	if len(gravityConfig.Token) > 0 {
+		opts = append(opts, nats.Token(gravityConfig.Token))
+	}
+
+	return opts, nil
+}
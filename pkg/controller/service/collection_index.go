@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"sort"
+	"sync"
+)
+
+// CollectionIndex is a reverse index from collections to subscribers which
+// consume them and adapters which produce them.
+type CollectionIndex struct {
+	subscribers        map[string]map[string]bool
+	adapters           map[string]map[string]bool
+	adapterCollections map[string][]string
+	mutex              sync.RWMutex
+}
+
+// CollectionRefs are IDs of subscribers and adapters which reference a collection
+type CollectionRefs struct {
+	Subscribers []string
+	Adapters    []string
+}
+
+func NewCollectionIndex() *CollectionIndex {
+	return &CollectionIndex{
+		subscribers:        make(map[string]map[string]bool),
+		adapters:           make(map[string]map[string]bool),
+		adapterCollections: make(map[string][]string),
+	}
+}
+
+func addRef(index map[string]map[string]bool, collectionID string, id string) {
+
+	refs, ok := index[collectionID]
+	if !ok {
+		refs = make(map[string]bool)
+		index[collectionID] = refs
+	}
+
+	refs[id] = true
+}
+
+func removeRef(index map[string]map[string]bool, collectionID string, id string) {
+
+	refs, ok := index[collectionID]
+	if !ok {
+		return
+	}
+
+	delete(refs, id)
+	if len(refs) == 0 {
+		delete(index, collectionID)
+	}
+}
+
+func sortedRefs(refs map[string]bool) []string {
+
+	ids := make([]string, 0, len(refs))
+	for id, _ := range refs {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	return ids
+}
+
+func (ci *CollectionIndex) AddSubscriber(subscriberID string, collections []string) {
+
+	ci.mutex.Lock()
+	defer ci.mutex.Unlock()
+
+	for _, col := range collections {
+		addRef(ci.subscribers, col, subscriberID)
+	}
+}
+
+func (ci *CollectionIndex) RemoveSubscriber(subscriberID string, collections []string) {
+
+	ci.mutex.Lock()
+	defer ci.mutex.Unlock()
+
+	for _, col := range collections {
+		removeRef(ci.subscribers, col, subscriberID)
+	}
+}
+
+// SetAdapter replaces collections which are produced by adapter, adapter is removed from index if collections is empty
+func (ci *CollectionIndex) SetAdapter(adapterID string, collections []string) {
+
+	ci.mutex.Lock()
+	defer ci.mutex.Unlock()
+
+	for _, col := range ci.adapterCollections[adapterID] {
+		removeRef(ci.adapters, col, adapterID)
+	}
+
+	if len(collections) == 0 {
+		delete(ci.adapterCollections, adapterID)
+		return
+	}
+
+	ci.adapterCollections[adapterID] = append([]string{}, collections...)
+	for _, col := range collections {
+		addRef(ci.adapters, col, adapterID)
+	}
+}
+
+// GetRefs returns subscribers and adapters of collection in order
+func (ci *CollectionIndex) GetRefs(collectionID string) *CollectionRefs {
+
+	ci.mutex.RLock()
+	defer ci.mutex.RUnlock()
+
+	return &CollectionRefs{
+		Subscribers: sortedRefs(ci.subscribers[collectionID]),
+		Adapters:    sortedRefs(ci.adapters[collectionID]),
+	}
+}
+
+// Snapshot returns references of all collections which are referenced
+func (ci *CollectionIndex) Snapshot() map[string]*CollectionRefs {
+
+	ci.mutex.RLock()
+	defer ci.mutex.RUnlock()
+
+	results := make(map[string]*CollectionRefs)
+	for col, refs := range ci.subscribers {
+		results[col] = &CollectionRefs{
+			Subscribers: sortedRefs(refs),
+			Adapters:    make([]string, 0),
+		}
+	}
+
+	for col, refs := range ci.adapters {
+		r, ok := results[col]
+		if !ok {
+			r = &CollectionRefs{
+				Subscribers: make([]string, 0),
+			}
+			results[col] = r
+		}
+
+		r.Adapters = sortedRefs(refs)
+	}
+
+	return results
+}
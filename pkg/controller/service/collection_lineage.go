@@ -0,0 +1,222 @@
+package controller
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/BrobridgeOrg/gravity-controller/pkg/controller/service/middleware"
+	"github.com/BrobridgeOrg/gravity-sdk/core/keyring"
+)
+
+const (
+	LineageFormatJSON = "json"
+	LineageFormatDOT  = "dot"
+)
+
+var (
+	ErrInvalidLineageFormat = errors.New("InvalidLineageFormat")
+)
+
+type SubscriberConsumer struct {
+	SubscriberID string `json:"subscriberID"`
+	Name         string `json:"name"`
+	Component    string `json:"component"`
+	AppID        string `json:"appID,omitempty"`
+}
+
+type AdapterProducer struct {
+	AdapterID string `json:"adapterID"`
+	Name      string `json:"name"`
+	Component string `json:"component"`
+}
+
+// CollectionConsumers are subscribers which consume collection and adapters which produce it
+type CollectionConsumers struct {
+	CollectionID string                `json:"collectionID"`
+	Subscribers  []*SubscriberConsumer `json:"subscribers"`
+	Adapters     []*AdapterProducer    `json:"adapters"`
+}
+
+type LineageNode struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	Name      string `json:"name"`
+	Component string `json:"component,omitempty"`
+}
+
+type LineageEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// LineageGraph shows data flows from adapters through collections to subscribers
+type LineageGraph struct {
+	Nodes []*LineageNode `json:"nodes"`
+	Edges []*LineageEdge `json:"edges"`
+}
+
+// GetConsumers returns consumers and producers of collection from reverse index
+func (cm *CollectionManager) GetConsumers(collectionID string) *CollectionConsumers {
+
+	consumers := &CollectionConsumers{
+		CollectionID: collectionID,
+		Subscribers:  make([]*SubscriberConsumer, 0),
+		Adapters:     make([]*AdapterProducer, 0),
+	}
+
+	for _, subscriber := range cm.controller.subscriberManager.GetCollectionSubscribers(collectionID) {
+
+		appID, _ := subscriber.properties["auth.appID"].(string)
+
+		consumers.Subscribers = append(consumers.Subscribers, &SubscriberConsumer{
+			SubscriberID: subscriber.id,
+			Name:         subscriber.name,
+			Component:    subscriber.component,
+			AppID:        appID,
+		})
+	}
+
+	for _, adapter := range cm.controller.adapterManager.GetCollectionAdapters(collectionID) {
+		consumers.Adapters = append(consumers.Adapters, &AdapterProducer{
+			AdapterID: adapter.id,
+			Name:      adapter.name,
+			Component: adapter.component,
+		})
+	}
+
+	return consumers
+}
+
+// GetLineage builds lineage graph of collections which are accessible by key,
+// all collections are included if key is not specified. Collections which are
+// referenced but not registered are included as well.
+func (cm *CollectionManager) GetLineage(key *keyring.KeyInfo) (*LineageGraph, error) {
+
+	collections, err := cm.GetCollections()
+	if err != nil {
+		return nil, err
+	}
+
+	refs := cm.controller.collectionIndex.Snapshot()
+
+	names := make(map[string]string)
+	for _, collection := range collections {
+		names[collection.ID] = collection.Name
+	}
+
+	for col, _ := range refs {
+		if _, ok := names[col]; !ok {
+			names[col] = col
+		}
+	}
+
+	ids := make([]string, 0, len(names))
+	for col, _ := range names {
+		if key != nil && !middleware.CheckCollection(key, col) {
+			continue
+		}
+
+		ids = append(ids, col)
+	}
+
+	sort.Strings(ids)
+
+	graph := &LineageGraph{
+		Nodes: make([]*LineageNode, 0),
+		Edges: make([]*LineageEdge, 0),
+	}
+
+	added := make(map[string]bool)
+	addNode := func(node *LineageNode) {
+		if added[node.ID] {
+			return
+		}
+
+		added[node.ID] = true
+		graph.Nodes = append(graph.Nodes, node)
+	}
+
+	for _, col := range ids {
+
+		colNode := "collection:" + col
+		addNode(&LineageNode{
+			ID:   colNode,
+			Type: "collection",
+			Name: names[col],
+		})
+
+		r, ok := refs[col]
+		if !ok {
+			continue
+		}
+
+		for _, adapterID := range r.Adapters {
+			node := &LineageNode{
+				ID:   "adapter:" + adapterID,
+				Type: "adapter",
+				Name: adapterID,
+			}
+
+			if adapter := cm.controller.adapterManager.GetAdapter(adapterID); adapter != nil {
+				node.Name = adapter.name
+				node.Component = adapter.component
+			}
+
+			addNode(node)
+			graph.Edges = append(graph.Edges, &LineageEdge{
+				From: node.ID,
+				To:   colNode,
+			})
+		}
+
+		for _, subscriberID := range r.Subscribers {
+			node := &LineageNode{
+				ID:   "subscriber:" + subscriberID,
+				Type: "subscriber",
+				Name: subscriberID,
+			}
+
+			if subscriber := cm.controller.subscriberManager.GetSubscriber(subscriberID); subscriber != nil {
+				node.Name = subscriber.name
+				node.Component = subscriber.component
+			}
+
+			addNode(node)
+			graph.Edges = append(graph.Edges, &LineageEdge{
+				From: colNode,
+				To:   node.ID,
+			})
+		}
+	}
+
+	return graph, nil
+}
+
+// DOT renders graph in Graphviz format
+func (graph *LineageGraph) DOT() string {
+
+	shapes := map[string]string{
+		"adapter":    "box",
+		"collection": "cylinder",
+		"subscriber": "ellipse",
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("digraph lineage {\n")
+	buf.WriteString("\trankdir=LR;\n")
+
+	for _, node := range graph.Nodes {
+		fmt.Fprintf(&buf, "\t%s [label=%s, shape=%s];\n", strconv.Quote(node.ID), strconv.Quote(node.Name), shapes[node.Type])
+	}
+
+	for _, edge := range graph.Edges {
+		fmt.Fprintf(&buf, "\t%s -> %s;\n", strconv.Quote(edge.From), strconv.Quote(edge.To))
+	}
+
+	buf.WriteString("}\n")
+
+	return buf.String()
+}
@@ -1,6 +1,10 @@
 package controller
 
 import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/BrobridgeOrg/broc"
@@ -8,14 +12,50 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+var (
+	ErrCollectionInUse = errors.New("CollectionInUse")
+)
+
 type CollectionManager struct {
 	controller *Controller
+	schemas    *SchemaRegistry
 	rpcEngine  *broc.Broc
+	jsonEngine *broc.Broc
+	mutex      sync.RWMutex
+}
+
+// CollectionInfo is collection with metadata
+type CollectionInfo struct {
+	CollectionID string            `json:"collectionID"`
+	Name         string            `json:"name"`
+	Desc         string            `json:"desc"`
+	Metadata     map[string]string `json:"metadata"`
+	Labels       map[string]string `json:"labels"`
+	CreatedAt    time.Time         `json:"createdAt"`
+	UpdatedAt    time.Time         `json:"updatedAt"`
+}
+
+// CollectionDependents are components which still use collection
+type CollectionDependents struct {
+	Subscribers []string `json:"subscribers"`
+	Adapters    []string `json:"adapters"`
+}
+
+func (deps *CollectionDependents) IsEmpty() bool {
+	return len(deps.Subscribers) == 0 && len(deps.Adapters) == 0
+}
+
+// CollectionPatch changes fields which are specified only, metadata entry is removed if its value is null
+type CollectionPatch struct {
+	Name     *string            `json:"name"`
+	Desc     *string            `json:"desc"`
+	Metadata map[string]*string `json:"metadata"`
 }
 
 func NewCollectionManager(controller *Controller) *CollectionManager {
 	return &CollectionManager{
 		controller: controller,
+		schemas:    NewSchemaRegistry(controller),
 	}
 }
 
@@ -26,9 +66,14 @@ func (cm *CollectionManager) Initialize() error {
 		return err
 	}
 
-	err = store.RegisterColumns([]string{"collections"})
+	err = store.RegisterColumns([]string{"collections", "metadata", "labels"})
 	if err != nil {
-		return nil
+		return err
+	}
+
+	err = cm.schemas.Initialize()
+	if err != nil {
+		return err
 	}
 
 	// Initializing RPC
@@ -57,20 +102,219 @@ func (cm *CollectionManager) Register(collectionID string, collection *types.Col
 	if len(data) == 0 {
 		collection.CreatedAt = time.Now()
 		err := store.Put("collections", []byte(collectionID), collection.ToBytes())
-		log.Info("Registered collection: %s", collection.ID)
-		return err
+		if err != nil {
+			return err
+		}
+
+		log.Infof("Registered collection: %s", collection.ID)
+
+		cm.controller.events.PublishCollection(EventCollectionRegistered, collectionID)
+
+		return nil
 	}
 
 	return nil
 }
 
+// RegisterSchema registers collection with schema, a new schema version is
+// created if schema was changed and it is compatible with the latest version.
+// Compatibility mode of collection is changed first if it was specified.
+func (cm *CollectionManager) RegisterSchema(collectionID string, collection *types.Collection, schema *CollectionSchema, compatibility string) (int, bool, error) {
+
+	err := schema.validate()
+	if err != nil {
+		return 0, false, err
+	}
+
+	if len(compatibility) > 0 {
+		err := cm.schemas.SetCompatibility(collectionID, compatibility)
+		if err != nil {
+			return 0, false, err
+		}
+	}
+
+	version, created, err := cm.schemas.Register(collectionID, schema)
+	if err != nil {
+		if e, ok := err.(*SchemaCompatibilityError); ok {
+			log.WithFields(log.Fields{
+				"collection":    collectionID,
+				"compatibility": e.Compatibility,
+			}).Warnf("Rejected incompatible schema: %s", FormatSchemaChanges(e.Changes))
+		}
+
+		return 0, false, err
+	}
+
+	err = cm.Register(collectionID, collection)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if created && version > 1 {
+		cm.controller.events.PublishCollection(EventCollectionSchemaUpdated, collectionID)
+	}
+
+	return version, created, nil
+}
+
+// GetDependents returns subscribers and adapters which reference collection
+func (cm *CollectionManager) GetDependents(collectionID string) *CollectionDependents {
+
+	deps := &CollectionDependents{
+		Subscribers: make([]string, 0),
+		Adapters:    make([]string, 0),
+	}
+
+	for _, subscriber := range cm.controller.subscriberManager.GetCollectionSubscribers(collectionID) {
+		deps.Subscribers = append(deps.Subscribers, subscriber.id)
+	}
+
+	for _, adapter := range cm.controller.adapterManager.GetCollectionAdapters(collectionID) {
+		deps.Adapters = append(deps.Adapters, adapter.id)
+	}
+
+	sort.Strings(deps.Subscribers)
+	sort.Strings(deps.Adapters)
+
+	return deps
+}
+
+// Reference runs fn while collections cannot be unregistered, references to
+// collections are added in fn so SafeUnregister is not able to miss them.
+func (cm *CollectionManager) Reference(fn func() error) error {
+
+	cm.mutex.RLock()
+	defer cm.mutex.RUnlock()
+
+	return fn()
+}
+
+// SafeUnregister refuses to unregister collection which is still in use and
+// returns its dependents. With force, all subscribers are unsubscribed from
+// collection on every synchronizer and adapters drop their references. If any
+// of subscribers failed, collection is kept and the returned dependents are the
+// ones which still reference it, so that it can be retried.
+func (cm *CollectionManager) SafeUnregister(collectionID string, force bool) (*CollectionDependents, error) {
+
+	cm.mutex.Lock()
+
+	deps, err := cm.releaseDependents(collectionID, force)
+	if err != nil {
+		cm.mutex.Unlock()
+		return deps, err
+	}
+
+	err = cm.unregister(collectionID)
+
+	cm.mutex.Unlock()
+
+	if err != nil {
+		return deps, err
+	}
+
+	cm.controller.events.PublishCollection(EventCollectionUnregistered, collectionID)
+
+	return deps, nil
+}
+
+func (cm *CollectionManager) releaseDependents(collectionID string, force bool) (*CollectionDependents, error) {
+
+	deps := cm.GetDependents(collectionID)
+	if deps.IsEmpty() {
+		return deps, nil
+	}
+
+	if !force {
+		log.WithFields(log.Fields{
+			"collection":  collectionID,
+			"subscribers": deps.Subscribers,
+			"adapters":    deps.Adapters,
+		}).Warn("Refused to unregister collection which is in use")
+
+		return deps, ErrCollectionInUse
+	}
+
+	remaining := &CollectionDependents{
+		Subscribers: make([]string, 0),
+		Adapters:    deps.Adapters,
+	}
+
+	var lastErr error
+	for _, subscriberID := range deps.Subscribers {
+		subscriber := cm.controller.subscriberManager.GetSubscriber(subscriberID)
+		if subscriber == nil {
+			continue
+		}
+
+		_, err := subscriber.UnsubscribeFromCollections([]string{collectionID})
+		if err != nil {
+			// Subscription is still on some synchronizers
+			subscriber.addCollections([]string{collectionID})
+			remaining.Subscribers = append(remaining.Subscribers, subscriberID)
+			lastErr = err
+		}
+	}
+
+	if lastErr != nil {
+		log.WithFields(log.Fields{
+			"collection":  collectionID,
+			"subscribers": remaining.Subscribers,
+		}).Error("Failed to unsubscribe from collection which is going to be unregistered")
+
+		return remaining, lastErr
+	}
+
+	cm.controller.adapterManager.RemoveCollection(collectionID)
+
+	log.WithFields(log.Fields{
+		"collection":  collectionID,
+		"subscribers": deps.Subscribers,
+		"adapters":    deps.Adapters,
+	}).Warn("Forced to unregister collection which is in use")
+
+	return deps, nil
+}
+
+// Unregister deletes collection without checking whether it is in use
 func (cm *CollectionManager) Unregister(collectionID string) error {
 
+	cm.mutex.Lock()
+	err := cm.unregister(collectionID)
+	cm.mutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	cm.controller.events.PublishCollection(EventCollectionUnregistered, collectionID)
+
+	return nil
+}
+
+// unregister deletes records which belong to collection before collection
+// itself, so nothing is left behind if it fails midway.
+func (cm *CollectionManager) unregister(collectionID string) error {
+
 	store, err := cm.controller.store.GetEngine().GetStore("gravity_collection_manager")
 	if err != nil {
 		return err
 	}
 
+	err = cm.schemas.Delete(collectionID)
+	if err != nil {
+		return err
+	}
+
+	err = store.Delete("metadata", []byte(collectionID))
+	if err != nil {
+		return err
+	}
+
+	err = store.Delete("labels", []byte(collectionID))
+	if err != nil {
+		return err
+	}
+
 	return store.Delete("collections", []byte(collectionID))
 }
 
@@ -82,6 +326,13 @@ func (cm *CollectionManager) GetCollection(collectionID string) (*types.Collecti
 	}
 
 	data, err := store.GetBytes("collections", []byte(collectionID))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		return nil, ErrCollectionNotFound
+	}
 
 	return types.Unmarshal(data)
 }
@@ -111,3 +362,302 @@ func (cm *CollectionManager) GetCollections() ([]*types.Collection, error) {
 
 	return collections, err
 }
+
+// GetMetadata returns metadata of collection
+func (cm *CollectionManager) GetMetadata(collectionID string) (map[string]string, error) {
+
+	store, err := cm.controller.store.GetEngine().GetStore("gravity_collection_manager")
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := store.GetBytes("metadata", []byte(collectionID))
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := make(map[string]string)
+	if len(data) == 0 {
+		return metadata, nil
+	}
+
+	err = json.Unmarshal(data, &metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	return metadata, nil
+}
+
+func (cm *CollectionManager) save(collectionID string, collection *types.Collection, metadata map[string]string) error {
+
+	store, err := cm.controller.store.GetEngine().GetStore("gravity_collection_manager")
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+
+	err = store.Put("metadata", []byte(collectionID), data)
+	if err != nil {
+		return err
+	}
+
+	return store.Put("collections", []byte(collectionID), collection.ToBytes())
+}
+
+// GetCollectionInfo returns collection with metadata
+func (cm *CollectionManager) GetCollectionInfo(collectionID string) (*CollectionInfo, error) {
+
+	collection, err := cm.GetCollection(collectionID)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := cm.GetMetadata(collectionID)
+	if err != nil {
+		return nil, err
+	}
+
+	labels, err := cm.GetLabels(collectionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CollectionInfo{
+		CollectionID: collectionID,
+		Name:         collection.Name,
+		Desc:         collection.Desc,
+		Metadata:     metadata,
+		Labels:       labels,
+		CreatedAt:    collection.CreatedAt,
+		UpdatedAt:    collection.UpdatedAt,
+	}, nil
+}
+
+// modify applies changes to collection in place and notifies subscribers of collection
+func (cm *CollectionManager) modify(collectionID string, fn func(collection *types.Collection, metadata map[string]string) map[string]string) (*CollectionInfo, error) {
+
+	info, err := cm.apply(collectionID, fn)
+	if err != nil {
+		return nil, err
+	}
+
+	log.WithFields(log.Fields{
+		"collection": collectionID,
+	}).Info("Updated collection")
+
+	cm.controller.events.PublishCollection(EventCollectionUpdated, collectionID)
+	cm.controller.events.NotifySubscribers(EventCollectionUpdated, collectionID, cm.controller.subscriberManager.GetCollectionSubscribers(collectionID))
+
+	return info, nil
+}
+
+// apply changes collection under lock, events are published by caller after lock is released
+func (cm *CollectionManager) apply(collectionID string, fn func(collection *types.Collection, metadata map[string]string) map[string]string) (*CollectionInfo, error) {
+
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	collection, err := cm.GetCollection(collectionID)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := cm.GetMetadata(collectionID)
+	if err != nil {
+		return nil, err
+	}
+
+	labels, err := cm.GetLabels(collectionID)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata = fn(collection, metadata)
+	collection.UpdatedAt = time.Now()
+
+	err = cm.save(collectionID, collection, metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CollectionInfo{
+		CollectionID: collectionID,
+		Name:         collection.Name,
+		Desc:         collection.Desc,
+		Metadata:     metadata,
+		Labels:       labels,
+		CreatedAt:    collection.CreatedAt,
+		UpdatedAt:    collection.UpdatedAt,
+	}, nil
+}
+
+// UpdateCollection replaces name, description and metadata of collection
+func (cm *CollectionManager) UpdateCollection(collectionID string, name string, desc string, metadata map[string]string) (*CollectionInfo, error) {
+
+	return cm.modify(collectionID, func(collection *types.Collection, _ map[string]string) map[string]string {
+
+		collection.Name = name
+		collection.Desc = desc
+
+		if metadata == nil {
+			return make(map[string]string)
+		}
+
+		return metadata
+	})
+}
+
+// PatchCollection changes specified fields of collection only
+func (cm *CollectionManager) PatchCollection(collectionID string, patch *CollectionPatch) (*CollectionInfo, error) {
+
+	return cm.modify(collectionID, func(collection *types.Collection, metadata map[string]string) map[string]string {
+
+		if patch.Name != nil {
+			collection.Name = *patch.Name
+		}
+
+		if patch.Desc != nil {
+			collection.Desc = *patch.Desc
+		}
+
+		for key, value := range patch.Metadata {
+			if value == nil {
+				delete(metadata, key)
+				continue
+			}
+
+			metadata[key] = *value
+		}
+
+		return metadata
+	})
+}
+
+// listMetadata returns metadata of all collections
+func (cm *CollectionManager) listMetadata() (map[string]map[string]string, error) {
+
+	store, err := cm.controller.store.GetEngine().GetStore("gravity_collection_manager")
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[string]map[string]string)
+	err = store.List("metadata", []byte(""), func(key []byte, value []byte) bool {
+
+		metadata := make(map[string]string)
+		err := json.Unmarshal(value, &metadata)
+		if err != nil {
+			log.Errorf("Unrecognized collection metadata: %s", string(key))
+			return true
+		}
+
+		results[string(key)] = metadata
+
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// GetLabels returns labels of collection
+func (cm *CollectionManager) GetLabels(collectionID string) (map[string]string, error) {
+
+	store, err := cm.controller.store.GetEngine().GetStore("gravity_collection_manager")
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := store.GetBytes("labels", []byte(collectionID))
+	if err != nil {
+		return nil, err
+	}
+
+	labels := make(map[string]string)
+	if len(data) == 0 {
+		return labels, nil
+	}
+
+	err = json.Unmarshal(data, &labels)
+	if err != nil {
+		return nil, err
+	}
+
+	return labels, nil
+}
+
+// SetLabels changes labels of collection and returns the result
+func (cm *CollectionManager) SetLabels(collectionID string, changes map[string]*string) (map[string]string, error) {
+
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	// Make sure collection exists
+	_, err := cm.GetCollection(collectionID)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := cm.GetLabels(collectionID)
+	if err != nil {
+		return nil, err
+	}
+
+	labels, err := PatchLabels(current, changes)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := cm.controller.store.GetEngine().GetStore("gravity_collection_manager")
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(labels)
+	if err != nil {
+		return nil, err
+	}
+
+	err = store.Put("labels", []byte(collectionID), data)
+	if err != nil {
+		return nil, err
+	}
+
+	return labels, nil
+}
+
+// listLabels returns labels of all collections
+func (cm *CollectionManager) listLabels() (map[string]map[string]string, error) {
+
+	store, err := cm.controller.store.GetEngine().GetStore("gravity_collection_manager")
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[string]map[string]string)
+	err = store.List("labels", []byte(""), func(key []byte, value []byte) bool {
+
+		labels := make(map[string]string)
+		err := json.Unmarshal(value, &labels)
+		if err != nil {
+			log.Errorf("Unrecognized collection labels: %s", string(key))
+			return true
+		}
+
+		results[string(key)] = labels
+
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
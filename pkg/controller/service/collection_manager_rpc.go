@@ -1,47 +1,238 @@
 package controller
 
 import (
+	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/BrobridgeOrg/broc"
 	packet_pb "github.com/BrobridgeOrg/gravity-api/packet"
 	collection_manager_pb "github.com/BrobridgeOrg/gravity-api/service/collection_manager"
 	"github.com/BrobridgeOrg/gravity-controller/pkg/controller/service/middleware"
 	"github.com/BrobridgeOrg/gravity-sdk/collection_manager/types"
+	"github.com/BrobridgeOrg/gravity-sdk/core/keyring"
 	"github.com/golang/protobuf/proto"
 	log "github.com/sirupsen/logrus"
 )
 
+type RegisterSchemaRequest struct {
+	CollectionID  string            `json:"collectionID"`
+	Name          string            `json:"name"`
+	Desc          string            `json:"desc"`
+	Compatibility string            `json:"compatibility"`
+	Schema        *CollectionSchema `json:"schema"`
+}
+
+type RegisterSchemaReply struct {
+	Success bool            `json:"success"`
+	Reason  string          `json:"reason,omitempty"`
+	Version int             `json:"version,omitempty"`
+	Created bool            `json:"created"`
+	Changes []*SchemaChange `json:"changes,omitempty"`
+}
+
+type GetCollectionVersionRequest struct {
+	CollectionID string `json:"collectionID"`
+	Version      int    `json:"version"`
+}
+
+type CollectionVersionInfo struct {
+	CollectionID  string            `json:"collectionID"`
+	Name          string            `json:"name"`
+	Desc          string            `json:"desc"`
+	Metadata      map[string]string `json:"metadata"`
+	Compatibility string            `json:"compatibility"`
+	Version       int               `json:"version"`
+	Schema        *CollectionSchema `json:"schema"`
+	CreatedAt     time.Time         `json:"createdAt"`
+	UpdatedAt     time.Time         `json:"updatedAt"`
+}
+
+type GetCollectionVersionReply struct {
+	Success    bool                   `json:"success"`
+	Reason     string                 `json:"reason,omitempty"`
+	Collection *CollectionVersionInfo `json:"collection,omitempty"`
+}
+
+type GetSchemaVersionsRequest struct {
+	CollectionID string `json:"collectionID"`
+}
+
+type GetSchemaVersionsReply struct {
+	Success       bool             `json:"success"`
+	Reason        string           `json:"reason,omitempty"`
+	Compatibility string           `json:"compatibility,omitempty"`
+	Versions      []*SchemaVersion `json:"versions"`
+}
+
+type UpdateCollectionRequest struct {
+	CollectionID string            `json:"collectionID"`
+	Name         string            `json:"name"`
+	Desc         string            `json:"desc"`
+	Metadata     map[string]string `json:"metadata"`
+}
+
+type PatchCollectionRequest struct {
+	CollectionID string `json:"collectionID"`
+	CollectionPatch
+}
+
+type UpdateCollectionReply struct {
+	Success    bool            `json:"success"`
+	Reason     string          `json:"reason,omitempty"`
+	Collection *CollectionInfo `json:"collection,omitempty"`
+}
+
+type UnregisterCollectionRequest struct {
+	CollectionID string `json:"collectionID"`
+	Force        bool   `json:"force"`
+}
+
+type UnregisterCollectionReply struct {
+	Success    bool                  `json:"success"`
+	Reason     string                `json:"reason,omitempty"`
+	Dependents *CollectionDependents `json:"dependents,omitempty"`
+}
+
+type SearchCollectionsRequest struct {
+	NamePrefix    string            `json:"namePrefix"`
+	Metadata      map[string]string `json:"metadata"`
+	Selector      string            `json:"selector"`
+	Adapter       string            `json:"adapter"`
+	CreatedAfter  time.Time         `json:"createdAfter"`
+	CreatedBefore time.Time         `json:"createdBefore"`
+	SortBy        string            `json:"sortBy"`
+	Order         string            `json:"order"`
+	Cursor        string            `json:"cursor"`
+	Count         int               `json:"count"`
+}
+
+type SearchCollectionsReply struct {
+	Success     bool              `json:"success"`
+	Reason      string            `json:"reason,omitempty"`
+	Total       int               `json:"total"`
+	Collections []*CollectionInfo `json:"collections"`
+	NextCursor  string            `json:"nextCursor,omitempty"`
+}
+
+type GetCollectionConsumersRequest struct {
+	CollectionID string `json:"collectionID"`
+}
+
+type GetCollectionConsumersReply struct {
+	Success   bool                 `json:"success"`
+	Reason    string               `json:"reason,omitempty"`
+	Consumers *CollectionConsumers `json:"consumers,omitempty"`
+}
+
+type GetLineageRequest struct {
+	Format string `json:"format"`
+}
+
+type GetLineageReply struct {
+	Success bool          `json:"success"`
+	Reason  string        `json:"reason,omitempty"`
+	Format  string        `json:"format,omitempty"`
+	Graph   *LineageGraph `json:"graph,omitempty"`
+	DOT     string        `json:"dot,omitempty"`
+}
+
 func (cm *CollectionManager) initializeRPC() error {
 
 	log.Info("Initializing RPC Handlers for CollectionManager")
 
 	// Initializing authentication middleware
-	m := middleware.NewMiddleware(map[string]interface{}{
-		"Authentication": &middleware.Authentication{
-			Enabled: true,
-			Keyring: cm.controller.keyring,
-		},
-	})
+	m := cm.controller.newMiddleware()
 
 	// Initializing RPC engine to handle requests
 	cm.rpcEngine = broc.NewBroc(cm.controller.gravityClient.GetConnection())
 	cm.rpcEngine.Use(m.PacketHandler)
 	cm.rpcEngine.SetPrefix(fmt.Sprintf("%s.collection_manager.", cm.controller.domain))
 
+	// Methods which are not defined by gravity-api are encoded in JSON, they are
+	// served under a prefix of their own
+	cm.jsonEngine = broc.NewBroc(cm.controller.gravityClient.GetConnection())
+	cm.jsonEngine.Use(m.PacketHandler)
+	cm.jsonEngine.SetPrefix(fmt.Sprintf("%s.collection_manager.json.", cm.controller.domain))
+
 	// Register methods
-	cm.rpcEngine.Register("register", m.RequiredAuth("SYSTEM"), cm.rpc_register)
-	cm.rpcEngine.Register("unregister", m.RequiredAuth("SYSTEM"), cm.rpc_unregister)
+	cm.rpcEngine.Register("register",
+		m.RequiredMethod("collection_manager.register"),
+		m.RateLimit("collection_manager.register"),
+		cm.rpc_register,
+	)
+	cm.rpcEngine.Register("unregister",
+		m.RequiredMethod("collection_manager.unregister"),
+		m.RateLimit("collection_manager.unregister"),
+		cm.rpc_unregister,
+	)
+	cm.jsonEngine.Register("unregisterCollection",
+		m.RequiredMethod("collection_manager.unregisterCollection"),
+		m.RateLimit("collection_manager.unregisterCollection"),
+		cm.rpc_unregisterCollection,
+	)
 	cm.rpcEngine.Register("getCollection",
-		m.RequiredAuth("SYSTEM", "SUBSCRIBER"),
+		m.RequiredMethod("collection_manager.getCollection"),
+		m.RateLimit("collection_manager.getCollection"),
 		cm.rpc_getCollection,
 	)
 	cm.rpcEngine.Register("getCollections",
-		m.RequiredAuth("SYSTEM", "SUBSCRIBER"),
+		m.RequiredMethod("collection_manager.getCollections"),
+		m.RateLimit("collection_manager.getCollections"),
 		cm.rpc_getCollections,
 	)
+	cm.jsonEngine.Register("searchCollections",
+		m.RequiredMethod("collection_manager.searchCollections"),
+		m.RateLimit("collection_manager.searchCollections"),
+		cm.rpc_searchCollections,
+	)
+	cm.jsonEngine.Register("getCollectionConsumers",
+		m.RequiredMethod("collection_manager.getCollectionConsumers"),
+		m.RateLimit("collection_manager.getCollectionConsumers"),
+		cm.rpc_getCollectionConsumers,
+	)
+	cm.jsonEngine.Register("getLineage",
+		m.RequiredMethod("collection_manager.getLineage"),
+		m.RateLimit("collection_manager.getLineage"),
+		cm.rpc_getLineage,
+	)
+	cm.jsonEngine.Register("setCollectionLabels",
+		m.RequiredMethod("collection_manager.setCollectionLabels"),
+		m.RateLimit("collection_manager.setCollectionLabels"),
+		cm.rpc_setCollectionLabels,
+	)
+	cm.jsonEngine.Register("registerSchema",
+		m.RequiredMethod("collection_manager.registerSchema"),
+		m.RateLimit("collection_manager.registerSchema"),
+		cm.rpc_registerSchema,
+	)
+	cm.jsonEngine.Register("getCollectionVersion",
+		m.RequiredMethod("collection_manager.getCollectionVersion"),
+		m.RateLimit("collection_manager.getCollectionVersion"),
+		cm.rpc_getCollectionVersion,
+	)
+	cm.jsonEngine.Register("getSchemaVersions",
+		m.RequiredMethod("collection_manager.getSchemaVersions"),
+		m.RateLimit("collection_manager.getSchemaVersions"),
+		cm.rpc_getSchemaVersions,
+	)
+	cm.jsonEngine.Register("updateCollection",
+		m.RequiredMethod("collection_manager.updateCollection"),
+		m.RateLimit("collection_manager.updateCollection"),
+		cm.rpc_updateCollection,
+	)
+	cm.jsonEngine.Register("patchCollection",
+		m.RequiredMethod("collection_manager.patchCollection"),
+		m.RateLimit("collection_manager.patchCollection"),
+		cm.rpc_patchCollection,
+	)
 
-	return cm.rpcEngine.Apply()
+	err := cm.rpcEngine.Apply()
+	if err != nil {
+		return err
+	}
+
+	return cm.jsonEngine.Apply()
 }
 
 func (cm *CollectionManager) rpc_register(ctx *broc.Context) (returnedValue interface{}, err error) {
@@ -56,8 +247,14 @@ func (cm *CollectionManager) rpc_register(ctx *broc.Context) (returnedValue inte
 		err = e
 	}()
 
-	// Parsing request data
 	var req collection_manager_pb.RegisterRequest
+
+	// Audit trail
+	defer func() {
+		cm.controller.audit.RecordContext(ctx, "collection_manager.register", req.Collection.GetCollectionID(), reply.Success, reply.Reason)
+	}()
+
+	// Parsing request data
 	payload := ctx.Get("payload").(*packet_pb.Payload)
 	err = proto.Unmarshal(payload.Data, &req)
 	if err != nil {
@@ -96,8 +293,14 @@ func (cm *CollectionManager) rpc_unregister(ctx *broc.Context) (returnedValue in
 		err = e
 	}()
 
-	// Parsing request data
 	var req collection_manager_pb.UnregisterRequest
+
+	// Audit trail
+	defer func() {
+		cm.controller.audit.RecordContext(ctx, "collection_manager.unregister", req.CollectionID, reply.Success, reply.Reason)
+	}()
+
+	// Parsing request data
 	payload := ctx.Get("payload").(*packet_pb.Payload)
 	err = proto.Unmarshal(payload.Data, &req)
 	if err != nil {
@@ -108,8 +311,54 @@ func (cm *CollectionManager) rpc_unregister(ctx *broc.Context) (returnedValue in
 		return
 	}
 
-	// Unregister collection on all synchronizer nodes
-	err = cm.Unregister(req.CollectionID)
+	// Collection which is still in use is unable to be unregistered
+	_, err = cm.SafeUnregister(req.CollectionID, false)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = err.Error()
+		return
+	}
+
+	return
+}
+
+func (cm *CollectionManager) rpc_unregisterCollection(ctx *broc.Context) (returnedValue interface{}, err error) {
+
+	// Reply
+	reply := UnregisterCollectionReply{
+		Success: true,
+	}
+	defer func() {
+		data, e := json.Marshal(&reply)
+		returnedValue = data
+		err = e
+	}()
+
+	var req UnregisterCollectionRequest
+
+	// Audit trail
+	defer func() {
+		cm.controller.audit.RecordContext(ctx, "collection_manager.unregisterCollection", req.CollectionID, reply.Success, reply.Reason)
+	}()
+
+	// Parsing request data
+	payload := ctx.Get("payload").(*packet_pb.Payload)
+	err = json.Unmarshal(payload.Data, &req)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = "UnknownParameter"
+		return
+	}
+
+	deps, err := cm.SafeUnregister(req.CollectionID, req.Force)
+	if !deps.IsEmpty() {
+		reply.Dependents = deps
+	}
+
 	if err != nil {
 		log.Error(err)
 
@@ -145,6 +394,19 @@ func (cm *CollectionManager) rpc_getCollection(ctx *broc.Context) (returnedValue
 		return
 	}
 
+	// Check collection permission
+	key := ctx.Get("key").(*keyring.KeyInfo)
+	if !middleware.CheckCollection(key, req.CollectionID) {
+		log.WithFields(log.Fields{
+			"appID":      key.GetAppID(),
+			"collection": req.CollectionID,
+		}).Warn("Forbidden to access collection")
+
+		reply.Success = false
+		reply.Reason = "Forbidden"
+		return
+	}
+
 	// Gettting collection list
 	collection, err := cm.GetCollection(req.CollectionID)
 	if err != nil {
@@ -194,13 +456,485 @@ func (cm *CollectionManager) rpc_getCollections(ctx *broc.Context) (returnedValu
 		return
 	}
 
-	// Preparing results
-	collections := make([]*collection_manager_pb.Collection, len(results))
-	for i, collection := range results {
-		collections[i] = types.MarshalProto(collection)
+	// Preparing results with collections which are allowed to access
+	key := ctx.Get("key").(*keyring.KeyInfo)
+	collections := make([]*collection_manager_pb.Collection, 0, len(results))
+	for _, collection := range results {
+		if !middleware.CheckCollection(key, collection.ID) {
+			continue
+		}
+
+		collections = append(collections, types.MarshalProto(collection))
+	}
+
+	reply.Collections = collections
+
+	return
+}
+
+func (cm *CollectionManager) rpc_searchCollections(ctx *broc.Context) (returnedValue interface{}, err error) {
+
+	// Reply
+	reply := SearchCollectionsReply{
+		Success: true,
+	}
+	defer func() {
+		data, e := json.Marshal(&reply)
+		returnedValue = data
+		err = e
+	}()
+
+	// Parsing request data
+	var req SearchCollectionsRequest
+	payload := ctx.Get("payload").(*packet_pb.Payload)
+	err = json.Unmarshal(payload.Data, &req)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = "UnknownParameter"
+		return
+	}
+
+	// Only collections which are allowed to access
+	key := ctx.Get("key").(*keyring.KeyInfo)
+	collections, total, nextCursor, err := cm.SearchCollections(&CollectionQuery{
+		NamePrefix:    req.NamePrefix,
+		Metadata:      req.Metadata,
+		Selector:      req.Selector,
+		Adapter:       req.Adapter,
+		CreatedAfter:  req.CreatedAfter,
+		CreatedBefore: req.CreatedBefore,
+		SortBy:        req.SortBy,
+		Descending:    req.Order == "desc",
+		Cursor:        req.Cursor,
+		Count:         req.Count,
+	}, key)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = err.Error()
+		return
 	}
 
+	reply.Total = total
 	reply.Collections = collections
+	reply.NextCursor = nextCursor
+
+	return
+}
+
+func (cm *CollectionManager) rpc_registerSchema(ctx *broc.Context) (returnedValue interface{}, err error) {
+
+	// Reply
+	reply := RegisterSchemaReply{
+		Success: true,
+	}
+	defer func() {
+		data, e := json.Marshal(&reply)
+		returnedValue = data
+		err = e
+	}()
+
+	var req RegisterSchemaRequest
+
+	// Audit trail
+	defer func() {
+		cm.controller.audit.RecordContext(ctx, "collection_manager.registerSchema", req.CollectionID, reply.Success, reply.Reason)
+	}()
+
+	// Parsing request data
+	payload := ctx.Get("payload").(*packet_pb.Payload)
+	err = json.Unmarshal(payload.Data, &req)
+	if err != nil || len(req.CollectionID) == 0 {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = "UnknownParameter"
+		return
+	}
+
+	collection := &types.Collection{
+		ID:   req.CollectionID,
+		Name: req.Name,
+		Desc: req.Desc,
+	}
+
+	version, created, err := cm.RegisterSchema(req.CollectionID, collection, req.Schema, req.Compatibility)
+	if err != nil {
+		reply.Success = false
+		reply.Reason = err.Error()
+
+		if e, ok := err.(*SchemaCompatibilityError); ok {
+			reply.Changes = e.Changes
+			return
+		}
+
+		log.Error(err)
+		return
+	}
+
+	reply.Version = version
+	reply.Created = created
+
+	return
+}
+
+func (cm *CollectionManager) rpc_getCollectionVersion(ctx *broc.Context) (returnedValue interface{}, err error) {
+
+	// Reply
+	reply := GetCollectionVersionReply{
+		Success: true,
+	}
+	defer func() {
+		data, e := json.Marshal(&reply)
+		returnedValue = data
+		err = e
+	}()
+
+	// Parsing request data
+	var req GetCollectionVersionRequest
+	payload := ctx.Get("payload").(*packet_pb.Payload)
+	err = json.Unmarshal(payload.Data, &req)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = "UnknownParameter"
+		return
+	}
+
+	// Check collection permission
+	key := ctx.Get("key").(*keyring.KeyInfo)
+	if !middleware.CheckCollection(key, req.CollectionID) {
+		log.WithFields(log.Fields{
+			"appID":      key.GetAppID(),
+			"collection": req.CollectionID,
+		}).Warn("Forbidden to access collection")
+
+		reply.Success = false
+		reply.Reason = "Forbidden"
+		return
+	}
+
+	collection, err := cm.GetCollectionInfo(req.CollectionID)
+	if err != nil {
+		reply.Success = false
+		reply.Reason = err.Error()
+		return
+	}
+
+	compatibility, err := cm.schemas.GetCompatibility(req.CollectionID)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = err.Error()
+		return
+	}
+
+	// Latest version is returned if version is not specified
+	sv, err := cm.schemas.GetVersion(req.CollectionID, req.Version)
+	if err != nil {
+		reply.Success = false
+		reply.Reason = err.Error()
+		return
+	}
+
+	reply.Collection = &CollectionVersionInfo{
+		CollectionID:  req.CollectionID,
+		Name:          collection.Name,
+		Desc:          collection.Desc,
+		Metadata:      collection.Metadata,
+		Compatibility: compatibility,
+		Version:       sv.Version,
+		Schema:        sv.Schema,
+		CreatedAt:     collection.CreatedAt,
+		UpdatedAt:     collection.UpdatedAt,
+	}
+
+	return
+}
+
+func (cm *CollectionManager) rpc_getSchemaVersions(ctx *broc.Context) (returnedValue interface{}, err error) {
+
+	// Reply
+	reply := GetSchemaVersionsReply{
+		Success: true,
+	}
+	defer func() {
+		data, e := json.Marshal(&reply)
+		returnedValue = data
+		err = e
+	}()
+
+	// Parsing request data
+	var req GetSchemaVersionsRequest
+	payload := ctx.Get("payload").(*packet_pb.Payload)
+	err = json.Unmarshal(payload.Data, &req)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = "UnknownParameter"
+		return
+	}
+
+	// Check collection permission
+	key := ctx.Get("key").(*keyring.KeyInfo)
+	if !middleware.CheckCollection(key, req.CollectionID) {
+		reply.Success = false
+		reply.Reason = "Forbidden"
+		return
+	}
+
+	compatibility, err := cm.schemas.GetCompatibility(req.CollectionID)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = err.Error()
+		return
+	}
+
+	versions, err := cm.schemas.GetVersions(req.CollectionID)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = err.Error()
+		return
+	}
+
+	reply.Compatibility = compatibility
+	reply.Versions = versions
+
+	return
+}
+
+func (cm *CollectionManager) rpc_updateCollection(ctx *broc.Context) (returnedValue interface{}, err error) {
+
+	// Reply
+	reply := UpdateCollectionReply{
+		Success: true,
+	}
+	defer func() {
+		data, e := json.Marshal(&reply)
+		returnedValue = data
+		err = e
+	}()
+
+	var req UpdateCollectionRequest
+
+	// Audit trail
+	defer func() {
+		cm.controller.audit.RecordContext(ctx, "collection_manager.updateCollection", req.CollectionID, reply.Success, reply.Reason)
+	}()
+
+	// Parsing request data
+	payload := ctx.Get("payload").(*packet_pb.Payload)
+	err = json.Unmarshal(payload.Data, &req)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = "UnknownParameter"
+		return
+	}
+
+	collection, err := cm.UpdateCollection(req.CollectionID, req.Name, req.Desc, req.Metadata)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = err.Error()
+		return
+	}
+
+	reply.Collection = collection
+
+	return
+}
+
+func (cm *CollectionManager) rpc_patchCollection(ctx *broc.Context) (returnedValue interface{}, err error) {
+
+	// Reply
+	reply := UpdateCollectionReply{
+		Success: true,
+	}
+	defer func() {
+		data, e := json.Marshal(&reply)
+		returnedValue = data
+		err = e
+	}()
+
+	var req PatchCollectionRequest
+
+	// Audit trail
+	defer func() {
+		cm.controller.audit.RecordContext(ctx, "collection_manager.patchCollection", req.CollectionID, reply.Success, reply.Reason)
+	}()
+
+	// Parsing request data
+	payload := ctx.Get("payload").(*packet_pb.Payload)
+	err = json.Unmarshal(payload.Data, &req)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = "UnknownParameter"
+		return
+	}
+
+	collection, err := cm.PatchCollection(req.CollectionID, &req.CollectionPatch)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = err.Error()
+		return
+	}
+
+	reply.Collection = collection
+
+	return
+}
+
+func (cm *CollectionManager) rpc_getCollectionConsumers(ctx *broc.Context) (returnedValue interface{}, err error) {
+
+	// Reply
+	reply := GetCollectionConsumersReply{
+		Success: true,
+	}
+	defer func() {
+		data, e := json.Marshal(&reply)
+		returnedValue = data
+		err = e
+	}()
+
+	// Parsing request data
+	var req GetCollectionConsumersRequest
+	payload := ctx.Get("payload").(*packet_pb.Payload)
+	err = json.Unmarshal(payload.Data, &req)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = "UnknownParameter"
+		return
+	}
+
+	// Check collection permission
+	key := ctx.Get("key").(*keyring.KeyInfo)
+	if !middleware.CheckCollection(key, req.CollectionID) {
+		reply.Success = false
+		reply.Reason = "Forbidden"
+		return
+	}
+
+	reply.Consumers = cm.GetConsumers(req.CollectionID)
+
+	return
+}
+
+func (cm *CollectionManager) rpc_getLineage(ctx *broc.Context) (returnedValue interface{}, err error) {
+
+	// Reply
+	reply := GetLineageReply{
+		Success: true,
+	}
+	defer func() {
+		data, e := json.Marshal(&reply)
+		returnedValue = data
+		err = e
+	}()
+
+	// Parsing request data
+	var req GetLineageRequest
+	payload := ctx.Get("payload").(*packet_pb.Payload)
+	err = json.Unmarshal(payload.Data, &req)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = "UnknownParameter"
+		return
+	}
+
+	format := req.Format
+	if len(format) == 0 {
+		format = LineageFormatJSON
+	}
+
+	if format != LineageFormatJSON && format != LineageFormatDOT {
+		reply.Success = false
+		reply.Reason = ErrInvalidLineageFormat.Error()
+		return
+	}
+
+	// Only collections which are allowed to access
+	key := ctx.Get("key").(*keyring.KeyInfo)
+	graph, err := cm.GetLineage(key)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = err.Error()
+		return
+	}
+
+	reply.Format = format
+	if format == LineageFormatDOT {
+		reply.DOT = graph.DOT()
+		return
+	}
+
+	reply.Graph = graph
+
+	return
+}
+
+func (cm *CollectionManager) rpc_setCollectionLabels(ctx *broc.Context) (returnedValue interface{}, err error) {
+
+	// Reply
+	reply := SetLabelsReply{
+		Success: true,
+	}
+	defer func() {
+		data, e := json.Marshal(&reply)
+		returnedValue = data
+		err = e
+	}()
+
+	var req SetLabelsRequest
+
+	// Audit trail
+	defer func() {
+		cm.controller.audit.RecordContext(ctx, "collection_manager.setCollectionLabels", req.ID, reply.Success, reply.Reason)
+	}()
+
+	// Parsing request data
+	payload := ctx.Get("payload").(*packet_pb.Payload)
+	err = json.Unmarshal(payload.Data, &req)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = "UnknownParameter"
+		return
+	}
+
+	labels, err := cm.SetLabels(req.ID, req.Labels)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = err.Error()
+		return
+	}
+
+	reply.Labels = labels
 
 	return
 }
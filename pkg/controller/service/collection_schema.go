@@ -0,0 +1,516 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Compatibility modes of collection schema
+const (
+	CompatibilityNone     = "none"
+	CompatibilityBackward = "backward"
+	CompatibilityForward  = "forward"
+	CompatibilityFull     = "full"
+)
+
+const DefaultCompatibility = CompatibilityBackward
+
+var (
+	ErrInvalidSchema         = errors.New("InvalidSchema")
+	ErrInvalidCompatibility  = errors.New("InvalidCompatibility")
+	ErrIncompatibleSchema    = errors.New("IncompatibleSchema")
+	ErrSchemaVersionNotFound = errors.New("NotFoundSchemaVersion")
+	ErrCollectionNotFound    = errors.New("NotFoundCollection")
+)
+
+type SchemaField struct {
+	Name     string          `json:"name"`
+	Type     string          `json:"type"`
+	Required bool            `json:"required,omitempty"`
+	Default  json.RawMessage `json:"default,omitempty"`
+}
+
+type CollectionSchema struct {
+	Fields []*SchemaField `json:"fields"`
+}
+
+// SchemaVersion is a revision of collection schema
+type SchemaVersion struct {
+	CollectionID string            `json:"collectionID"`
+	Version      int               `json:"version"`
+	Schema       *CollectionSchema `json:"schema"`
+	CreatedAt    time.Time         `json:"createdAt"`
+}
+
+type schemaSettings struct {
+	Compatibility string `json:"compatibility"`
+	Latest        int    `json:"latest"`
+}
+
+// SchemaChange describes a difference between two schema versions
+type SchemaChange struct {
+	Field    string `json:"field"`
+	Change   string `json:"change"`
+	Previous string `json:"previous,omitempty"`
+	Current  string `json:"current,omitempty"`
+	Breaks   string `json:"breaks,omitempty"`
+}
+
+// SchemaCompatibilityError carries all changes which break compatibility
+type SchemaCompatibilityError struct {
+	Compatibility string
+	Changes       []*SchemaChange
+}
+
+func (e *SchemaCompatibilityError) Error() string {
+	return ErrIncompatibleSchema.Error()
+}
+
+func (e *SchemaCompatibilityError) Unwrap() error {
+	return ErrIncompatibleSchema
+}
+
+func isValidCompatibility(mode string) bool {
+	switch mode {
+	case CompatibilityNone, CompatibilityBackward, CompatibilityForward, CompatibilityFull:
+		return true
+	}
+
+	return false
+}
+
+func (schema *CollectionSchema) validate() error {
+
+	if schema == nil {
+		return ErrInvalidSchema
+	}
+
+	names := make(map[string]bool)
+	for _, field := range schema.Fields {
+		if field == nil || len(field.Name) == 0 || len(field.Type) == 0 || names[field.Name] {
+			return ErrInvalidSchema
+		}
+
+		names[field.Name] = true
+	}
+
+	return nil
+}
+
+func (schema *CollectionSchema) fieldMap() map[string]*SchemaField {
+
+	fields := make(map[string]*SchemaField)
+	for _, field := range schema.Fields {
+		fields[field.Name] = field
+	}
+
+	return fields
+}
+
+// hasDefault returns true if field is able to be filled when absent in data
+func (field *SchemaField) hasDefault() bool {
+	return !field.Required || len(field.Default) > 0
+}
+
+// Equal returns true if schemas have the same fields regardless of order
+func (schema *CollectionSchema) Equal(other *CollectionSchema) bool {
+	return len(DiffSchemas(schema, other)) == 0
+}
+
+// DiffSchemas compares two schemas field by field, every change is marked with
+// the compatibility direction it breaks.
+func DiffSchemas(previous *CollectionSchema, current *CollectionSchema) []*SchemaChange {
+
+	prevFields := previous.fieldMap()
+	curFields := current.fieldMap()
+
+	changes := make([]*SchemaChange, 0)
+
+	for name, cur := range curFields {
+		prev, ok := prevFields[name]
+		if !ok {
+			change := &SchemaChange{
+				Field:   name,
+				Change:  "added",
+				Current: cur.Type,
+			}
+
+			// Data written by old schema has no such field
+			if !cur.hasDefault() {
+				change.Breaks = CompatibilityBackward
+			}
+
+			changes = append(changes, change)
+			continue
+		}
+
+		if prev.Type != cur.Type {
+			changes = append(changes, &SchemaChange{
+				Field:    name,
+				Change:   "typeChanged",
+				Previous: prev.Type,
+				Current:  cur.Type,
+				Breaks:   CompatibilityFull,
+			})
+			continue
+		}
+
+		if prev.hasDefault() != cur.hasDefault() {
+			change := &SchemaChange{
+				Field:    name,
+				Change:   "requirementChanged",
+				Previous: fmt.Sprintf("required=%t", !prev.hasDefault()),
+				Current:  fmt.Sprintf("required=%t", !cur.hasDefault()),
+			}
+
+			if cur.hasDefault() {
+				// Data written by new schema may lack field required by old schema
+				change.Breaks = CompatibilityForward
+			} else {
+				change.Breaks = CompatibilityBackward
+			}
+
+			changes = append(changes, change)
+		}
+	}
+
+	for name, prev := range prevFields {
+		if _, ok := curFields[name]; ok {
+			continue
+		}
+
+		change := &SchemaChange{
+			Field:    name,
+			Change:   "removed",
+			Previous: prev.Type,
+		}
+
+		// Old schema is unable to read data without this field
+		if !prev.hasDefault() {
+			change.Breaks = CompatibilityForward
+		}
+
+		changes = append(changes, change)
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+
+	return changes
+}
+
+// CheckCompatibility returns changes which are not allowed in specific mode
+func CheckCompatibility(mode string, previous *CollectionSchema, current *CollectionSchema) []*SchemaChange {
+
+	violations := make([]*SchemaChange, 0)
+	if mode == CompatibilityNone {
+		return violations
+	}
+
+	for _, change := range DiffSchemas(previous, current) {
+		if len(change.Breaks) == 0 {
+			continue
+		}
+
+		if mode == CompatibilityFull || change.Breaks == CompatibilityFull || change.Breaks == mode {
+			violations = append(violations, change)
+		}
+	}
+
+	return violations
+}
+
+// SchemaRegistry keeps every schema version of collections
+type SchemaRegistry struct {
+	controller *Controller
+	mutex      sync.Mutex
+}
+
+func NewSchemaRegistry(controller *Controller) *SchemaRegistry {
+	return &SchemaRegistry{
+		controller: controller,
+	}
+}
+
+func (sr *SchemaRegistry) Initialize() error {
+
+	store, err := sr.controller.store.GetEngine().GetStore("gravity_collection_manager")
+	if err != nil {
+		return err
+	}
+
+	return store.RegisterColumns([]string{"schemas", "schema_settings"})
+}
+
+func schemaVersionKey(collectionID string, version int) []byte {
+	return []byte(fmt.Sprintf("%s/%010d", collectionID, version))
+}
+
+func (sr *SchemaRegistry) getSettings(collectionID string) (*schemaSettings, error) {
+
+	store, err := sr.controller.store.GetEngine().GetStore("gravity_collection_manager")
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := store.GetBytes("schema_settings", []byte(collectionID))
+	if err != nil {
+		return nil, err
+	}
+
+	settings := &schemaSettings{
+		Compatibility: DefaultCompatibility,
+	}
+
+	if len(data) == 0 {
+		return settings, nil
+	}
+
+	err = json.Unmarshal(data, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+func (sr *SchemaRegistry) putSettings(collectionID string, settings *schemaSettings) error {
+
+	store, err := sr.controller.store.GetEngine().GetStore("gravity_collection_manager")
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+
+	return store.Put("schema_settings", []byte(collectionID), data)
+}
+
+// GetCompatibility returns compatibility mode of collection
+func (sr *SchemaRegistry) GetCompatibility(collectionID string) (string, error) {
+
+	settings, err := sr.getSettings(collectionID)
+	if err != nil {
+		return "", err
+	}
+
+	return settings.Compatibility, nil
+}
+
+// SetCompatibility changes compatibility mode which is used for later versions of collection
+func (sr *SchemaRegistry) SetCompatibility(collectionID string, mode string) error {
+
+	if !isValidCompatibility(mode) {
+		return ErrInvalidCompatibility
+	}
+
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+
+	settings, err := sr.getSettings(collectionID)
+	if err != nil {
+		return err
+	}
+
+	settings.Compatibility = mode
+
+	return sr.putSettings(collectionID, settings)
+}
+
+// GetVersion returns specific schema version of collection, latest version is returned if version is zero
+func (sr *SchemaRegistry) GetVersion(collectionID string, version int) (*SchemaVersion, error) {
+
+	store, err := sr.controller.store.GetEngine().GetStore("gravity_collection_manager")
+	if err != nil {
+		return nil, err
+	}
+
+	if version <= 0 {
+		settings, err := sr.getSettings(collectionID)
+		if err != nil {
+			return nil, err
+		}
+
+		version = settings.Latest
+	}
+
+	data, err := store.GetBytes("schemas", schemaVersionKey(collectionID, version))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		return nil, ErrSchemaVersionNotFound
+	}
+
+	var sv SchemaVersion
+	err = json.Unmarshal(data, &sv)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sv, nil
+}
+
+// GetVersions returns all schema versions of collection in order
+func (sr *SchemaRegistry) GetVersions(collectionID string) ([]*SchemaVersion, error) {
+
+	store, err := sr.controller.store.GetEngine().GetStore("gravity_collection_manager")
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]*SchemaVersion, 0)
+	err = store.List("schemas", []byte(collectionID+"/"), func(key []byte, value []byte) bool {
+
+		var sv SchemaVersion
+		err := json.Unmarshal(value, &sv)
+		if err != nil {
+			log.Errorf("Unrecognized schema version: %s", string(key))
+			return true
+		}
+
+		versions = append(versions, &sv)
+
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+// Register adds schema as a new version of collection if it differs from the
+// latest one and passes compatibility check. It returns the version which
+// schema belongs to and whether a new version was created.
+func (sr *SchemaRegistry) Register(collectionID string, schema *CollectionSchema) (int, bool, error) {
+
+	err := schema.validate()
+	if err != nil {
+		return 0, false, err
+	}
+
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+
+	settings, err := sr.getSettings(collectionID)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if settings.Latest > 0 {
+		latest, err := sr.GetVersion(collectionID, settings.Latest)
+		if err != nil {
+			return 0, false, err
+		}
+
+		if latest.Schema.Equal(schema) {
+			return latest.Version, false, nil
+		}
+
+		violations := CheckCompatibility(settings.Compatibility, latest.Schema, schema)
+		if len(violations) > 0 {
+			return 0, false, &SchemaCompatibilityError{
+				Compatibility: settings.Compatibility,
+				Changes:       violations,
+			}
+		}
+	}
+
+	store, err := sr.controller.store.GetEngine().GetStore("gravity_collection_manager")
+	if err != nil {
+		return 0, false, err
+	}
+
+	sv := &SchemaVersion{
+		CollectionID: collectionID,
+		Version:      settings.Latest + 1,
+		Schema:       schema,
+		CreatedAt:    time.Now(),
+	}
+
+	data, err := json.Marshal(sv)
+	if err != nil {
+		return 0, false, err
+	}
+
+	err = store.Put("schemas", schemaVersionKey(collectionID, sv.Version), data)
+	if err != nil {
+		return 0, false, err
+	}
+
+	settings.Latest = sv.Version
+	err = sr.putSettings(collectionID, settings)
+	if err != nil {
+		return 0, false, err
+	}
+
+	log.WithFields(log.Fields{
+		"collection": collectionID,
+		"version":    sv.Version,
+	}).Info("Registered collection schema")
+
+	return sv.Version, true, nil
+}
+
+// Delete removes all schema versions and settings of collection
+func (sr *SchemaRegistry) Delete(collectionID string) error {
+
+	store, err := sr.controller.store.GetEngine().GetStore("gravity_collection_manager")
+	if err != nil {
+		return err
+	}
+
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+
+	keys := make([][]byte, 0)
+	err = store.List("schemas", []byte(collectionID+"/"), func(key []byte, value []byte) bool {
+		keys = append(keys, append([]byte{}, key...))
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		err := store.Delete("schemas", key)
+		if err != nil {
+			return err
+		}
+	}
+
+	return store.Delete("schema_settings", []byte(collectionID))
+}
+
+// FormatSchemaChanges renders changes in a readable form for logs
+func FormatSchemaChanges(changes []*SchemaChange) string {
+
+	lines := make([]string, 0, len(changes))
+	for _, change := range changes {
+		line := fmt.Sprintf("%s: %s", change.Field, change.Change)
+		if len(change.Previous) > 0 || len(change.Current) > 0 {
+			line += fmt.Sprintf(" (%s -> %s)", change.Previous, change.Current)
+		}
+
+		if len(change.Breaks) > 0 {
+			line += fmt.Sprintf(" breaks %s", change.Breaks)
+		}
+
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "; ")
+}
@@ -0,0 +1,208 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func newSchema(fields ...*SchemaField) *CollectionSchema {
+	return &CollectionSchema{
+		Fields: fields,
+	}
+}
+
+func optionalField(name string, fieldType string) *SchemaField {
+	return &SchemaField{Name: name, Type: fieldType}
+}
+
+func requiredField(name string, fieldType string) *SchemaField {
+	return &SchemaField{Name: name, Type: fieldType, Required: true}
+}
+
+func defaultField(name string, fieldType string, value string) *SchemaField {
+	return &SchemaField{Name: name, Type: fieldType, Required: true, Default: json.RawMessage(value)}
+}
+
+func TestDiffSchemas(t *testing.T) {
+
+	base := newSchema(requiredField("id", "int"), optionalField("name", "string"))
+
+	tests := []struct {
+		name     string
+		current  *CollectionSchema
+		expected []*SchemaChange
+	}{
+		{
+			"unchanged",
+			newSchema(optionalField("name", "string"), requiredField("id", "int")),
+			[]*SchemaChange{},
+		},
+		{
+			"optional field added",
+			newSchema(requiredField("id", "int"), optionalField("name", "string"), optionalField("email", "string")),
+			[]*SchemaChange{
+				{Field: "email", Change: "added", Current: "string"},
+			},
+		},
+		{
+			"required field added",
+			newSchema(requiredField("id", "int"), optionalField("name", "string"), requiredField("email", "string")),
+			[]*SchemaChange{
+				{Field: "email", Change: "added", Current: "string", Breaks: CompatibilityBackward},
+			},
+		},
+		{
+			"required field with default added",
+			newSchema(requiredField("id", "int"), optionalField("name", "string"), defaultField("email", "string", `""`)),
+			[]*SchemaChange{
+				{Field: "email", Change: "added", Current: "string"},
+			},
+		},
+		{
+			"optional field removed",
+			newSchema(requiredField("id", "int")),
+			[]*SchemaChange{
+				{Field: "name", Change: "removed", Previous: "string"},
+			},
+		},
+		{
+			"required field removed",
+			newSchema(optionalField("name", "string")),
+			[]*SchemaChange{
+				{Field: "id", Change: "removed", Previous: "int", Breaks: CompatibilityForward},
+			},
+		},
+		{
+			"type changed",
+			newSchema(requiredField("id", "string"), optionalField("name", "string")),
+			[]*SchemaChange{
+				{Field: "id", Change: "typeChanged", Previous: "int", Current: "string", Breaks: CompatibilityFull},
+			},
+		},
+		{
+			"field became required",
+			newSchema(requiredField("id", "int"), requiredField("name", "string")),
+			[]*SchemaChange{
+				{Field: "name", Change: "requirementChanged", Previous: "required=false", Current: "required=true", Breaks: CompatibilityBackward},
+			},
+		},
+		{
+			"field became optional",
+			newSchema(optionalField("id", "int"), optionalField("name", "string")),
+			[]*SchemaChange{
+				{Field: "id", Change: "requirementChanged", Previous: "required=true", Current: "required=false", Breaks: CompatibilityForward},
+			},
+		},
+		{
+			"default added to required field",
+			newSchema(defaultField("id", "int", "0"), optionalField("name", "string")),
+			[]*SchemaChange{
+				{Field: "id", Change: "requirementChanged", Previous: "required=true", Current: "required=false", Breaks: CompatibilityForward},
+			},
+		},
+		{
+			"changes are sorted by field",
+			newSchema(optionalField("zip", "string"), optionalField("address", "string")),
+			[]*SchemaChange{
+				{Field: "address", Change: "added", Current: "string"},
+				{Field: "id", Change: "removed", Previous: "int", Breaks: CompatibilityForward},
+				{Field: "name", Change: "removed", Previous: "string"},
+				{Field: "zip", Change: "added", Current: "string"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes := DiffSchemas(base, tt.current)
+			if !reflect.DeepEqual(changes, tt.expected) {
+				t.Errorf("DiffSchemas() = %s, want %s", FormatSchemaChanges(changes), FormatSchemaChanges(tt.expected))
+			}
+		})
+	}
+}
+
+func TestCheckCompatibility(t *testing.T) {
+
+	base := newSchema(requiredField("id", "int"), optionalField("name", "string"))
+
+	addRequired := newSchema(requiredField("id", "int"), optionalField("name", "string"), requiredField("email", "string"))
+	addOptional := newSchema(requiredField("id", "int"), optionalField("name", "string"), optionalField("email", "string"))
+	removeRequired := newSchema(optionalField("name", "string"))
+	removeOptional := newSchema(requiredField("id", "int"))
+	changeType := newSchema(requiredField("id", "string"), optionalField("name", "string"))
+
+	tests := []struct {
+		name     string
+		mode     string
+		current  *CollectionSchema
+		expected []string
+	}{
+		{"none allows type change", CompatibilityNone, changeType, []string{}},
+		{"backward allows optional field added", CompatibilityBackward, addOptional, []string{}},
+		{"backward rejects required field added", CompatibilityBackward, addRequired, []string{"email"}},
+		{"backward allows required field removed", CompatibilityBackward, removeRequired, []string{}},
+		{"backward rejects type change", CompatibilityBackward, changeType, []string{"id"}},
+		{"forward allows required field added", CompatibilityForward, addRequired, []string{}},
+		{"forward rejects required field removed", CompatibilityForward, removeRequired, []string{"id"}},
+		{"forward allows optional field removed", CompatibilityForward, removeOptional, []string{}},
+		{"forward rejects type change", CompatibilityForward, changeType, []string{"id"}},
+		{"full rejects required field added", CompatibilityFull, addRequired, []string{"email"}},
+		{"full rejects required field removed", CompatibilityFull, removeRequired, []string{"id"}},
+		{"full allows optional field added", CompatibilityFull, addOptional, []string{}},
+		{"full allows optional field removed", CompatibilityFull, removeOptional, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations := CheckCompatibility(tt.mode, base, tt.current)
+
+			fields := make([]string, 0, len(violations))
+			for _, change := range violations {
+				fields = append(fields, change.Field)
+			}
+
+			if !reflect.DeepEqual(fields, tt.expected) {
+				t.Errorf("CheckCompatibility(%s) = %s, want violations of %v", tt.mode, FormatSchemaChanges(violations), tt.expected)
+			}
+		})
+	}
+}
+
+func TestCollectionSchemaValidate(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		schema   *CollectionSchema
+		expected error
+	}{
+		{"valid", newSchema(requiredField("id", "int"), optionalField("name", "string")), nil},
+		{"empty", newSchema(), nil},
+		{"nil schema", nil, ErrInvalidSchema},
+		{"nil field", newSchema(nil), ErrInvalidSchema},
+		{"missing name", newSchema(optionalField("", "string")), ErrInvalidSchema},
+		{"missing type", newSchema(optionalField("name", "")), ErrInvalidSchema},
+		{"duplicate field", newSchema(optionalField("name", "string"), requiredField("name", "string")), ErrInvalidSchema},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.schema.validate(); err != tt.expected {
+				t.Errorf("validate() = %v, want %v", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSchemaCompatibilityError(t *testing.T) {
+
+	var err error = &SchemaCompatibilityError{
+		Compatibility: CompatibilityBackward,
+	}
+
+	if !errors.Is(err, ErrIncompatibleSchema) {
+		t.Errorf("errors.Is(%v, ErrIncompatibleSchema) = false", err)
+	}
+}
@@ -0,0 +1,172 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/BrobridgeOrg/gravity-controller/pkg/controller/service/middleware"
+	"github.com/BrobridgeOrg/gravity-sdk/core/keyring"
+)
+
+const DefaultCollectionSearchCount = 100
+
+type CollectionQuery struct {
+	NamePrefix    string
+	Metadata      map[string]string
+	Selector      string
+	Adapter       string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	SortBy        string
+	Descending    bool
+	Cursor        string
+	Count         int
+}
+
+func (query *CollectionQuery) match(collection *CollectionInfo, selector *LabelSelector) bool {
+
+	if !selector.Matches(collection.Labels) {
+		return false
+	}
+
+	if len(query.NamePrefix) > 0 && !strings.HasPrefix(collection.Name, query.NamePrefix) {
+		return false
+	}
+
+	if !query.CreatedAfter.IsZero() && !collection.CreatedAt.After(query.CreatedAfter) {
+		return false
+	}
+
+	if !query.CreatedBefore.IsZero() && !collection.CreatedAt.Before(query.CreatedBefore) {
+		return false
+	}
+
+	// Empty value matches any collection which has the metadata key
+	for key, value := range query.Metadata {
+		v, ok := collection.Metadata[key]
+		if !ok || (len(value) > 0 && v != value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (query *CollectionQuery) sortKey(collection *CollectionInfo) string {
+
+	switch query.SortBy {
+	case "name":
+		return collection.Name
+	case "createdAt":
+		return fmt.Sprintf("%020d", collection.CreatedAt.UnixNano())
+	case "updatedAt":
+		return fmt.Sprintf("%020d", collection.UpdatedAt.UnixNano())
+	}
+
+	return collection.CollectionID
+}
+
+// SearchCollections returns collections which match query and are accessible
+// by key, total number of matched collections and cursor of next page. All
+// collections are accessible if key is not specified.
+func (cm *CollectionManager) SearchCollections(query *CollectionQuery, key *keyring.KeyInfo) ([]*CollectionInfo, int, string, error) {
+
+	switch query.SortBy {
+	case "", "collectionID", "name", "createdAt", "updatedAt":
+	default:
+		return nil, 0, "", ErrInvalidSortBy
+	}
+
+	selector, err := ParseLabelSelector(query.Selector)
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	count := query.Count
+	if count <= 0 {
+		count = DefaultCollectionSearchCount
+	}
+
+	// Collections which are produced by specific adapter
+	var produced map[string]bool
+	if len(query.Adapter) > 0 {
+		collections, err := cm.controller.adapterManager.GetAdapterCollections(query.Adapter)
+		if err != nil {
+			return nil, 0, "", err
+		}
+
+		produced = make(map[string]bool)
+		for _, col := range collections {
+			produced[col] = true
+		}
+	}
+
+	collections, err := cm.GetCollections()
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	metadata, err := cm.listMetadata()
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	labels, err := cm.listLabels()
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	matched := make(map[string]*CollectionInfo)
+	cursors := make([]*searchCursor, 0)
+	for _, collection := range collections {
+
+		if key != nil && !middleware.CheckCollection(key, collection.ID) {
+			continue
+		}
+
+		if produced != nil && !produced[collection.ID] {
+			continue
+		}
+
+		info := &CollectionInfo{
+			CollectionID: collection.ID,
+			Name:         collection.Name,
+			Desc:         collection.Desc,
+			Metadata:     metadata[collection.ID],
+			Labels:       labels[collection.ID],
+			CreatedAt:    collection.CreatedAt,
+			UpdatedAt:    collection.UpdatedAt,
+		}
+
+		if info.Metadata == nil {
+			info.Metadata = make(map[string]string)
+		}
+
+		if info.Labels == nil {
+			info.Labels = make(map[string]string)
+		}
+
+		if !query.match(info, selector) {
+			continue
+		}
+
+		matched[info.CollectionID] = info
+		cursors = append(cursors, &searchCursor{
+			Key: query.sortKey(info),
+			ID:  info.CollectionID,
+		})
+	}
+
+	start, end, nextCursor, err := paginate(cursors, query.Cursor, count, query.Descending)
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	results := make([]*CollectionInfo, 0, end-start)
+	for _, cursor := range cursors[start:end] {
+		results = append(results, matched[cursor.ID])
+	}
+
+	return results, len(cursors), nextCursor, nil
+}
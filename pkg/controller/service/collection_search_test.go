@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCollectionQueryMatch(t *testing.T) {
+
+	createdAt := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	collection := &CollectionInfo{
+		CollectionID: "orders",
+		Name:         "orders-v2",
+		Metadata: map[string]string{
+			"owner":  "data",
+			"source": "",
+		},
+		Labels: map[string]string{
+			"team": "data",
+			"env":  "prod",
+		},
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt.Add(time.Hour),
+	}
+
+	tests := []struct {
+		name     string
+		query    CollectionQuery
+		expected bool
+	}{
+		{"empty query", CollectionQuery{}, true},
+		{"name prefix", CollectionQuery{NamePrefix: "orders"}, true},
+		{"name prefix mismatch", CollectionQuery{NamePrefix: "accounts"}, false},
+		{"selector", CollectionQuery{Selector: "team=data,env!=staging"}, true},
+		{"selector mismatch", CollectionQuery{Selector: "env=staging"}, false},
+		{"metadata", CollectionQuery{Metadata: map[string]string{"owner": "data"}}, true},
+		{"metadata mismatch", CollectionQuery{Metadata: map[string]string{"owner": "ops"}}, false},
+		{"metadata key only", CollectionQuery{Metadata: map[string]string{"source": ""}}, true},
+		{"metadata key missing", CollectionQuery{Metadata: map[string]string{"region": ""}}, false},
+		{"created after", CollectionQuery{CreatedAfter: createdAt.Add(-time.Hour)}, true},
+		{"created after is exclusive", CollectionQuery{CreatedAfter: createdAt}, false},
+		{"created before", CollectionQuery{CreatedBefore: createdAt.Add(time.Hour)}, true},
+		{"created before is exclusive", CollectionQuery{CreatedBefore: createdAt}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selector, err := ParseLabelSelector(tt.query.Selector)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if matched := tt.query.match(collection, selector); matched != tt.expected {
+				t.Errorf("match() = %v, want %v", matched, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCollectionQuerySortKey(t *testing.T) {
+
+	collection := &CollectionInfo{
+		CollectionID: "orders",
+		Name:         "orders-v2",
+		CreatedAt:    time.Unix(1600000000, 0),
+		UpdatedAt:    time.Unix(1700000000, 0),
+	}
+
+	tests := []struct {
+		sortBy   string
+		expected string
+	}{
+		{"", "orders"},
+		{"collectionID", "orders"},
+		{"name", "orders-v2"},
+		{"createdAt", "01600000000000000000"},
+		{"updatedAt", "01700000000000000000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sortBy, func(t *testing.T) {
+			query := &CollectionQuery{SortBy: tt.sortBy}
+			if key := query.sortKey(collection); key != tt.expected {
+				t.Errorf("sortKey() = %s, want %s", key, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCollectionPagesByTime(t *testing.T) {
+
+	// Sort keys of timestamps are ordered as time even across digit boundaries
+	times := []time.Time{
+		time.Unix(1600000000, 0),
+		time.Unix(999999999, 0),
+		time.Unix(1600000000, 1),
+		time.Unix(5, 0),
+	}
+
+	query := &CollectionQuery{SortBy: "createdAt"}
+
+	cursors := make([]*searchCursor, 0)
+	for i, createdAt := range times {
+		collection := &CollectionInfo{
+			CollectionID: string(rune('a' + i)),
+			CreatedAt:    createdAt,
+		}
+
+		cursors = append(cursors, &searchCursor{
+			Key: query.sortKey(collection),
+			ID:  collection.CollectionID,
+		})
+	}
+
+	start, end, next, err := paginate(cursors, "", 3, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := cursorIDs(cursors[start:end]); !reflect.DeepEqual(ids, []string{"d", "b", "a"}) {
+		t.Fatalf("first page = %v, want [d b a]", ids)
+	}
+
+	start, end, next, err = paginate(cursors, next, 3, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ids := cursorIDs(cursors[start:end]); !reflect.DeepEqual(ids, []string{"c"}) || len(next) != 0 {
+		t.Errorf("last page = %v with cursor %q, want [c] without cursor", ids, next)
+	}
+}
@@ -5,9 +5,13 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/BrobridgeOrg/gravity-controller/pkg/app"
+	"github.com/BrobridgeOrg/gravity-controller/pkg/config"
+	"github.com/BrobridgeOrg/gravity-controller/pkg/controller/service/middleware"
 	"github.com/BrobridgeOrg/gravity-sdk/core"
 	"github.com/BrobridgeOrg/gravity-sdk/core/keyring"
 	gravity_store "github.com/BrobridgeOrg/gravity-sdk/core/store"
@@ -16,32 +20,65 @@ import (
 
 type Controller struct {
 	app                 app.App
+	config              atomic.Value
+	reloadMutex         sync.Mutex
 	gravityClient       *core.Client
 	domain              string
 	clientID            string
 	auth                *Authentication
 	keyring             *keyring.Keyring
+	keyringStore        *KeyringStore
+	keyRotation         *KeyRotation
+	roles               *RoleManager
+	sessions            *SessionManager
+	replayGuard         *middleware.ReplayGuard
+	rateLimiter         *middleware.RateLimiter
 	adapterManager      *AdapterManager
 	synchronizerManager *SynchronizerManager
 	pipelineManager     *PipelineManager
 	subscriberManager   *SubscriberManager
 	collectionManager   *CollectionManager
+	collectionIndex     *CollectionIndex
+	audit               *AuditLog
+	events              *EventPublisher
+	state               int32
+	fatalErrors         chan error
+	shutdown            chan struct{}
+	closeOnce           sync.Once
 	store               *gravity_store.Store
 }
 
-func NewController(a app.App) *Controller {
+func NewController(a app.App, config *config.Config) *Controller {
 	controller := &Controller{
 		app:           a,
 		gravityClient: core.NewClient(),
 		keyring:       keyring.NewKeyring(),
 		auth:          NewAuthentication(),
+		state:         int32(StateConnecting),
+		fatalErrors:   make(chan error, 1),
+		shutdown:      make(chan struct{}),
 	}
 
+	controller.config.Store(config)
+
 	controller.adapterManager = NewAdapterManager(controller)
 	controller.synchronizerManager = NewSynchronizerManager(controller)
 	controller.pipelineManager = NewPipelineManager(controller)
 	controller.subscriberManager = NewSubscriberManager(controller)
 	controller.collectionManager = NewCollectionManager(controller)
+	controller.collectionIndex = NewCollectionIndex()
+	controller.audit = NewAuditLog(controller)
+	controller.events = NewEventPublisher(controller)
+	controller.keyringStore = NewKeyringStore(controller)
+	controller.keyRotation = NewKeyRotation(controller)
+	controller.roles = NewRoleManager(controller)
+	controller.sessions = NewSessionManager(controller)
+	controller.replayGuard = middleware.NewReplayGuard(
+		time.Duration(config.Security.ReplayWindow)*time.Second,
+		config.Security.AllowLegacyPackets,
+	)
+	controller.rateLimiter = middleware.NewRateLimiter()
+	controller.applyRateLimit(&config.RateLimit)
 
 	return controller
 }
@@ -52,7 +89,7 @@ func (controller *Controller) Init() error {
 	host, err := os.Hostname()
 	if err != nil {
 		log.Error(err)
-		return nil
+		return err
 	}
 
 	host = strings.ReplaceAll(host, ".", "_")
@@ -66,55 +103,88 @@ func (controller *Controller) Init() error {
 		return err
 	}
 
-	// Initializing gravity
-	err = controller.initializeClient()
+	// Connect and restore states in background
+	go controller.start()
+
+	return nil
+}
+
+func (controller *Controller) initializeManagers() error {
+
+	// Initializing audit log
+	err := controller.audit.Initialize()
 	if err != nil {
-		log.Error(err)
-		timer := time.NewTimer(1000 * time.Millisecond)
-		<-timer.C
-		return controller.Init()
+		return err
+	}
+
+	// Restoring keyring
+	err = controller.keyringStore.Initialize()
+	if err != nil {
+		return err
+	}
+
+	keys, err := controller.keyringStore.Restore()
+	if err != nil {
+		return err
+	}
+
+	// Restoring key rotations
+	err = controller.keyRotation.Initialize()
+	if err != nil {
+		return err
+	}
+
+	// Restoring roles
+	err = controller.roles.Initialize()
+	if err != nil {
+		return err
+	}
+
+	// Restoring sessions
+	err = controller.sessions.Initialize()
+	if err != nil {
+		return err
 	}
 
 	// Initializing authentication
 	err = controller.auth.Initialize(controller)
 	if err != nil {
-		log.Error(err)
 		return err
 	}
 
 	// Initializing collection  manager
 	err = controller.collectionManager.Initialize()
 	if err != nil {
-		log.Error(err)
-		return nil
+		return err
 	}
 
 	// Initializing adapter manager
 	err = controller.adapterManager.Initialize()
 	if err != nil {
-		log.Error(err)
-		return nil
+		return err
 	}
 
 	// Initializing synchronizer manager
 	err = controller.synchronizerManager.Initialize()
 	if err != nil {
-		log.Error(err)
-		return nil
+		return err
+	}
+
+	// Re-push restored keys to synchronizers
+	for _, key := range keys {
+		controller.synchronizerManager.UpdateKeyring(key)
 	}
 
 	// Initializing pipeline manager
 	err = controller.pipelineManager.Initialize()
 	if err != nil {
-		log.Error(err)
-		return nil
+		return err
 	}
 
 	// Initializing subscriber manager
 	err = controller.subscriberManager.Initialize()
 	if err != nil {
-		log.Error(err)
-		return nil
+		return err
 	}
 
 	return nil
@@ -0,0 +1,323 @@
+package controller
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	authenticator "github.com/BrobridgeOrg/gravity-sdk/authenticator"
+)
+
+const (
+	DefaultEntitySearchCount = 100
+	entityListPageSize       = 1000
+)
+
+var (
+	ErrInvalidCursor = errors.New("InvalidCursor")
+	ErrInvalidSortBy = errors.New("InvalidSortBy")
+
+	// Creation time is only available from built-in entity store
+	ErrUnsupportedTimeFilter = errors.New("UnsupportedTimeFilter")
+)
+
+type EntityQuery struct {
+	Permission    string
+	Collection    string
+	NamePrefix    string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	SortBy        string
+	Descending    bool
+	Cursor        string
+	Count         int
+}
+
+// EntityInfo is entity without access key
+type EntityInfo struct {
+	AppID       string    `json:"appID"`
+	AppName     string    `json:"appName"`
+	Permissions []string  `json:"permissions"`
+	Collections []string  `json:"collections"`
+	CreatedAt   time.Time `json:"createdAt,omitempty"`
+}
+
+// searchCursor points to the last item of page by its sort key and ID
+type searchCursor struct {
+	Key string `json:"k"`
+	ID  string `json:"id"`
+}
+
+func getStrings(props map[string]interface{}, name string) []string {
+
+	if v, ok := props[name].([]string); ok {
+		return v
+	}
+
+	return []string{}
+}
+
+// ListEntities walks through all entities with creation time
+func (les *LocalEntityStore) ListEntities(fn func(entity *authenticator.Entity, createdAt time.Time) bool) error {
+
+	store, err := les.controller.store.GetEngine().GetStore("gravity_controller")
+	if err != nil {
+		return err
+	}
+
+	return store.List("entities", []byte(""), func(key []byte, value []byte) bool {
+
+		var entity LocalEntity
+		err := json.Unmarshal(value, &entity)
+		if err != nil {
+			return true
+		}
+
+		return fn(&authenticator.Entity{
+			AppID:      entity.AppID,
+			AppName:    entity.AppName,
+			Properties: normalizeProperties(entity.Properties),
+		}, entity.CreatedAt)
+	})
+}
+
+// listEntities loads all entities from backend, creation time is only available from built-in entity store
+func (auth *Authentication) listEntities() ([]*EntityInfo, error) {
+
+	results := make([]*EntityInfo, 0)
+
+	convert := func(entity *authenticator.Entity, createdAt time.Time) *EntityInfo {
+		return &EntityInfo{
+			AppID:       entity.AppID,
+			AppName:     entity.AppName,
+			Permissions: getStrings(entity.Properties, "permissions"),
+			Collections: getStrings(entity.Properties, "collections"),
+			CreatedAt:   createdAt,
+		}
+	}
+
+	if local, ok := auth.getAuthenticator().(*LocalEntityStore); ok {
+		err := local.ListEntities(func(entity *authenticator.Entity, createdAt time.Time) bool {
+			results = append(results, convert(entity, createdAt))
+			return true
+		})
+
+		return results, err
+	}
+
+	startID := ""
+	for {
+		entities, _, err := auth.getAuthenticator().GetEntities(startID, entityListPageSize)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entity := range entities {
+			// Start ID is included in every page except the first one
+			if len(startID) > 0 && entity.AppID == startID {
+				continue
+			}
+
+			results = append(results, convert(entity, time.Time{}))
+		}
+
+		if len(entities) < entityListPageSize {
+			break
+		}
+
+		startID = entities[len(entities)-1].AppID
+	}
+
+	return results, nil
+}
+
+func (query *EntityQuery) match(entity *EntityInfo) bool {
+
+	if len(query.NamePrefix) > 0 && !strings.HasPrefix(entity.AppName, query.NamePrefix) {
+		return false
+	}
+
+	if !query.CreatedAfter.IsZero() && !entity.CreatedAt.After(query.CreatedAfter) {
+		return false
+	}
+
+	if !query.CreatedBefore.IsZero() && (entity.CreatedAt.IsZero() || !entity.CreatedAt.Before(query.CreatedBefore)) {
+		return false
+	}
+
+	if len(query.Permission) > 0 {
+		found := false
+		for _, perm := range entity.Permissions {
+			if perm == query.Permission {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	if len(query.Collection) > 0 {
+		found := false
+		for _, pattern := range entity.Collections {
+			if matched, _ := path.Match(pattern, query.Collection); matched {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (query *EntityQuery) sortKey(entity *EntityInfo) string {
+
+	switch query.SortBy {
+	case "appName":
+		return entity.AppName
+	case "createdAt":
+		return fmt.Sprintf("%020d", entity.CreatedAt.UnixNano())
+	}
+
+	return entity.AppID
+}
+
+func (cursor *searchCursor) less(other *searchCursor, descending bool) bool {
+
+	if cursor.Key == other.Key {
+		if descending {
+			return cursor.ID > other.ID
+		}
+
+		return cursor.ID < other.ID
+	}
+
+	if descending {
+		return cursor.Key > other.Key
+	}
+
+	return cursor.Key < other.Key
+}
+
+func encodeCursor(cursor *searchCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(token string) (*searchCursor, error) {
+
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor searchCursor
+	err = json.Unmarshal(data, &cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
+
+// paginate sorts cursors and returns range of page which follows cursor, cursor of next page is empty if it is the last page
+func paginate(cursors []*searchCursor, after string, count int, descending bool) (int, int, string, error) {
+
+	var cursor *searchCursor
+	if len(after) > 0 {
+		c, err := decodeCursor(after)
+		if err != nil {
+			return 0, 0, "", err
+		}
+
+		cursor = c
+	}
+
+	sort.Slice(cursors, func(i, j int) bool {
+		return cursors[i].less(cursors[j], descending)
+	})
+
+	// Skip items before cursor
+	start := 0
+	if cursor != nil {
+		start = sort.Search(len(cursors), func(i int) bool {
+			return cursor.less(cursors[i], descending)
+		})
+	}
+
+	end := start + count
+	if end > len(cursors) {
+		end = len(cursors)
+	}
+
+	nextCursor := ""
+	if end < len(cursors) {
+		nextCursor = encodeCursor(cursors[end-1])
+	}
+
+	return start, end, nextCursor, nil
+}
+
+// SearchEntities returns entities which match query, total number of matched
+// entities and cursor of next page.
+func (auth *Authentication) SearchEntities(query *EntityQuery) ([]*EntityInfo, int, string, error) {
+
+	switch query.SortBy {
+	case "", "appID", "appName", "createdAt":
+	default:
+		return nil, 0, "", ErrInvalidSortBy
+	}
+
+	if !query.CreatedAfter.IsZero() || !query.CreatedBefore.IsZero() {
+		if _, ok := auth.getAuthenticator().(*LocalEntityStore); !ok {
+			return nil, 0, "", ErrUnsupportedTimeFilter
+		}
+	}
+
+	count := query.Count
+	if count <= 0 {
+		count = DefaultEntitySearchCount
+	}
+
+	entities, err := auth.listEntities()
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	matched := make(map[string]*EntityInfo)
+	cursors := make([]*searchCursor, 0)
+	for _, entity := range entities {
+		if !query.match(entity) {
+			continue
+		}
+
+		matched[entity.AppID] = entity
+		cursors = append(cursors, &searchCursor{
+			Key: query.sortKey(entity),
+			ID:  entity.AppID,
+		})
+	}
+
+	start, end, nextCursor, err := paginate(cursors, query.Cursor, count, query.Descending)
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	results := make([]*EntityInfo, 0, end-start)
+	for _, cursor := range cursors[start:end] {
+		results = append(results, matched[cursor.ID])
+	}
+
+	return results, len(cursors), nextCursor, nil
+}
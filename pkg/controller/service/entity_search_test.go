@@ -0,0 +1,381 @@
+package controller
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	authenticator "github.com/BrobridgeOrg/gravity-sdk/authenticator"
+)
+
+// fakeEntityBackend serves entities like authentication service does
+type fakeEntityBackend struct {
+	entities []*authenticator.Entity
+}
+
+func (fb *fakeEntityBackend) Authenticate(appID string, token []byte) (*authenticator.Entity, error) {
+	return nil, errors.New("not supported")
+}
+
+func (fb *fakeEntityBackend) CreateEntity(entity *authenticator.Entity) error {
+	return errors.New("not supported")
+}
+
+func (fb *fakeEntityBackend) UpdateEntity(entity *authenticator.Entity) error {
+	return errors.New("not supported")
+}
+
+func (fb *fakeEntityBackend) DeleteEntity(appID string) error {
+	return errors.New("not supported")
+}
+
+func (fb *fakeEntityBackend) GetEntity(appID string) (*authenticator.Entity, error) {
+	return nil, errors.New("not supported")
+}
+
+func (fb *fakeEntityBackend) UpdateEntityKey(appID string, key string) error {
+	return errors.New("not supported")
+}
+
+// GetEntities returns entities from start ID in order of appID, start ID is included
+func (fb *fakeEntityBackend) GetEntities(startID string, count int64) ([]*authenticator.Entity, int64, error) {
+
+	entities := make([]*authenticator.Entity, len(fb.entities))
+	copy(entities, fb.entities)
+	sort.Slice(entities, func(i, j int) bool {
+		return entities[i].AppID < entities[j].AppID
+	})
+
+	results := make([]*authenticator.Entity, 0)
+	for _, entity := range entities {
+		if entity.AppID < startID || int64(len(results)) >= count {
+			continue
+		}
+
+		results = append(results, entity)
+	}
+
+	return results, int64(len(entities)), nil
+}
+
+func newSearchAuthentication(entities ...*authenticator.Entity) *Authentication {
+	return &Authentication{
+		authenticator: &fakeEntityBackend{
+			entities: entities,
+		},
+	}
+}
+
+func newSearchEntity(appID string, appName string) *authenticator.Entity {
+	return &authenticator.Entity{
+		AppID:   appID,
+		AppName: appName,
+		Properties: map[string]interface{}{
+			"permissions": []string{"SUBSCRIBER"},
+			"collections": []string{"*"},
+		},
+	}
+}
+
+// searchPages walks through all pages and returns appIDs of every page
+func searchPages(t *testing.T, auth *Authentication, query EntityQuery) [][]string {
+
+	pages := make([][]string, 0)
+	for {
+		entities, _, next, err := auth.SearchEntities(&query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids := make([]string, 0, len(entities))
+		for _, entity := range entities {
+			ids = append(ids, entity.AppID)
+		}
+
+		pages = append(pages, ids)
+		if len(next) == 0 {
+			return pages
+		}
+
+		if len(pages) > 10 {
+			t.Fatalf("pagination does not end: %v", pages)
+		}
+
+		query.Cursor = next
+	}
+}
+
+func TestSearchEntitiesPagination(t *testing.T) {
+
+	auth := newSearchAuthentication(
+		newSearchEntity("app3", "c"),
+		newSearchEntity("app1", "a"),
+		newSearchEntity("app2", "b"),
+		newSearchEntity("app4", "b"),
+		newSearchEntity("app5", "d"),
+	)
+
+	tests := []struct {
+		name     string
+		query    EntityQuery
+		expected [][]string
+	}{
+		{"single page", EntityQuery{Count: 10}, [][]string{{"app1", "app2", "app3", "app4", "app5"}}},
+		{"exact page", EntityQuery{Count: 5}, [][]string{{"app1", "app2", "app3", "app4", "app5"}}},
+		{"multiple pages", EntityQuery{Count: 2}, [][]string{{"app1", "app2"}, {"app3", "app4"}, {"app5"}}},
+		{"sorted by name", EntityQuery{SortBy: "appName", Count: 2}, [][]string{{"app1", "app2"}, {"app4", "app3"}, {"app5"}}},
+		{"descending", EntityQuery{SortBy: "appName", Descending: true, Count: 2}, [][]string{{"app5", "app3"}, {"app4", "app2"}, {"app1"}}},
+		{"filtered", EntityQuery{NamePrefix: "b", Count: 1}, [][]string{{"app2"}, {"app4"}}},
+		{"nothing matched", EntityQuery{NamePrefix: "x", Count: 2}, [][]string{{}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pages := searchPages(t, auth, tt.query)
+			if !reflect.DeepEqual(pages, tt.expected) {
+				t.Errorf("pages = %v, want %v", pages, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSearchEntitiesTotal(t *testing.T) {
+
+	auth := newSearchAuthentication(
+		newSearchEntity("app1", "a"),
+		newSearchEntity("app2", "b"),
+		newSearchEntity("app3", "b"),
+	)
+
+	entities, total, _, err := auth.SearchEntities(&EntityQuery{NamePrefix: "b", Count: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entities) != 1 || total != 2 {
+		t.Errorf("SearchEntities() returned %d entities of %d, want 1 of 2", len(entities), total)
+	}
+}
+
+func TestSearchEntitiesInvalidQuery(t *testing.T) {
+
+	auth := newSearchAuthentication(newSearchEntity("app1", "a"))
+
+	tests := []struct {
+		name     string
+		query    EntityQuery
+		expected error
+	}{
+		{"invalid sort field", EntityQuery{SortBy: "accessKey"}, ErrInvalidSortBy},
+		{"cursor is not base64", EntityQuery{Cursor: "!!!"}, ErrInvalidCursor},
+		{"cursor is not json", EntityQuery{Cursor: "Y3Vyc29y"}, ErrInvalidCursor},
+		{"created after on remote backend", EntityQuery{CreatedAfter: time.Now()}, ErrUnsupportedTimeFilter},
+		{"created before on remote backend", EntityQuery{CreatedBefore: time.Now()}, ErrUnsupportedTimeFilter},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, err := auth.SearchEntities(&tt.query)
+			if err != tt.expected {
+				t.Errorf("SearchEntities() error = %v, want %v", err, tt.expected)
+			}
+		})
+	}
+}
+
+func newCursors(items ...string) []*searchCursor {
+
+	// Items are given as pairs of sort key and ID
+	cursors := make([]*searchCursor, 0, len(items)/2)
+	for i := 0; i+1 < len(items); i += 2 {
+		cursors = append(cursors, &searchCursor{Key: items[i], ID: items[i+1]})
+	}
+
+	return cursors
+}
+
+func cursorIDs(cursors []*searchCursor) []string {
+
+	ids := make([]string, 0, len(cursors))
+	for _, cursor := range cursors {
+		ids = append(ids, cursor.ID)
+	}
+
+	return ids
+}
+
+// collectPages walks through all pages and returns IDs of every page
+func collectPages(t *testing.T, items []string, count int, descending bool) [][]string {
+
+	pages := make([][]string, 0)
+	after := ""
+	for {
+		cursors := newCursors(items...)
+
+		start, end, next, err := paginate(cursors, after, count, descending)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pages = append(pages, cursorIDs(cursors[start:end]))
+		if len(next) == 0 {
+			return pages
+		}
+
+		if len(pages) > len(items) {
+			t.Fatalf("pagination does not end: %v", pages)
+		}
+
+		after = next
+	}
+}
+
+func TestPaginate(t *testing.T) {
+
+	items := []string{
+		"c", "3",
+		"a", "1",
+		"b", "2",
+		"b", "4",
+		"d", "5",
+	}
+
+	tests := []struct {
+		name       string
+		items      []string
+		count      int
+		descending bool
+		expected   [][]string
+	}{
+		{"single page", items, 10, false, [][]string{{"1", "2", "4", "3", "5"}}},
+		{"exact page", items, 5, false, [][]string{{"1", "2", "4", "3", "5"}}},
+		{"multiple pages", items, 2, false, [][]string{{"1", "2"}, {"4", "3"}, {"5"}}},
+		{"page per item", items, 1, false, [][]string{{"1"}, {"2"}, {"4"}, {"3"}, {"5"}}},
+		{"descending", items, 2, true, [][]string{{"5", "3"}, {"4", "2"}, {"1"}}},
+		{"empty", []string{}, 2, false, [][]string{{}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pages := collectPages(t, tt.items, tt.count, tt.descending)
+			if !reflect.DeepEqual(pages, tt.expected) {
+				t.Errorf("pages = %v, want %v", pages, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPaginateAfterChanges(t *testing.T) {
+
+	cursors := newCursors("a", "1", "b", "2", "c", "3", "d", "4")
+	_, _, next, err := paginate(cursors, "", 2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		items    []string
+		expected []string
+	}{
+		{"unchanged", []string{"a", "1", "b", "2", "c", "3", "d", "4"}, []string{"3", "4"}},
+		{"last item of page removed", []string{"a", "1", "c", "3", "d", "4"}, []string{"3", "4"}},
+		{"item inserted before cursor", []string{"a", "0", "a", "1", "b", "2", "c", "3", "d", "4"}, []string{"3", "4"}},
+		{"item inserted after cursor", []string{"a", "1", "b", "2", "b", "5", "c", "3", "d", "4"}, []string{"5", "3"}},
+		{"all items after cursor removed", []string{"a", "1", "b", "2"}, []string{}},
+	}
+
+	// Cursor keeps position even if items were changed between pages
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursors := newCursors(tt.items...)
+
+			start, end, _, err := paginate(cursors, next, 2, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if ids := cursorIDs(cursors[start:end]); !reflect.DeepEqual(ids, tt.expected) {
+				t.Errorf("page = %v, want %v", ids, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPaginateInvalidCursor(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"not base64", "!!!"},
+		{"not json", base64.RawURLEncoding.EncodeToString([]byte("cursor"))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, err := paginate(newCursors("a", "1"), tt.cursor, 1, false)
+			if err != ErrInvalidCursor {
+				t.Errorf("paginate() error = %v, want %v", err, ErrInvalidCursor)
+			}
+		})
+	}
+}
+
+func TestCursorEncoding(t *testing.T) {
+
+	cursor := &searchCursor{Key: "00000000001600000000", ID: "app/with+symbols"}
+
+	decoded, err := decodeCursor(encodeCursor(cursor))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *decoded != *cursor {
+		t.Errorf("decodeCursor() = %+v, want %+v", decoded, cursor)
+	}
+}
+
+func TestEntityQueryMatch(t *testing.T) {
+
+	createdAt := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	entity := &EntityInfo{
+		AppID:       "app1",
+		AppName:     "orders-service",
+		Permissions: []string{"SUBSCRIBER"},
+		Collections: []string{"orders.*", "accounts"},
+		CreatedAt:   createdAt,
+	}
+
+	tests := []struct {
+		name     string
+		query    EntityQuery
+		expected bool
+	}{
+		{"empty query", EntityQuery{}, true},
+		{"name prefix", EntityQuery{NamePrefix: "orders"}, true},
+		{"name prefix mismatch", EntityQuery{NamePrefix: "accounts"}, false},
+		{"permission", EntityQuery{Permission: "SUBSCRIBER"}, true},
+		{"permission mismatch", EntityQuery{Permission: "ADMIN"}, false},
+		{"collection", EntityQuery{Collection: "accounts"}, true},
+		{"collection by wildcard", EntityQuery{Collection: "orders.items"}, true},
+		{"collection mismatch", EntityQuery{Collection: "users"}, false},
+		{"created after", EntityQuery{CreatedAfter: createdAt.Add(-time.Hour)}, true},
+		{"created after is exclusive", EntityQuery{CreatedAfter: createdAt}, false},
+		{"created before", EntityQuery{CreatedBefore: createdAt.Add(time.Hour)}, true},
+		{"created before is exclusive", EntityQuery{CreatedBefore: createdAt}, false},
+		{"all filters", EntityQuery{NamePrefix: "orders", Permission: "SUBSCRIBER", Collection: "orders.items", CreatedAfter: createdAt.Add(-time.Hour)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if matched := tt.query.match(entity); matched != tt.expected {
+				t.Errorf("match() = %v, want %v", matched, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,438 @@
+package controller
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	authenticator "github.com/BrobridgeOrg/gravity-sdk/authenticator"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrEntityExists   = errors.New("EntityExists")
+	ErrEntityNotFound = errors.New("NotFoundEntity")
+	ErrInvalidAppID   = errors.New("InvalidAppID")
+	ErrInvalidToken   = errors.New("InvalidToken")
+)
+
+// EntityBackend manages app entities, it is implemented by the external
+// authentication service client and the built-in entity store.
+type EntityBackend interface {
+	Authenticate(appID string, token []byte) (*authenticator.Entity, error)
+	CreateEntity(entity *authenticator.Entity) error
+	UpdateEntity(entity *authenticator.Entity) error
+	DeleteEntity(appID string) error
+	GetEntity(appID string) (*authenticator.Entity, error)
+	UpdateEntityKey(appID string, key string) error
+	GetEntities(startID string, count int64) ([]*authenticator.Entity, int64, error)
+}
+
+type LocalEntity struct {
+	AppID      string                 `json:"appID"`
+	AppName    string                 `json:"appName"`
+	Key        []byte                 `json:"key"`
+	Checksum   []byte                 `json:"checksum,omitempty"`
+	Properties map[string]interface{} `json:"properties"`
+	CreatedAt  time.Time              `json:"createdAt"`
+	UpdatedAt  time.Time              `json:"updatedAt"`
+}
+
+// LocalEntityStore keeps entities in controller's store for deployments without
+// authentication service, access keys are encrypted by gravity key the same way
+// as keyring store does.
+type LocalEntityStore struct {
+	controller *Controller
+	mutex      sync.Mutex
+}
+
+func NewLocalEntityStore(controller *Controller) *LocalEntityStore {
+	return &LocalEntityStore{
+		controller: controller,
+	}
+}
+
+func (les *LocalEntityStore) Initialize() error {
+
+	store, err := les.controller.store.GetEngine().GetStore("gravity_controller")
+	if err != nil {
+		return err
+	}
+
+	err = store.RegisterColumns([]string{"entities"})
+	if err != nil {
+		return err
+	}
+
+	rekeys := make([]*LocalEntity, 0)
+	err = store.List("entities", []byte(""), func(key []byte, value []byte) bool {
+
+		var entity LocalEntity
+		err := json.Unmarshal(value, &entity)
+		if err != nil {
+			log.Errorf("Unrecognized entity: %s", string(key))
+			return true
+		}
+
+		accessKey, rekey, err := les.open(&entity)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"appID": entity.AppID,
+			}).Error("Failed to decrypt access key")
+			return true
+		}
+
+		if !rekey {
+			return true
+		}
+
+		err = les.seal(&entity, accessKey)
+		if err != nil {
+			log.Error(err)
+			return true
+		}
+
+		rekeys = append(rekeys, &entity)
+
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	// Access keys are encrypted with current key of gravity from now on
+	for _, entity := range rekeys {
+		err := les.put(entity)
+		if err != nil {
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"appID": entity.AppID,
+		}).Info("Re-encrypted access key of entity")
+	}
+
+	return nil
+}
+
+func generateKey() (string, error) {
+
+	buf := make([]byte, 16)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
+
+// normalizeProperties converts lists which were decoded from JSON to string slices
+func normalizeProperties(props map[string]interface{}) map[string]interface{} {
+
+	if props == nil {
+		return make(map[string]interface{})
+	}
+
+	for _, name := range []string{"permissions", "collections"} {
+
+		v, ok := props[name].([]interface{})
+		if !ok {
+			continue
+		}
+
+		values := make([]string, 0, len(v))
+		for _, value := range v {
+			if s, ok := value.(string); ok {
+				values = append(values, s)
+			}
+		}
+
+		props[name] = values
+	}
+
+	return props
+}
+
+func (les *LocalEntityStore) get(appID string) (*LocalEntity, error) {
+
+	store, err := les.controller.store.GetEngine().GetStore("gravity_controller")
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := store.GetBytes("entities", []byte(appID))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		return nil, ErrEntityNotFound
+	}
+
+	var entity LocalEntity
+	err = json.Unmarshal(data, &entity)
+	if err != nil {
+		return nil, err
+	}
+
+	entity.Properties = normalizeProperties(entity.Properties)
+
+	return &entity, nil
+}
+
+func (les *LocalEntityStore) put(entity *LocalEntity) error {
+
+	store, err := les.controller.store.GetEngine().GetStore("gravity_controller")
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(entity)
+	if err != nil {
+		return err
+	}
+
+	return store.Put("entities", []byte(entity.AppID), data)
+}
+
+// seal encrypts access key of entity with checksum
+func (les *LocalEntityStore) seal(entity *LocalEntity, key string) error {
+
+	encrypted, checksum, err := les.controller.keyringStore.seal(entity.AppID, []byte(key))
+	if err != nil {
+		return err
+	}
+
+	entity.Key = encrypted
+	entity.Checksum = checksum
+
+	return nil
+}
+
+// open returns access key of entity, entities which were encrypted with
+// previous key of gravity are reported so they can be re-encrypted.
+func (les *LocalEntityStore) open(entity *LocalEntity) (string, bool, error) {
+
+	key, rekey, err := les.controller.keyringStore.decrypt(&KeyringEntry{
+		AppID:    entity.AppID,
+		Key:      entity.Key,
+		Checksum: entity.Checksum,
+	})
+	if err != nil {
+		return "", false, err
+	}
+
+	return string(key), rekey, nil
+}
+
+func (les *LocalEntityStore) convert(entity *LocalEntity) (*authenticator.Entity, error) {
+
+	key, _, err := les.open(entity)
+	if err != nil {
+		return nil, err
+	}
+
+	return &authenticator.Entity{
+		AppID:      entity.AppID,
+		AppName:    entity.AppName,
+		AccessKey:  key,
+		Properties: entity.Properties,
+	}, nil
+}
+
+// Authenticate checks token against access key of entity
+func (les *LocalEntityStore) Authenticate(appID string, token []byte) (*authenticator.Entity, error) {
+
+	entity, err := les.GetEntity(appID)
+	if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(entity.AccessKey), token) != 1 {
+		return nil, ErrInvalidToken
+	}
+
+	return entity, nil
+}
+
+func (les *LocalEntityStore) CreateEntity(entity *authenticator.Entity) error {
+
+	if len(entity.AppID) == 0 {
+		return ErrInvalidAppID
+	}
+
+	les.mutex.Lock()
+	defer les.mutex.Unlock()
+
+	_, err := les.get(entity.AppID)
+	if err == nil {
+		return ErrEntityExists
+	}
+
+	if err != ErrEntityNotFound {
+		return err
+	}
+
+	// Generate a key if not specified
+	key := entity.AccessKey
+	if len(key) == 0 {
+		key, err = generateKey()
+		if err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	local := &LocalEntity{
+		AppID:      entity.AppID,
+		AppName:    entity.AppName,
+		Properties: normalizeProperties(entity.Properties),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	err = les.seal(local, key)
+	if err != nil {
+		return err
+	}
+
+	err = les.put(local)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"appID": entity.AppID,
+	}).Info("Created entity")
+
+	return nil
+}
+
+// UpdateEntity updates name and properties of entity, key is changed by UpdateEntityKey only
+func (les *LocalEntityStore) UpdateEntity(entity *authenticator.Entity) error {
+
+	les.mutex.Lock()
+	defer les.mutex.Unlock()
+
+	current, err := les.get(entity.AppID)
+	if err != nil {
+		return err
+	}
+
+	current.AppName = entity.AppName
+	current.Properties = normalizeProperties(entity.Properties)
+	current.UpdatedAt = time.Now()
+
+	return les.put(current)
+}
+
+func (les *LocalEntityStore) DeleteEntity(appID string) error {
+
+	les.mutex.Lock()
+	defer les.mutex.Unlock()
+
+	_, err := les.get(appID)
+	if err != nil {
+		return err
+	}
+
+	store, err := les.controller.store.GetEngine().GetStore("gravity_controller")
+	if err != nil {
+		return err
+	}
+
+	err = store.Delete("entities", []byte(appID))
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"appID": appID,
+	}).Info("Deleted entity")
+
+	return nil
+}
+
+func (les *LocalEntityStore) GetEntity(appID string) (*authenticator.Entity, error) {
+
+	entity, err := les.get(appID)
+	if err != nil {
+		return nil, err
+	}
+
+	return les.convert(entity)
+}
+
+func (les *LocalEntityStore) UpdateEntityKey(appID string, key string) error {
+
+	if len(key) == 0 {
+		return errors.New("InvalidKey")
+	}
+
+	les.mutex.Lock()
+	defer les.mutex.Unlock()
+
+	entity, err := les.get(appID)
+	if err != nil {
+		return err
+	}
+
+	err = les.seal(entity, key)
+	if err != nil {
+		return err
+	}
+
+	entity.UpdatedAt = time.Now()
+
+	return les.put(entity)
+}
+
+// GetEntities returns entities in key order from startID and the total number of entities
+func (les *LocalEntityStore) GetEntities(startID string, count int64) ([]*authenticator.Entity, int64, error) {
+
+	store, err := les.controller.store.GetEngine().GetStore("gravity_controller")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	entities := make([]*authenticator.Entity, 0)
+	total := int64(0)
+	err = store.List("entities", []byte(""), func(key []byte, value []byte) bool {
+
+		total++
+
+		if string(key) < startID || (count > 0 && int64(len(entities)) >= count) {
+			return true
+		}
+
+		var entity LocalEntity
+		err := json.Unmarshal(value, &entity)
+		if err != nil {
+			log.Errorf("Unrecognized entity: %s", string(key))
+			return true
+		}
+
+		entity.Properties = normalizeProperties(entity.Properties)
+
+		e, err := les.convert(&entity)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"appID": entity.AppID,
+			}).Error("Failed to decrypt access key")
+			return true
+		}
+
+		entities = append(entities, e)
+
+		return true
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return entities, total, nil
+}
@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/BrobridgeOrg/gravity-controller/pkg/config"
+	"github.com/BrobridgeOrg/gravity-sdk/core/keyring"
+)
+
+func newEntityStoreController(accessKey string, previousAccessKey string) *Controller {
+
+	controller := &Controller{
+		keyring: keyring.NewKeyring(),
+	}
+
+	c := &config.Config{}
+	c.Gravity.AccessKey = accessKey
+	c.Gravity.PreviousAccessKey = previousAccessKey
+	controller.config.Store(c)
+
+	controller.keyring.Put("gravity", accessKey)
+	controller.keyringStore = NewKeyringStore(controller)
+
+	return controller
+}
+
+func TestLocalEntityKeyEnvelope(t *testing.T) {
+
+	tests := []struct {
+		name              string
+		accessKey         string
+		previousAccessKey string
+		modify            func(entity *LocalEntity)
+		rekey             bool
+		err               bool
+	}{
+		{"current key", "old", "", func(entity *LocalEntity) {}, false, false},
+		{"previous key", "new", "old", func(entity *LocalEntity) {}, true, false},
+		{"unknown key", "new", "", func(entity *LocalEntity) {}, false, true},
+		{"wrong previous key", "new", "other", func(entity *LocalEntity) {}, false, true},
+		{"tampered checksum", "old", "", func(entity *LocalEntity) { entity.Checksum[0] ^= 0xff }, false, true},
+		{"without checksum", "old", "", func(entity *LocalEntity) { entity.Checksum = nil }, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			// Entities are always sealed by key "old"
+			entity := &LocalEntity{AppID: "app"}
+			err := NewLocalEntityStore(newEntityStoreController("old", "")).seal(entity, "secret")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tt.modify(entity)
+
+			les := NewLocalEntityStore(newEntityStoreController(tt.accessKey, tt.previousAccessKey))
+			key, rekey, err := les.open(entity)
+			if tt.err {
+				if err == nil {
+					t.Errorf("open() = %s, want error", key)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if key != "secret" || rekey != tt.rekey {
+				t.Errorf("open() = %s, %v, want secret, %v", key, rekey, tt.rekey)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	events_pb "github.com/BrobridgeOrg/gravity-controller/pkg/api/events"
+	"github.com/golang/protobuf/proto"
+	log "github.com/sirupsen/logrus"
+)
+
+//go:generate protoc -I ../../api --go_out=../../api --go_opt=paths=source_relative events/events.proto
+
+// Event types, see pkg/api/events/events.proto for the wire schema
+const (
+	EventSynchronizerRegistered  = "synchronizerRegistered"
+	EventSynchronizerExpired     = "synchronizerExpired"
+	EventPipelineAssigned        = "pipelineAssigned"
+	EventPipelineRevoked         = "pipelineRevoked"
+	EventPipelineReleased        = "pipelineReleased"
+	EventSubscriberRegistered    = "subscriberRegistered"
+	EventSubscriberUnregistered  = "subscriberUnregistered"
+	EventCollectionRegistered    = "collectionRegistered"
+	EventCollectionUnregistered  = "collectionUnregistered"
+	EventCollectionSchemaUpdated = "collectionSchemaUpdated"
+	EventCollectionUpdated       = "collectionUpdated"
+	EventAdapterStale            = "adapterStale"
+	EventKeyringUpdated          = "keyringUpdated"
+	EventKeyringRevoked          = "keyringRevoked"
+)
+
+type EventPublisher struct {
+	controller *Controller
+}
+
+func NewEventPublisher(controller *Controller) *EventPublisher {
+	return &EventPublisher{
+		controller: controller,
+	}
+}
+
+func (ep *EventPublisher) Publish(event *events_pb.Event) {
+
+	conn := ep.controller.gravityClient.GetConnection()
+	if conn == nil {
+		return
+	}
+
+	event.Timestamp = time.Now().UnixNano()
+	event.ControllerID = ep.controller.clientID
+
+	data, err := proto.Marshal(event)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	channel := fmt.Sprintf("%s.controller.events.%s", ep.controller.domain, event.Type)
+	err = conn.Publish(channel, data)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"type": event.Type,
+		}).Error(err)
+	}
+}
+
+func (ep *EventPublisher) PublishSynchronizer(eventType string, synchronizerID string) {
+	ep.Publish(&events_pb.Event{
+		Type: eventType,
+		Body: &events_pb.Event_Synchronizer{
+			Synchronizer: &events_pb.SynchronizerEvent{
+				SynchronizerID: synchronizerID,
+			},
+		},
+	})
+}
+
+func (ep *EventPublisher) PublishPipeline(eventType string, synchronizerID string, pipelineID uint64) {
+	ep.Publish(&events_pb.Event{
+		Type: eventType,
+		Body: &events_pb.Event_Pipeline{
+			Pipeline: &events_pb.PipelineEvent{
+				PipelineID:     pipelineID,
+				SynchronizerID: synchronizerID,
+			},
+		},
+	})
+}
+
+func (ep *EventPublisher) PublishSubscriber(eventType string, subscriber *Subscriber) {
+
+	appID := ""
+	if v, ok := subscriber.properties["auth.appID"]; ok {
+		appID, _ = v.(string)
+	}
+
+	ep.Publish(&events_pb.Event{
+		Type: eventType,
+		Body: &events_pb.Event_Subscriber{
+			Subscriber: &events_pb.SubscriberEvent{
+				SubscriberID: subscriber.id,
+				Name:         subscriber.name,
+				Component:    subscriber.component,
+				AppID:        appID,
+			},
+		},
+	})
+}
+
+func (ep *EventPublisher) PublishCollection(eventType string, collectionID string) {
+	ep.Publish(&events_pb.Event{
+		Type: eventType,
+		Body: &events_pb.Event_Collection{
+			Collection: &events_pb.CollectionEvent{
+				CollectionID: collectionID,
+			},
+		},
+	})
+}
+
+// NotifySubscribers sends collection event to subscribers directly on "<domain>.subscriber.<subscriberID>.events.<type>"
+func (ep *EventPublisher) NotifySubscribers(eventType string, collectionID string, subscribers []*Subscriber) {
+
+	conn := ep.controller.gravityClient.GetConnection()
+	if conn == nil {
+		return
+	}
+
+	event := &events_pb.Event{
+		Type:         eventType,
+		Timestamp:    time.Now().UnixNano(),
+		ControllerID: ep.controller.clientID,
+		Body: &events_pb.Event_Collection{
+			Collection: &events_pb.CollectionEvent{
+				CollectionID: collectionID,
+			},
+		},
+	}
+
+	data, err := proto.Marshal(event)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	for _, subscriber := range subscribers {
+		channel := fmt.Sprintf("%s.subscriber.%s.events.%s", ep.controller.domain, subscriber.id, eventType)
+		err = conn.Publish(channel, data)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"type":       eventType,
+				"subscriber": subscriber.id,
+			}).Error(err)
+		}
+	}
+}
+
+func (ep *EventPublisher) PublishAdapter(eventType string, adapter *Adapter) {
+	ep.Publish(&events_pb.Event{
+		Type: eventType,
+		Body: &events_pb.Event_Adapter{
+			Adapter: &events_pb.AdapterEvent{
+				AdapterID: adapter.id,
+				Name:      adapter.name,
+				Component: adapter.component,
+			},
+		},
+	})
+}
+
+func (ep *EventPublisher) PublishKeyring(eventType string, appID string, permissions []string) {
+	ep.Publish(&events_pb.Event{
+		Type: eventType,
+		Body: &events_pb.Event_Keyring{
+			Keyring: &events_pb.KeyringEvent{
+				AppID:       appID,
+				Permissions: permissions,
+			},
+		},
+	})
+}
@@ -0,0 +1,234 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/BrobridgeOrg/gravity-sdk/core/keyring"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrKeyNotLoaded = errors.New("key rotation: key is not loaded")
+)
+
+type RotationEntry struct {
+	AppID     string    `json:"appID"`
+	Key       []byte    `json:"key"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type rotation struct {
+	key   *keyring.KeyInfo
+	timer *time.Timer
+}
+
+// KeyRotation keeps previous keys of entities valid for a grace period after
+// rotation, on controller and synchronizers both.
+type KeyRotation struct {
+	controller *Controller
+	rotations  map[string]*rotation
+	mutex      sync.RWMutex
+}
+
+func NewKeyRotation(controller *Controller) *KeyRotation {
+	return &KeyRotation{
+		controller: controller,
+		rotations:  make(map[string]*rotation),
+	}
+}
+
+func (kr *KeyRotation) Initialize() error {
+
+	store, err := kr.controller.store.GetEngine().GetStore("gravity_controller")
+	if err != nil {
+		return err
+	}
+
+	err = store.RegisterColumns([]string{"rotations"})
+	if err != nil {
+		return err
+	}
+
+	systemKey := kr.controller.keyring.Get("gravity")
+
+	log.Info("Trying to restoring key rotations...")
+
+	return store.List("rotations", []byte(""), func(key []byte, value []byte) bool {
+
+		var entry RotationEntry
+		err := json.Unmarshal(value, &entry)
+		if err != nil {
+			log.Errorf("Unrecognized rotation entry: %s", string(key))
+			return true
+		}
+
+		if systemKey == nil || time.Now().After(entry.ExpiresAt) {
+			store.Delete("rotations", key)
+			return true
+		}
+
+		prevKey, err := systemKey.Encryption().Decrypt(entry.Key)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"appID": entry.AppID,
+			}).Error("Failed to decrypt previous key")
+			return true
+		}
+
+		kr.schedule(entry.AppID, keyring.NewKey(entry.AppID, string(prevKey)), entry.ExpiresAt)
+
+		log.WithFields(log.Fields{
+			"appID":     entry.AppID,
+			"expiresAt": entry.ExpiresAt,
+		}).Info("Restored key rotation")
+
+		return true
+	})
+}
+
+func (kr *KeyRotation) getGracePeriod() time.Duration {
+	return time.Duration(kr.controller.getConfig().AuthService.KeyRotationGracePeriod) * time.Second
+}
+
+func (kr *KeyRotation) schedule(appID string, prevKey *keyring.KeyInfo, expiresAt time.Time) {
+
+	kr.mutex.Lock()
+	defer kr.mutex.Unlock()
+
+	if r, ok := kr.rotations[appID]; ok {
+		r.timer.Stop()
+	}
+
+	kr.rotations[appID] = &rotation{
+		key: prevKey,
+		timer: time.AfterFunc(time.Until(expiresAt), func() {
+			kr.Finalize(appID)
+		}),
+	}
+}
+
+// Rotate replaces key of entity in keyring and keeps the previous one valid for
+// grace period. ErrKeyNotLoaded is returned if entity has never authenticated,
+// there is no previous key then and the new key is loaded on authentication.
+func (kr *KeyRotation) Rotate(appID string, newKey string) error {
+
+	current := kr.controller.keyring.Get(appID)
+	if current == nil {
+		return ErrKeyNotLoaded
+	}
+
+	// New key inherits permissions
+	key := keyring.NewKey(appID, newKey)
+	key.Permission().AddPermissions(current.Permission().GetPermissions())
+	key.Collection().AddCollections(current.Collection().GetCollections())
+	kr.controller.keyring.GetKeys().Store(appID, key)
+
+	err := kr.controller.keyringStore.Update(key)
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(kr.getGracePeriod())
+	prevKey := keyring.NewKey(appID, string(current.Encryption().GetKey()))
+	kr.schedule(appID, prevKey, expiresAt)
+
+	err = kr.save(appID, prevKey, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"appID":     appID,
+		"expiresAt": expiresAt,
+	}).Info("Rotated entity key")
+
+	return kr.controller.synchronizerManager.UpdateKeyring(key)
+}
+
+// Finalize invalidates previous key of entity
+func (kr *KeyRotation) Finalize(appID string) error {
+
+	kr.mutex.Lock()
+	r, ok := kr.rotations[appID]
+	if ok {
+		r.timer.Stop()
+		delete(kr.rotations, appID)
+	}
+	kr.mutex.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	err := kr.delete(appID)
+	if err != nil {
+		log.Error(err)
+	}
+
+	log.WithFields(log.Fields{
+		"appID": appID,
+	}).Info("Finalized key rotation")
+
+	// Withdraw previous key from synchronizers, nothing to push if key was revoked
+	key := kr.controller.keyring.Get(appID)
+	if key == nil {
+		return nil
+	}
+
+	return kr.controller.synchronizerManager.UpdateKeyring(key)
+}
+
+func (kr *KeyRotation) GetPreviousKey(appID string) *keyring.KeyInfo {
+
+	kr.mutex.RLock()
+	defer kr.mutex.RUnlock()
+
+	r, ok := kr.rotations[appID]
+	if !ok {
+		return nil
+	}
+
+	return r.key
+}
+
+func (kr *KeyRotation) save(appID string, prevKey *keyring.KeyInfo, expiresAt time.Time) error {
+
+	systemKey, err := kr.controller.keyringStore.getSystemKey()
+	if err != nil {
+		return err
+	}
+
+	encrypted, err := systemKey.Encryption().Encrypt(prevKey.Encryption().GetKey())
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(&RotationEntry{
+		AppID:     appID,
+		Key:       encrypted,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	store, err := kr.controller.store.GetEngine().GetStore("gravity_controller")
+	if err != nil {
+		return err
+	}
+
+	return store.Put("rotations", []byte(appID), data)
+}
+
+func (kr *KeyRotation) delete(appID string) error {
+
+	store, err := kr.controller.store.GetEngine().GetStore("gravity_controller")
+	if err != nil {
+		return err
+	}
+
+	return store.Delete("rotations", []byte(appID))
+}
@@ -0,0 +1,503 @@
+package controller
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BrobridgeOrg/gravity-sdk/core/keyring"
+	log "github.com/sirupsen/logrus"
+)
+
+// Revoked keys are sent to synchronizers which register until they expire, the
+// oldest ones are dropped once there are more than MaxRevocations.
+const (
+	DefaultRevocationTTL = 7 * 24 * time.Hour
+	MaxRevocations       = 1000
+)
+
+var (
+	ErrKeyringChecksum      = errors.New("keyring store: checksum mismatch")
+	ErrUndecryptableKeyring = errors.New("keyring store: keys cannot be decrypted with gravity.accessKey, set gravity.previousAccessKey to re-encrypt them")
+)
+
+type KeyringEntry struct {
+	AppID       string   `json:"appID"`
+	Key         []byte   `json:"key"`
+	Checksum    []byte   `json:"checksum,omitempty"`
+	Permissions []string `json:"permissions"`
+	Collections []string `json:"collections"`
+	Refs        int      `json:"refs"`
+}
+
+// KeyringStore persists keys which were put into keyring at runtime, keys from
+// configurations (gravity, anonymous) are not managed here.
+type KeyringStore struct {
+	controller *Controller
+	mutex      sync.Mutex
+}
+
+// isConfigurationKey returns true if key of app comes from configurations
+func isConfigurationKey(appID string) bool {
+	return appID == "gravity" || appID == "anonymous"
+}
+
+func NewKeyringStore(controller *Controller) *KeyringStore {
+	return &KeyringStore{
+		controller: controller,
+	}
+}
+
+func (ks *KeyringStore) Initialize() error {
+
+	store, err := ks.controller.store.GetEngine().GetStore("gravity_controller")
+	if err != nil {
+		return err
+	}
+
+	return store.RegisterColumns([]string{"keyring", "revocations"})
+}
+
+func (ks *KeyringStore) getSystemKey() (*keyring.KeyInfo, error) {
+
+	keyInfo := ks.controller.keyring.Get("gravity")
+	if keyInfo == nil {
+		return nil, errors.New("No access key for gravity")
+	}
+
+	return keyInfo, nil
+}
+
+// keyringChecksum binds access key to the key of gravity which encrypted it,
+// decrypting with another key does not fail but returns garbage.
+func keyringChecksum(systemKey string, appID string, accessKey []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(systemKey))
+	mac.Write([]byte(appID))
+	mac.Write(accessKey)
+	return mac.Sum(nil)
+}
+
+func openKeyringEntry(systemKey string, entry *KeyringEntry) ([]byte, error) {
+
+	accessKey, err := keyring.NewKey("gravity", systemKey).Encryption().Decrypt(entry.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Entries which were saved by older versions have no checksum
+	if entry.Checksum == nil {
+		return accessKey, nil
+	}
+
+	if !hmac.Equal(entry.Checksum, keyringChecksum(systemKey, entry.AppID, accessKey)) {
+		return nil, ErrKeyringChecksum
+	}
+
+	return accessKey, nil
+}
+
+// decrypt returns access key of entry, entries which were encrypted with
+// previous key of gravity are reported so they can be re-encrypted.
+func (ks *KeyringStore) decrypt(entry *KeyringEntry) (accessKey []byte, rekey bool, err error) {
+
+	gravityConfig := ks.controller.getConfig().Gravity
+
+	accessKey, err = openKeyringEntry(gravityConfig.AccessKey, entry)
+	if err == nil {
+		return accessKey, false, nil
+	}
+
+	if len(gravityConfig.PreviousAccessKey) == 0 {
+		return nil, false, err
+	}
+
+	accessKey, err = openKeyringEntry(gravityConfig.PreviousAccessKey, entry)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return accessKey, true, nil
+}
+
+func (ks *KeyringStore) get(appID string) (*KeyringEntry, error) {
+
+	store, err := ks.controller.store.GetEngine().GetStore("gravity_controller")
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := store.GetBytes("keyring", []byte(appID))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var entry KeyringEntry
+	err = json.Unmarshal(data, &entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entry, nil
+}
+
+func (ks *KeyringStore) put(entry *KeyringEntry) error {
+
+	store, err := ks.controller.store.GetEngine().GetStore("gravity_controller")
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	return store.Put("keyring", []byte(entry.AppID), data)
+}
+
+// seal encrypts access key by gravity key and returns it with checksum
+func (ks *KeyringStore) seal(appID string, accessKey []byte) (encrypted []byte, checksum []byte, err error) {
+
+	systemKey, err := ks.getSystemKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	encrypted, err = systemKey.Encryption().Encrypt(accessKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return encrypted, keyringChecksum(ks.controller.getConfig().Gravity.AccessKey, appID, accessKey), nil
+}
+
+func (ks *KeyringStore) save(key *keyring.KeyInfo, refs int) error {
+
+	encrypted, checksum, err := ks.seal(key.GetAppID(), key.Encryption().GetKey())
+	if err != nil {
+		return err
+	}
+
+	return ks.put(&KeyringEntry{
+		AppID:       key.GetAppID(),
+		Key:         encrypted,
+		Checksum:    checksum,
+		Permissions: key.Permission().GetPermissions(),
+		Collections: key.Collection().GetCollections(),
+		Refs:        refs,
+	})
+}
+
+// Ref saves key and increases its reference count, keys from configurations
+// are skipped
+func (ks *KeyringStore) Ref(key *keyring.KeyInfo) error {
+
+	if isConfigurationKey(key.GetAppID()) {
+		return nil
+	}
+
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+
+	entry, err := ks.get(key.GetAppID())
+	if err != nil {
+		return err
+	}
+
+	refs := 1
+	if entry != nil {
+		refs = entry.Refs + 1
+	}
+
+	// Key is valid again
+	err = ks.removeRevocation(key.GetAppID())
+	if err != nil {
+		return err
+	}
+
+	return ks.save(key, refs)
+}
+
+// Update saves latest key information without touching reference count
+func (ks *KeyringStore) Update(key *keyring.KeyInfo) error {
+
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+
+	entry, err := ks.get(key.GetAppID())
+	if err != nil {
+		return err
+	}
+
+	if entry == nil {
+		return nil
+	}
+
+	return ks.save(key, entry.Refs)
+}
+
+// Unref decreases reference count and removes entry when nobody uses it, it
+// returns true if entry was removed.
+func (ks *KeyringStore) Unref(appID string) (bool, error) {
+
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+
+	entry, err := ks.get(appID)
+	if err != nil {
+		return false, err
+	}
+
+	if entry == nil {
+		return false, nil
+	}
+
+	entry.Refs--
+	if entry.Refs > 0 {
+		return false, ks.put(entry)
+	}
+
+	return true, ks.delete(appID)
+}
+
+func (ks *KeyringStore) Delete(appID string) error {
+
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+
+	return ks.delete(appID)
+}
+
+func (ks *KeyringStore) delete(appID string) error {
+
+	store, err := ks.controller.store.GetEngine().GetStore("gravity_controller")
+	if err != nil {
+		return err
+	}
+
+	return store.Delete("keyring", []byte(appID))
+}
+
+// Restore loads persisted entries into keyring, it fails if any of them cannot
+// be decrypted because keys would be lost silently otherwise.
+func (ks *KeyringStore) Restore() ([]*keyring.KeyInfo, error) {
+
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+
+	store, err := ks.controller.store.GetEngine().GetStore("gravity_controller")
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("Trying to restoring keyring...")
+
+	keys := make([]*keyring.KeyInfo, 0)
+	rekeys := make(map[*keyring.KeyInfo]int)
+	failed := make([]string, 0)
+	err = store.List("keyring", []byte(""), func(key []byte, value []byte) bool {
+
+		var entry KeyringEntry
+		err := json.Unmarshal(value, &entry)
+		if err != nil {
+			log.Errorf("Unrecognized keyring entry: %s", string(key))
+			return true
+		}
+
+		// Keys from configurations are never restored, they follow current settings
+		if isConfigurationKey(entry.AppID) {
+			log.WithFields(log.Fields{
+				"appID": entry.AppID,
+			}).Warn("Ignored persisted key of configurations")
+			return true
+		}
+
+		accessKey, rekey, err := ks.decrypt(&entry)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"appID": entry.AppID,
+			}).Error("Failed to decrypt access key")
+			failed = append(failed, entry.AppID)
+			return true
+		}
+
+		// Keyring counts references on every put
+		var keyInfo *keyring.KeyInfo
+		for i := 0; i < entry.Refs; i++ {
+			keyInfo = ks.controller.keyring.Put(entry.AppID, string(accessKey))
+		}
+
+		if keyInfo == nil {
+			return true
+		}
+
+		keyInfo.Permission().AddPermissions(entry.Permissions)
+		keyInfo.Collection().AddCollections(entry.Collections)
+
+		log.WithFields(log.Fields{
+			"appID": entry.AppID,
+			"refs":  entry.Refs,
+		}).Info("Restored key")
+
+		keys = append(keys, keyInfo)
+
+		if rekey {
+			rekeys[keyInfo] = entry.Refs
+		}
+
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(failed) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUndecryptableKeyring, strings.Join(failed, ", "))
+	}
+
+	// Entries are encrypted with current key of gravity from now on
+	for keyInfo, refs := range rekeys {
+		err := ks.save(keyInfo, refs)
+		if err != nil {
+			return nil, err
+		}
+
+		log.WithFields(log.Fields{
+			"appID": keyInfo.GetAppID(),
+		}).Info("Re-encrypted key with current access key")
+	}
+
+	return keys, nil
+}
+
+func (ks *KeyringStore) AddRevocation(appID string) error {
+
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+
+	store, err := ks.controller.store.GetEngine().GetStore("gravity_controller")
+	if err != nil {
+		return err
+	}
+
+	return store.Put("revocations", []byte(appID), []byte(time.Now().Format(time.RFC3339)))
+}
+
+func (ks *KeyringStore) removeRevocation(appID string) error {
+
+	store, err := ks.controller.store.GetEngine().GetStore("gravity_controller")
+	if err != nil {
+		return err
+	}
+
+	return store.Delete("revocations", []byte(appID))
+}
+
+type revocation struct {
+	appID     string
+	revokedAt time.Time
+}
+
+// GetRevocations returns revoked keys from the latest, expired ones are removed
+func (ks *KeyringStore) GetRevocations() ([]string, error) {
+
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+
+	store, err := ks.controller.store.GetEngine().GetStore("gravity_controller")
+	if err != nil {
+		return nil, err
+	}
+
+	expiry := time.Now().Add(-DefaultRevocationTTL)
+	revocations := make([]revocation, 0)
+	expired := make([]string, 0)
+	err = store.List("revocations", []byte(""), func(key []byte, value []byte) bool {
+
+		revokedAt, err := time.Parse(time.RFC3339, string(value))
+		if err != nil || revokedAt.Before(expiry) {
+			expired = append(expired, string(key))
+			return true
+		}
+
+		revocations = append(revocations, revocation{
+			appID:     string(key),
+			revokedAt: revokedAt,
+		})
+
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(revocations, func(i, j int) bool {
+		return revocations[i].revokedAt.After(revocations[j].revokedAt)
+	})
+
+	if len(revocations) > MaxRevocations {
+		for _, r := range revocations[MaxRevocations:] {
+			expired = append(expired, r.appID)
+		}
+
+		revocations = revocations[:MaxRevocations]
+	}
+
+	for _, appID := range expired {
+		err := ks.removeRevocation(appID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	appIDs := make([]string, 0, len(revocations))
+	for _, r := range revocations {
+		appIDs = append(appIDs, r.appID)
+	}
+
+	return appIDs, nil
+}
+
+// RevokeKey removes key from keyring and revokes it on all synchronizers
+func (controller *Controller) RevokeKey(appID string) error {
+
+	// Keys from configurations cannot be revoked
+	if isConfigurationKey(appID) {
+		return nil
+	}
+
+	controller.keyring.GetKeys().Delete(appID)
+
+	// Previous key is not valid anymore
+	controller.keyRotation.Finalize(appID)
+
+	err := controller.keyringStore.Delete(appID)
+	if err != nil {
+		return err
+	}
+
+	err = controller.keyringStore.AddRevocation(appID)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"appID": appID,
+	}).Info("Revoked key")
+
+	controller.sessions.RevokeApp(appID)
+	controller.synchronizerManager.RevokeKeyring(appID)
+	controller.events.PublishKeyring(EventKeyringRevoked, appID, []string{})
+
+	return nil
+}
@@ -0,0 +1,193 @@
+package controller
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+const maxLabelLength = 63
+
+var (
+	ErrInvalidLabels   = errors.New("InvalidLabels")
+	ErrInvalidSelector = errors.New("InvalidSelector")
+)
+
+var (
+	labelKeyPattern   = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]*[A-Za-z0-9])?$`)
+	labelValuePattern = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9._-]*[A-Za-z0-9])?)?$`)
+)
+
+func validateLabel(key string, value string) error {
+
+	if len(key) > maxLabelLength || !labelKeyPattern.MatchString(key) {
+		return ErrInvalidLabels
+	}
+
+	if len(value) > maxLabelLength || !labelValuePattern.MatchString(value) {
+		return ErrInvalidLabels
+	}
+
+	return nil
+}
+
+// PatchLabels returns a copy of labels with changes applied, label is removed if its value is null
+func PatchLabels(labels map[string]string, changes map[string]*string) (map[string]string, error) {
+
+	results := make(map[string]string, len(labels))
+	for key, value := range labels {
+		results[key] = value
+	}
+
+	for key, value := range changes {
+		if value == nil {
+			delete(results, key)
+			continue
+		}
+
+		err := validateLabel(key, *value)
+		if err != nil {
+			return nil, err
+		}
+
+		results[key] = *value
+	}
+
+	return results, nil
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+
+	results := make(map[string]string, len(labels))
+	for key, value := range labels {
+		results[key] = value
+	}
+
+	return results
+}
+
+// parseLabels converts labels which were decoded from JSON
+func parseLabels(v interface{}) map[string]string {
+
+	labels := make(map[string]string)
+
+	values, ok := v.(map[string]interface{})
+	if !ok {
+		return labels
+	}
+
+	for key, value := range values {
+		if s, ok := value.(string); ok {
+			labels[key] = s
+		}
+	}
+
+	return labels
+}
+
+type labelRequirement struct {
+	key      string
+	operator string
+	value    string
+}
+
+// LabelSelector matches labels with requirements which are separated by
+// comma, such as "team=data,env!=prod,tier,!legacy".
+type LabelSelector struct {
+	requirements []*labelRequirement
+}
+
+func ParseLabelSelector(selector string) (*LabelSelector, error) {
+
+	ls := &LabelSelector{
+		requirements: make([]*labelRequirement, 0),
+	}
+
+	selector = strings.TrimSpace(selector)
+	if len(selector) == 0 {
+		return ls, nil
+	}
+
+	for _, term := range strings.Split(selector, ",") {
+
+		term = strings.TrimSpace(term)
+
+		req := &labelRequirement{}
+		switch {
+		case strings.Contains(term, "!="):
+			parts := strings.SplitN(term, "!=", 2)
+			req.key, req.operator, req.value = parts[0], "!=", parts[1]
+		case strings.Contains(term, "=="):
+			parts := strings.SplitN(term, "==", 2)
+			req.key, req.operator, req.value = parts[0], "=", parts[1]
+		case strings.Contains(term, "="):
+			parts := strings.SplitN(term, "=", 2)
+			req.key, req.operator, req.value = parts[0], "=", parts[1]
+		case strings.HasPrefix(term, "!"):
+			req.key, req.operator = term[1:], "!"
+		default:
+			req.key, req.operator = term, "exists"
+		}
+
+		req.key = strings.TrimSpace(req.key)
+		req.value = strings.TrimSpace(req.value)
+
+		if validateLabel(req.key, req.value) != nil {
+			return nil, ErrInvalidSelector
+		}
+
+		ls.requirements = append(ls.requirements, req)
+	}
+
+	return ls, nil
+}
+
+// Matches returns true if labels satisfy all requirements, empty selector matches everything
+func (ls *LabelSelector) Matches(labels map[string]string) bool {
+
+	if ls == nil {
+		return true
+	}
+
+	for _, req := range ls.requirements {
+
+		value, ok := labels[req.key]
+
+		switch req.operator {
+		case "=":
+			if !ok || value != req.value {
+				return false
+			}
+		case "!=":
+			if ok && value == req.value {
+				return false
+			}
+		case "!":
+			if ok {
+				return false
+			}
+		case "exists":
+			if !ok {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// SetLabelsRequest changes labels of a resource, label is removed if its value is null
+type SetLabelsRequest struct {
+	ID     string             `json:"id"`
+	Labels map[string]*string `json:"labels"`
+}
+
+type SetLabelsReply struct {
+	Success bool              `json:"success"`
+	Reason  string            `json:"reason,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+type ListRequest struct {
+	Selector string `json:"selector"`
+}
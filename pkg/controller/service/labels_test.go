@@ -0,0 +1,165 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLabelSelector(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		selector string
+		expected []labelRequirement
+		err      error
+	}{
+		{"empty", "", []labelRequirement{}, nil},
+		{"blank", "   ", []labelRequirement{}, nil},
+		{"equal", "team=data", []labelRequirement{{"team", "=", "data"}}, nil},
+		{"double equal", "team==data", []labelRequirement{{"team", "=", "data"}}, nil},
+		{"not equal", "env!=prod", []labelRequirement{{"env", "!=", "prod"}}, nil},
+		{"exists", "tier", []labelRequirement{{"tier", "exists", ""}}, nil},
+		{"not exists", "!legacy", []labelRequirement{{"legacy", "!", ""}}, nil},
+		{"empty value", "team=", []labelRequirement{{"team", "=", ""}}, nil},
+		{"prefixed key", "gravity.io/team=data", []labelRequirement{{"gravity.io/team", "=", "data"}}, nil},
+		{
+			"multiple requirements with spaces",
+			" team = data , env!=prod,tier, !legacy ",
+			[]labelRequirement{
+				{"team", "=", "data"},
+				{"env", "!=", "prod"},
+				{"tier", "exists", ""},
+				{"legacy", "!", ""},
+			},
+			nil,
+		},
+		{"empty term", "team=data,", nil, ErrInvalidSelector},
+		{"missing key", "=data", nil, ErrInvalidSelector},
+		{"invalid key", "-team=data", nil, ErrInvalidSelector},
+		{"invalid value", "team=data!", nil, ErrInvalidSelector},
+		{"space in value", "team=big data", nil, ErrInvalidSelector},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ls, err := ParseLabelSelector(tt.selector)
+			if err != tt.err {
+				t.Fatalf("ParseLabelSelector(%q) error = %v, want %v", tt.selector, err, tt.err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if len(ls.requirements) != len(tt.expected) {
+				t.Fatalf("ParseLabelSelector(%q) has %d requirements, want %d", tt.selector, len(ls.requirements), len(tt.expected))
+			}
+
+			for i, req := range ls.requirements {
+				if *req != tt.expected[i] {
+					t.Errorf("requirement %d = %+v, want %+v", i, *req, tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLabelSelectorMatches(t *testing.T) {
+
+	labels := map[string]string{
+		"team": "data",
+		"env":  "staging",
+		"tier": "",
+	}
+
+	tests := []struct {
+		name     string
+		selector string
+		labels   map[string]string
+		expected bool
+	}{
+		{"empty selector", "", labels, true},
+		{"empty selector without labels", "", nil, true},
+		{"equal", "team=data", labels, true},
+		{"equal mismatch", "team=ops", labels, false},
+		{"equal missing label", "owner=data", labels, false},
+		{"equal empty value", "tier=", labels, true},
+		{"not equal", "env!=prod", labels, true},
+		{"not equal mismatch", "env!=staging", labels, false},
+		{"not equal missing label", "owner!=data", labels, true},
+		{"exists", "tier", labels, true},
+		{"exists missing label", "owner", labels, false},
+		{"not exists", "!owner", labels, true},
+		{"not exists mismatch", "!team", labels, false},
+		{"all requirements", "team=data,env!=prod,tier,!owner", labels, true},
+		{"one requirement fails", "team=data,env=prod", labels, false},
+		{"without labels", "team=data", nil, false},
+		{"negations without labels", "env!=prod,!team", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ls, err := ParseLabelSelector(tt.selector)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if matched := ls.Matches(tt.labels); matched != tt.expected {
+				t.Errorf("Matches(%v) with %q = %v, want %v", tt.labels, tt.selector, matched, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNilLabelSelectorMatches(t *testing.T) {
+
+	var ls *LabelSelector
+	if !ls.Matches(map[string]string{"team": "data"}) {
+		t.Error("nil selector does not match")
+	}
+}
+
+func TestPatchLabels(t *testing.T) {
+
+	value := func(s string) *string {
+		return &s
+	}
+
+	labels := map[string]string{
+		"team": "data",
+		"env":  "staging",
+	}
+
+	tests := []struct {
+		name     string
+		changes  map[string]*string
+		expected map[string]string
+		err      error
+	}{
+		{"no changes", nil, map[string]string{"team": "data", "env": "staging"}, nil},
+		{"add", map[string]*string{"tier": value("gold")}, map[string]string{"team": "data", "env": "staging", "tier": "gold"}, nil},
+		{"replace", map[string]*string{"env": value("prod")}, map[string]string{"team": "data", "env": "prod"}, nil},
+		{"remove", map[string]*string{"env": nil}, map[string]string{"team": "data"}, nil},
+		{"remove missing", map[string]*string{"owner": nil}, map[string]string{"team": "data", "env": "staging"}, nil},
+		{"invalid key", map[string]*string{"bad key": value("x")}, nil, ErrInvalidLabels},
+		{"invalid value", map[string]*string{"team": value("-data")}, nil, ErrInvalidLabels},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := PatchLabels(labels, tt.changes)
+			if err != tt.err {
+				t.Fatalf("PatchLabels() error = %v, want %v", err, tt.err)
+			}
+
+			if err == nil && !reflect.DeepEqual(results, tt.expected) {
+				t.Errorf("PatchLabels() = %v, want %v", results, tt.expected)
+			}
+
+			// Original labels are never touched
+			if len(labels) != 2 || labels["env"] != "staging" {
+				t.Fatalf("original labels were changed: %v", labels)
+			}
+		})
+	}
+}
@@ -0,0 +1,286 @@
+package controller
+
+import (
+	"crypto/x509"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultConnectRetryInterval = 1000 * time.Millisecond
+	MaxConnectRetryInterval     = 30 * time.Second
+)
+
+var (
+	ErrInvalidConnectionOptions = errors.New("controller: invalid connection options")
+	ErrShuttingDown             = errors.New("controller: shutting down")
+)
+
+// Errors replied by server which are not going to change without fixing configs
+var fatalConnectErrors = []error{
+	nats.ErrAuthorization,
+	nats.ErrAuthExpired,
+	nats.ErrAuthRevoked,
+	nats.ErrNkeysNotSupported,
+}
+
+type State int32
+
+const (
+	StateConnecting State = iota
+	StateRestoring
+	StateServing
+	StateDegraded
+)
+
+func (state State) String() string {
+	switch state {
+	case StateConnecting:
+		return "Connecting"
+	case StateRestoring:
+		return "Restoring"
+	case StateServing:
+		return "Serving"
+	case StateDegraded:
+		return "Degraded"
+	}
+
+	return "Unknown"
+}
+
+func (controller *Controller) GetState() State {
+	return State(atomic.LoadInt32(&controller.state))
+}
+
+// IsServing tells whether requests are able to be handled, they are rejected
+// while connecting, restoring states or degraded.
+func (controller *Controller) IsServing() bool {
+	return controller.GetState() == StateServing
+}
+
+func (controller *Controller) setState(state State) {
+
+	prev := State(atomic.SwapInt32(&controller.state, int32(state)))
+	if prev == state {
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"from": prev.String(),
+		"to":   state.String(),
+	}).Info("Controller state changed")
+}
+
+// Errors returns a channel which receives errors the controller cannot recover from
+func (controller *Controller) Errors() <-chan error {
+	return controller.fatalErrors
+}
+
+func (controller *Controller) fail(err error) {
+
+	log.Error(err)
+
+	select {
+	case controller.fatalErrors <- err:
+	default:
+	}
+}
+
+// Close stops background tasks and releases resources
+func (controller *Controller) Close() {
+	controller.closeOnce.Do(func() {
+		close(controller.shutdown)
+		controller.audit.Close()
+		controller.gravityClient.Disconnect()
+	})
+}
+
+func (controller *Controller) start() {
+
+	err := controller.connect()
+	if err != nil {
+		if err != ErrShuttingDown {
+			controller.fail(err)
+		}
+		return
+	}
+
+	// Restoring states and start serving RPC
+	controller.setState(StateRestoring)
+	err = controller.initializeManagers()
+	if err != nil {
+		controller.fail(err)
+		return
+	}
+
+	controller.watchConnection()
+	controller.setState(StateServing)
+}
+
+// connect retries with exponential backoff until connected, errors which are
+// not going to be resolved by retrying are returned immediately.
+func (controller *Controller) connect() error {
+
+	controller.setState(StateConnecting)
+
+	interval := DefaultConnectRetryInterval
+	for {
+		err := controller.initializeClient()
+		if err == nil {
+			return nil
+		}
+
+		if isFatalConnectError(err) {
+			return err
+		}
+
+		log.WithFields(log.Fields{
+			"error":   err,
+			"retryIn": interval,
+		}).Warn("Failed to connect to gravity")
+
+		// Retry later
+		select {
+		case <-controller.shutdown:
+			return ErrShuttingDown
+		case <-time.After(interval):
+		}
+
+		interval *= 2
+		if interval > MaxConnectRetryInterval {
+			interval = MaxConnectRetryInterval
+		}
+	}
+}
+
+func isFatalConnectError(err error) bool {
+
+	if errors.Is(err, ErrInvalidConnectionOptions) {
+		return true
+	}
+
+	// Certificate of server is not trusted
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalidCert x509.CertificateInvalidError
+	if errors.As(err, &unknownAuthority) || errors.As(err, &hostname) || errors.As(err, &invalidCert) {
+		return true
+	}
+
+	// NATS replies auth errors with new error values, so compare messages
+	msg := strings.ToLower(err.Error())
+	for _, fatal := range fatalConnectErrors {
+		if errors.Is(err, fatal) || strings.Contains(msg, strings.TrimPrefix(fatal.Error(), "nats: ")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (controller *Controller) watchConnection() {
+
+	conn := controller.gravityClient.GetConnection()
+	if conn == nil {
+		return
+	}
+
+	conn.SetDisconnectErrHandler(func(nc *nats.Conn, err error) {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Warn("Disconnected from gravity")
+
+		controller.setState(StateDegraded)
+	})
+
+	conn.SetReconnectHandler(func(nc *nats.Conn) {
+		log.WithFields(log.Fields{
+			"server": nc.ConnectedUrl(),
+		}).Info("Reconnected to gravity")
+
+		// Subscriptions are restored by NATS on the same connection
+		controller.setState(StateServing)
+	})
+
+	conn.SetClosedHandler(func(nc *nats.Conn) {
+
+		// Closed on purpose
+		select {
+		case <-controller.shutdown:
+			return
+		default:
+		}
+
+		log.Warn("Connection to gravity was closed")
+
+		// Create a new connection and re-apply RPC handlers on it
+		go controller.restart()
+	})
+}
+
+func (controller *Controller) restart() {
+
+	controller.closeRPC()
+
+	err := controller.connect()
+	if err != nil {
+		if err != ErrShuttingDown {
+			controller.fail(err)
+		}
+		return
+	}
+
+	controller.setState(StateRestoring)
+	err = controller.applyRPC()
+	if err != nil {
+		controller.setState(StateDegraded)
+		controller.fail(err)
+		return
+	}
+
+	controller.watchConnection()
+	controller.setState(StateServing)
+}
+
+// closeRPC tears down RPC engines of previous connection. Engines subscribe
+// on the connection they were created with, closing it drops all of their
+// subscriptions so none of them keeps serving once engines are rebuilt.
+func (controller *Controller) closeRPC() {
+
+	conn := controller.gravityClient.GetConnection()
+	if conn == nil || conn.IsClosed() {
+		return
+	}
+
+	conn.Close()
+}
+
+// applyRPC registers RPC handlers of all managers on current connection
+func (controller *Controller) applyRPC() error {
+
+	initializers := []func() error{
+		controller.audit.initializeRPC,
+		controller.auth.InitializeRPC,
+		controller.roles.initializeRPC,
+		controller.sessions.initializeRPC,
+		controller.collectionManager.initializeRPC,
+		controller.adapterManager.initialize_rpc,
+		controller.synchronizerManager.initializeRPC,
+		controller.pipelineManager.initializeRPC,
+		controller.subscriberManager.initializeRPC,
+	}
+
+	for _, initialize := range initializers {
+		err := initialize()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
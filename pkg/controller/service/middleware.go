@@ -0,0 +1,20 @@
+package controller
+
+import (
+	"github.com/BrobridgeOrg/gravity-controller/pkg/controller/service/middleware"
+)
+
+func (controller *Controller) newMiddleware() *middleware.Middleware {
+	return middleware.NewMiddleware(map[string]interface{}{
+		"Availability": controller,
+		"RateLimit":    controller.rateLimiter,
+		"Authentication": &middleware.Authentication{
+			Enabled:  true,
+			Keyring:  controller.keyring,
+			Rotation: controller.keyRotation,
+			Roles:    controller.roles,
+			Replay:   controller.replayGuard,
+			Sessions: controller.sessions,
+		},
+	})
+}
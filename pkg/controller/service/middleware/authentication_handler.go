@@ -2,13 +2,34 @@ package middleware
 
 import (
 	"errors"
+	"strings"
 
 	"github.com/BrobridgeOrg/broc"
 	packet_pb "github.com/BrobridgeOrg/gravity-api/packet"
 	"github.com/BrobridgeOrg/gravity-sdk/core/keyring"
 	"github.com/golang/protobuf/proto"
+	log "github.com/sirupsen/logrus"
 )
 
+// Errors are replied as packet reason so clients are able to tell auth failures
+// from transport errors.
+var (
+	ErrUnknownApp       = errors.New("UnknownApp")
+	ErrPermissionDenied = errors.New("PermissionDenied")
+	ErrInvalidKey       = errors.New("InvalidKey")
+	ErrInvalidPayload   = errors.New("InvalidPayload")
+	ErrInvalidSession   = errors.New("InvalidSession")
+	ErrSessionExpired   = errors.New("SessionExpired")
+)
+
+// SessionPrefix marks packets which carry a session token instead of appID
+const SessionPrefix = "session."
+
+// SessionResolver returns key of session which was issued by controller
+type SessionResolver interface {
+	Resolve(token string) (*keyring.KeyInfo, error)
+}
+
 func (m *Middleware) RequiredAuth(rules ...string) broc.Handler {
 
 	auth, ok := m.middlewares["Authentication"].(*Authentication)
@@ -19,13 +40,120 @@ func (m *Middleware) RequiredAuth(rules ...string) broc.Handler {
 	return auth.RequiredAuth(rules...)
 }
 
+func (m *Middleware) RequiredMethod(method string) broc.Handler {
+
+	auth, ok := m.middlewares["Authentication"].(*Authentication)
+	if !ok {
+		return nil
+	}
+
+	return auth.RequiredMethod(method)
+}
+
+// KeyRotation provides keys which are still valid during rotation grace period
+type KeyRotation interface {
+	GetPreviousKey(appID string) *keyring.KeyInfo
+}
+
+// RoleResolver tells whether one of roles grants access to method
+type RoleResolver interface {
+	CheckMethod(roles []string, method string) bool
+}
+
 type Authentication struct {
-	Enabled bool
-	Keyring *keyring.Keyring
+	Enabled  bool
+	Keyring  *keyring.Keyring
+	Rotation KeyRotation
+	Roles    RoleResolver
+	Replay   *ReplayGuard
+	Sessions SessionResolver
+}
+
+// getKey finds key by appID, or by session token
+func (auth *Authentication) getKey(appID string) (*keyring.KeyInfo, error) {
+
+	if !strings.HasPrefix(appID, SessionPrefix) {
+		keyInfo := auth.Keyring.Get(appID)
+		if keyInfo == nil {
+			return nil, ErrUnknownApp
+		}
+
+		return keyInfo, nil
+	}
+
+	if auth.Sessions == nil {
+		return nil, ErrInvalidSession
+	}
+
+	return auth.Sessions.Resolve(appID)
+}
+
+func (auth *Authentication) decrypt(keyInfo *keyring.KeyInfo, data []byte) (*keyring.KeyInfo, []byte, error) {
+
+	decrypted, err := keyInfo.Encryption().Decrypt(data)
+	if err == nil {
+		return keyInfo, decrypted, nil
+	}
+
+	if auth.Rotation == nil {
+		return nil, nil, err
+	}
+
+	// Try previous key which is still in grace period
+	prevKey := auth.Rotation.GetPreviousKey(keyInfo.GetAppID())
+	if prevKey == nil {
+		return nil, nil, err
+	}
+
+	decrypted, err = prevKey.Encryption().Decrypt(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return prevKey, decrypted, nil
 }
 
 func (auth *Authentication) RequiredAuth(rules ...string) broc.Handler {
 
+	fields := log.Fields{
+		"rules": rules,
+	}
+
+	return auth.handle(fields, func(keyInfo *keyring.KeyInfo) bool {
+
+		if len(rules) == 0 {
+			return true
+		}
+
+		for _, rule := range rules {
+			if keyInfo.Permission().Check(rule) {
+				return true
+			}
+		}
+
+		return false
+	})
+}
+
+// RequiredMethod resolves roles of key to check whether method is allowed
+func (auth *Authentication) RequiredMethod(method string) broc.Handler {
+
+	fields := log.Fields{
+		"method": method,
+	}
+
+	return auth.handle(fields, func(keyInfo *keyring.KeyInfo) bool {
+
+		if auth.Roles == nil {
+			return false
+		}
+
+		return auth.Roles.CheckMethod(keyInfo.Permission().GetPermissions(), method)
+	})
+}
+
+func (auth *Authentication) handle(fields log.Fields, authorize func(*keyring.KeyInfo) bool) broc.Handler {
+
 	return func(ctx *broc.Context) (interface{}, error) {
 
 		if !auth.Enabled {
@@ -35,40 +163,49 @@ func (auth *Authentication) RequiredAuth(rules ...string) broc.Handler {
 		packet := ctx.Get("request").(*packet_pb.Packet)
 
 		// Using appID to find key info
-		keyInfo := auth.Keyring.Get(packet.AppID)
-		if keyInfo == nil {
-			// No such app ID
-			return nil, nil
+		keyInfo, err := auth.getKey(packet.AppID)
+		if err != nil {
+			logger := log.WithFields(fields)
+			if !strings.HasPrefix(packet.AppID, SessionPrefix) {
+				logger = logger.WithField("appID", packet.AppID)
+			}
+
+			logger.WithField("reason", err.Error()).Warn("Denied request from unknown app or session")
+			return nil, err
 		}
 
-		// check permissions
-		if len(rules) > 0 {
-			hasPerm := false
-			for _, rule := range rules {
-				if keyInfo.Permission().Check(rule) {
-					hasPerm = true
-				}
-			}
+		logger := log.WithFields(fields).WithField("appID", keyInfo.GetAppID())
 
-			// No permission
-			if !hasPerm {
-				return nil, nil
-			}
+		// check permissions
+		if !authorize(keyInfo) {
+			logger.Warn("Denied request without permission")
+			return nil, ErrPermissionDenied
 		}
 
 		ctx.Set("key", keyInfo)
 
-		// Decrypt
-		data, err := keyInfo.Encryption().Decrypt(packet.Payload)
+		// Decrypt with current key, or previous key during rotation
+		encryptionKey, data, err := auth.decrypt(keyInfo, packet.Payload)
 		if err != nil {
-			return nil, errors.New("InvalidKey")
+			logger.Warn("Denied request with invalid key")
+			return nil, ErrInvalidKey
+		}
+
+		// Reject stale or replayed packets
+		if auth.Replay != nil {
+			err = auth.Replay.Check(keyInfo.GetAppID(), data)
+			if err != nil {
+				logger.WithField("reason", err.Error()).Warn("Denied request which failed replay check")
+				return nil, err
+			}
 		}
 
 		// pass decrypted payload to next handler
 		var payload packet_pb.Payload
 		err = proto.Unmarshal(data, &payload)
 		if err != nil {
-			return nil, errors.New("InvalidPayload")
+			logger.Warn("Denied request with invalid payload")
+			return nil, ErrInvalidPayload
 		}
 
 		ctx.Set("payload", &payload)
@@ -82,9 +219,10 @@ func (auth *Authentication) RequiredAuth(rules ...string) broc.Handler {
 		}
 
 		// Encrypt
-		encrypted, err := keyInfo.Encryption().Encrypt(returnedData.([]byte))
+		encrypted, err := encryptionKey.Encryption().Encrypt(returnedData.([]byte))
 		if err != nil {
-			return nil, nil
+			logger.Error(err)
+			return nil, ErrInvalidKey
 		}
 
 		return encrypted, nil
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"errors"
+)
+
+var (
+	ErrServiceUnavailable = errors.New("ServiceUnavailable")
+)
+
+// Availability tells whether service is ready to handle requests
+type Availability interface {
+	IsServing() bool
+}
+
+func (m *Middleware) isAvailable() bool {
+
+	availability, ok := m.middlewares["Availability"].(Availability)
+	if !ok {
+		return true
+	}
+
+	return availability.IsServing()
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"path"
+
+	"github.com/BrobridgeOrg/gravity-sdk/core/keyring"
+)
+
+// Permissions which are allowed to access all collections
+var collectionAdminPermissions = []string{
+	"SYSTEM",
+	"ADMIN",
+}
+
+// CheckCollection returns true if key is granted to access collection. Entries
+// of collection allow-list can be wildcard patterns such as "*" or "orders.*".
+func CheckCollection(key *keyring.KeyInfo, collection string) bool {
+
+	if key == nil {
+		return false
+	}
+
+	for _, perm := range collectionAdminPermissions {
+		if key.Permission().Check(perm) {
+			return true
+		}
+	}
+
+	if key.Collection().Check(collection) {
+		return true
+	}
+
+	for _, pattern := range key.Collection().GetCollections() {
+		matched, err := path.Match(pattern, collection)
+		if err != nil {
+			continue
+		}
+
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FilterCollections splits collections into allowed and denied lists
+func FilterCollections(key *keyring.KeyInfo, collections []string) ([]string, []string) {
+
+	allowed := make([]string, 0, len(collections))
+	denied := make([]string, 0)
+	for _, collection := range collections {
+		if CheckCollection(key, collection) {
+			allowed = append(allowed, collection)
+			continue
+		}
+
+		denied = append(denied, collection)
+	}
+
+	return allowed, denied
+}
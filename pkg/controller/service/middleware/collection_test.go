@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/BrobridgeOrg/gravity-sdk/core/keyring"
+)
+
+func newCollectionKey(permissions []string, collections []string) *keyring.KeyInfo {
+	key := keyring.NewKey("app", "secret")
+	key.Permission().AddPermissions(permissions)
+	key.Collection().AddCollections(collections)
+	return key
+}
+
+func TestCheckCollection(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		permissions []string
+		collections []string
+		collection  string
+		expected    bool
+	}{
+		{"exact match", nil, []string{"orders"}, "orders", true},
+		{"not granted", nil, []string{"orders"}, "accounts", false},
+		{"wildcard all", nil, []string{"*"}, "accounts", true},
+		{"wildcard prefix", nil, []string{"orders.*"}, "orders.items", true},
+		{"wildcard prefix requires separator", nil, []string{"orders.*"}, "orders", false},
+		{"wildcard prefix mismatch", nil, []string{"orders.*"}, "accounts.items", false},
+		{"single character wildcard", nil, []string{"order?"}, "orders", true},
+		{"invalid pattern is ignored", nil, []string{"[orders"}, "orders", false},
+		{"system permission", []string{"SYSTEM"}, nil, "accounts", true},
+		{"admin permission", []string{"ADMIN"}, nil, "accounts", true},
+		{"other permission", []string{"SUBSCRIBER"}, nil, "accounts", false},
+		{"nothing granted", nil, nil, "orders", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := newCollectionKey(tt.permissions, tt.collections)
+			if allowed := CheckCollection(key, tt.collection); allowed != tt.expected {
+				t.Errorf("CheckCollection(%s) = %v, want %v", tt.collection, allowed, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCheckCollectionWithoutKey(t *testing.T) {
+	if CheckCollection(nil, "orders") {
+		t.Error("CheckCollection without key = true, want false")
+	}
+}
+
+func TestFilterCollections(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		collections []string
+		allowed     []string
+		denied      []string
+	}{
+		{"all allowed", []string{"orders", "orders.items"}, []string{"orders", "orders.items"}, []string{}},
+		{"some denied", []string{"orders", "accounts", "orders.items"}, []string{"orders", "orders.items"}, []string{"accounts"}},
+		{"all denied", []string{"accounts"}, []string{}, []string{"accounts"}},
+		{"empty", []string{}, []string{}, []string{}},
+	}
+
+	key := newCollectionKey(nil, []string{"orders", "orders.*"})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, denied := FilterCollections(key, tt.collections)
+			if !reflect.DeepEqual(allowed, tt.allowed) {
+				t.Errorf("allowed = %v, want %v", allowed, tt.allowed)
+			}
+
+			if !reflect.DeepEqual(denied, tt.denied) {
+				t.Errorf("denied = %v, want %v", denied, tt.denied)
+			}
+		})
+	}
+}
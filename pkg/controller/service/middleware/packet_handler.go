@@ -21,6 +21,14 @@ func (m *Middleware) PacketHandler(ctx *broc.Context) (interface{}, error) {
 
 	// Preparing packet
 	p := &packet_pb.Packet{}
+
+	// Reject requests until states were restored and connection is healthy
+	if !m.isAvailable() {
+		p.Error = true
+		p.Reason = ErrServiceUnavailable.Error()
+		return proto.Marshal(p)
+	}
+
 	data, err := ctx.Next()
 	if err != nil {
 		p.Error = true
@@ -0,0 +1,197 @@
+package middleware
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BrobridgeOrg/broc"
+	packet_pb "github.com/BrobridgeOrg/gravity-api/packet"
+	"github.com/BrobridgeOrg/gravity-sdk/core/keyring"
+	log "github.com/sirupsen/logrus"
+)
+
+// Buckets which are not used for a while are evicted even if they are not full
+const DefaultBucketIdleTimeout = 10 * time.Minute
+
+// Requests which are not authenticated yet are limited by the appID they claim,
+// in buckets which are separated from the ones of authenticated apps.
+const unauthenticatedPrefix = "unauthenticated/"
+
+var (
+	ErrRateLimited = errors.New("RateLimited")
+)
+
+func (m *Middleware) RateLimit(method string) broc.Handler {
+
+	rl, ok := m.middlewares["RateLimit"].(*RateLimiter)
+	if !ok {
+		return nil
+	}
+
+	return rl.Handler(method)
+}
+
+// Limit of token bucket, rate is the number of tokens refilled per second
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+type bucket struct {
+	limit     Limit
+	tokens    float64
+	updatedAt time.Time
+}
+
+func (b *bucket) refill(now time.Time) {
+
+	b.tokens += now.Sub(b.updatedAt).Seconds() * b.limit.Rate
+	if b.tokens > float64(b.limit.Burst) {
+		b.tokens = float64(b.limit.Burst)
+	}
+
+	b.updatedAt = now
+}
+
+// RateLimiter enforces token buckets per appID, and per appID and method if
+// method has its own limit.
+type RateLimiter struct {
+	enabled      bool
+	defaultLimit Limit
+	methods      map[string]Limit
+	buckets      map[string]*bucket
+	lastPruned   time.Time
+	mutex        sync.Mutex
+}
+
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		methods:    make(map[string]Limit),
+		buckets:    make(map[string]*bucket),
+		lastPruned: time.Now(),
+	}
+}
+
+// SetLimits replaces limits and resets all buckets
+func (rl *RateLimiter) SetLimits(enabled bool, defaultLimit Limit, methods map[string]Limit) {
+
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	rl.enabled = enabled
+	rl.defaultLimit = defaultLimit
+	rl.methods = methods
+	rl.buckets = make(map[string]*bucket)
+}
+
+func (rl *RateLimiter) getBucket(key string, limit Limit, now time.Time) *bucket {
+
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &bucket{
+			limit:     limit,
+			tokens:    float64(limit.Burst),
+			updatedAt: now,
+		}
+		rl.buckets[key] = b
+		return b
+	}
+
+	b.refill(now)
+
+	return b
+}
+
+// Allow takes a token from buckets of app and method
+func (rl *RateLimiter) Allow(appID string, method string) bool {
+
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	if !rl.enabled {
+		return true
+	}
+
+	now := time.Now()
+	rl.prune(now)
+
+	appBucket := rl.getBucket(appID, rl.defaultLimit, now)
+	if appBucket.tokens < 1 {
+		return false
+	}
+
+	limit, ok := rl.methods[method]
+	if !ok {
+		appBucket.tokens--
+		return true
+	}
+
+	methodBucket := rl.getBucket(appID+"/"+method, limit, now)
+	if methodBucket.tokens < 1 {
+		return false
+	}
+
+	appBucket.tokens--
+	methodBucket.tokens--
+
+	return true
+}
+
+// prune drops buckets which are idle or full again, they are the same as new ones
+func (rl *RateLimiter) prune(now time.Time) {
+
+	if now.Sub(rl.lastPruned) < time.Minute {
+		return
+	}
+
+	rl.lastPruned = now
+
+	for key, b := range rl.buckets {
+		if now.Sub(b.updatedAt) >= DefaultBucketIdleTimeout {
+			delete(rl.buckets, key)
+			continue
+		}
+
+		b.refill(now)
+		if b.tokens >= float64(b.limit.Burst) {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+// Handler limits requests by app of key which was resolved by authentication,
+// it has to be placed after authentication handlers.
+func (rl *RateLimiter) Handler(method string) broc.Handler {
+
+	return func(ctx *broc.Context) (interface{}, error) {
+
+		appID := ""
+		if keyInfo, ok := ctx.Get("key").(*keyring.KeyInfo); ok && keyInfo != nil {
+			appID = keyInfo.GetAppID()
+		} else {
+			packet := ctx.Get("request").(*packet_pb.Packet)
+
+			// Session tokens share one bucket, they are not supposed to be logged either
+			appID = packet.AppID
+			if strings.HasPrefix(appID, SessionPrefix) {
+				appID = SessionPrefix
+			}
+
+			appID = unauthenticatedPrefix + appID
+		}
+
+		if !rl.Allow(appID, method) {
+
+			log.WithFields(log.Fields{
+				"appID":  appID,
+				"method": method,
+			}).Warn("Rate limited request")
+
+			return nil, ErrRateLimited
+		}
+
+		return ctx.Next()
+	}
+}
@@ -0,0 +1,179 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketRefill(t *testing.T) {
+
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		limit    Limit
+		tokens   float64
+		elapsed  time.Duration
+		expected float64
+	}{
+		{"no time passed", Limit{Rate: 10, Burst: 5}, 0, 0, 0},
+		{"partial refill", Limit{Rate: 10, Burst: 5}, 0, 200 * time.Millisecond, 2},
+		{"capped by burst", Limit{Rate: 10, Burst: 5}, 1, 10 * time.Second, 5},
+		{"slow rate", Limit{Rate: 0.5, Burst: 5}, 0, 4 * time.Second, 2},
+		{"zero rate", Limit{Rate: 0, Burst: 5}, 1, time.Hour, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &bucket{
+				limit:     tt.limit,
+				tokens:    tt.tokens,
+				updatedAt: now,
+			}
+
+			b.refill(now.Add(tt.elapsed))
+			if b.tokens != tt.expected {
+				t.Errorf("tokens = %v, want %v", b.tokens, tt.expected)
+			}
+
+			if !b.updatedAt.Equal(now.Add(tt.elapsed)) {
+				t.Errorf("updatedAt was not moved forward")
+			}
+		})
+	}
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+
+	// Rates are low enough to not refill while running
+	methods := map[string]Limit{
+		"mgr.limited": {Rate: 0.001, Burst: 1},
+	}
+
+	tests := []struct {
+		name     string
+		enabled  bool
+		requests []string
+		expected []bool
+	}{
+		{
+			"disabled",
+			false,
+			[]string{"mgr.any", "mgr.any", "mgr.any", "mgr.any"},
+			[]bool{true, true, true, true},
+		},
+		{
+			"default limit",
+			true,
+			[]string{"mgr.any", "mgr.any", "mgr.other", "mgr.any"},
+			[]bool{true, true, true, false},
+		},
+		{
+			"method limit",
+			true,
+			[]string{"mgr.limited", "mgr.limited", "mgr.any"},
+			[]bool{true, false, true},
+		},
+		{
+			"method limit takes from app bucket",
+			true,
+			[]string{"mgr.limited", "mgr.any", "mgr.any", "mgr.any"},
+			[]bool{true, true, true, false},
+		},
+		{
+			"rejected request takes no token",
+			true,
+			[]string{"mgr.limited", "mgr.limited", "mgr.limited", "mgr.any", "mgr.any"},
+			[]bool{true, false, false, true, true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl := NewRateLimiter()
+			rl.SetLimits(tt.enabled, Limit{Rate: 0.001, Burst: 3}, methods)
+
+			for i, method := range tt.requests {
+				if allowed := rl.Allow("app", method); allowed != tt.expected[i] {
+					t.Errorf("request %d to %s: Allow() = %v, want %v", i, method, allowed, tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterSeparatesApps(t *testing.T) {
+
+	rl := NewRateLimiter()
+	rl.SetLimits(true, Limit{Rate: 0.001, Burst: 1}, map[string]Limit{})
+
+	apps := []string{"app", "other", unauthenticatedPrefix + "app"}
+	for _, appID := range apps {
+		if !rl.Allow(appID, "mgr.any") {
+			t.Errorf("first request of %s was rejected", appID)
+		}
+	}
+
+	for _, appID := range apps {
+		if rl.Allow(appID, "mgr.any") {
+			t.Errorf("second request of %s was allowed", appID)
+		}
+	}
+}
+
+func TestRateLimiterSetLimitsResetsBuckets(t *testing.T) {
+
+	rl := NewRateLimiter()
+	rl.SetLimits(true, Limit{Rate: 0.001, Burst: 1}, map[string]Limit{})
+
+	rl.Allow("app", "mgr.any")
+	if rl.Allow("app", "mgr.any") {
+		t.Fatal("bucket was not drained")
+	}
+
+	rl.SetLimits(true, Limit{Rate: 0.001, Burst: 1}, map[string]Limit{})
+	if !rl.Allow("app", "mgr.any") {
+		t.Error("bucket was not reset by SetLimits")
+	}
+}
+
+func TestRateLimiterPrune(t *testing.T) {
+
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		tokens   float64
+		idle     time.Duration
+		expected bool
+	}{
+		{"drained bucket is kept", 0, 2 * time.Minute, true},
+		{"refilled bucket is dropped", 0, 8 * time.Minute, false},
+		{"idle bucket is dropped", 0, DefaultBucketIdleTimeout, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl := NewRateLimiter()
+			rl.SetLimits(true, Limit{Rate: 0.01, Burst: 5}, map[string]Limit{})
+
+			rl.buckets["app"] = &bucket{
+				limit:     Limit{Rate: 0.01, Burst: 5},
+				tokens:    tt.tokens,
+				updatedAt: now.Add(-tt.idle),
+			}
+
+			// Pruning is throttled
+			rl.lastPruned = now
+			rl.prune(now.Add(30 * time.Second))
+			if _, ok := rl.buckets["app"]; !ok {
+				t.Fatal("bucket was pruned within a minute")
+			}
+
+			rl.prune(now.Add(time.Minute))
+			if _, ok := rl.buckets["app"]; ok != tt.expected {
+				t.Errorf("bucket kept = %v, want %v", ok, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package middleware
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Fields which are appended to encoded packet_pb.Payload by clients before
+// encryption. Numbers are far away from fields of Payload so older servers
+// simply ignore them.
+const (
+	PayloadTimestampField protowire.Number = 1000 // Unix time in milliseconds
+	PayloadNonceField     protowire.Number = 1001
+)
+
+var (
+	ErrReplayedRequest = errors.New("ReplayedRequest")
+	ErrStaleRequest    = errors.New("StaleRequest")
+	ErrNonceRequired   = errors.New("NonceRequired")
+)
+
+// ReplayGuard rejects packets which are out of time window or carry a nonce
+// which was seen already.
+type ReplayGuard struct {
+	window      time.Duration
+	allowLegacy bool
+	nonces      map[string]time.Time
+	lastPruned  time.Time
+	mutex       sync.Mutex
+}
+
+func NewReplayGuard(window time.Duration, allowLegacy bool) *ReplayGuard {
+	return &ReplayGuard{
+		window:      window,
+		allowLegacy: allowLegacy,
+		nonces:      make(map[string]time.Time),
+		lastPruned:  time.Now(),
+	}
+}
+
+func (rg *ReplayGuard) SetWindow(window time.Duration) {
+	rg.mutex.Lock()
+	rg.window = window
+	rg.mutex.Unlock()
+}
+
+func (rg *ReplayGuard) SetAllowLegacy(allowLegacy bool) {
+	rg.mutex.Lock()
+	rg.allowLegacy = allowLegacy
+	rg.mutex.Unlock()
+}
+
+// AppendNonce adds timestamp and nonce to encoded payload
+func AppendNonce(data []byte, timestamp time.Time, nonce []byte) []byte {
+	data = protowire.AppendTag(data, PayloadTimestampField, protowire.VarintType)
+	data = protowire.AppendVarint(data, uint64(timestamp.UnixNano()/int64(time.Millisecond)))
+	data = protowire.AppendTag(data, PayloadNonceField, protowire.BytesType)
+	return protowire.AppendBytes(data, nonce)
+}
+
+func parseNonce(data []byte) (int64, []byte, error) {
+
+	var timestamp int64
+	var nonce []byte
+
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return 0, nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		switch {
+		case num == PayloadTimestampField && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return 0, nil, protowire.ParseError(n)
+			}
+			timestamp = int64(v)
+			data = data[n:]
+		case num == PayloadNonceField && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return 0, nil, protowire.ParseError(n)
+			}
+			nonce = v
+			data = data[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return 0, nil, protowire.ParseError(n)
+			}
+			data = data[n:]
+		}
+	}
+
+	return timestamp, nonce, nil
+}
+
+// Check verifies timestamp and nonce in decrypted payload of app
+func (rg *ReplayGuard) Check(appID string, data []byte) error {
+
+	timestamp, nonce, err := parseNonce(data)
+	if err != nil {
+		return ErrInvalidPayload
+	}
+
+	rg.mutex.Lock()
+	defer rg.mutex.Unlock()
+
+	if timestamp == 0 && len(nonce) == 0 {
+		// Packets from older clients
+		if rg.allowLegacy {
+			return nil
+		}
+
+		return ErrNonceRequired
+	}
+
+	if timestamp == 0 || len(nonce) == 0 {
+		return ErrNonceRequired
+	}
+
+	now := time.Now()
+	sentAt := time.Unix(0, timestamp*int64(time.Millisecond))
+	if sentAt.Before(now.Add(-rg.window)) || sentAt.After(now.Add(rg.window)) {
+		return ErrStaleRequest
+	}
+
+	rg.prune(now)
+
+	key := appID + "/" + string(nonce)
+	if _, ok := rg.nonces[key]; ok {
+		return ErrReplayedRequest
+	}
+
+	// Nonce has to be kept until packet is out of window
+	rg.nonces[key] = sentAt.Add(rg.window)
+
+	return nil
+}
+
+func (rg *ReplayGuard) prune(now time.Time) {
+
+	if now.Sub(rg.lastPruned) < time.Second {
+		return
+	}
+
+	rg.lastPruned = now
+
+	for key, expiresAt := range rg.nonces {
+		if now.After(expiresAt) {
+			delete(rg.nonces, key)
+		}
+	}
+}
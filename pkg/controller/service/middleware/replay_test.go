@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestReplayGuardCheck(t *testing.T) {
+
+	now := time.Now()
+	payload := []byte{}
+
+	tests := []struct {
+		name        string
+		allowLegacy bool
+		data        []byte
+		expected    error
+	}{
+		{"fresh request", false, AppendNonce(payload, now, []byte("n1")), nil},
+		{"edge of past window", false, AppendNonce(payload, now.Add(-50*time.Second), []byte("n1")), nil},
+		{"edge of future window", false, AppendNonce(payload, now.Add(50*time.Second), []byte("n1")), nil},
+		{"stale request", false, AppendNonce(payload, now.Add(-2*time.Minute), []byte("n1")), ErrStaleRequest},
+		{"request from future", false, AppendNonce(payload, now.Add(2*time.Minute), []byte("n1")), ErrStaleRequest},
+		{"legacy request allowed", true, payload, nil},
+		{"legacy request rejected", false, payload, ErrNonceRequired},
+		{"missing nonce", true, AppendNonce(payload, now, nil), ErrNonceRequired},
+		{"missing timestamp", true, AppendNonce(payload, time.Unix(0, 0), []byte("n1")), ErrNonceRequired},
+		{"invalid payload", true, []byte{0xff}, ErrInvalidPayload},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rg := NewReplayGuard(time.Minute, tt.allowLegacy)
+			if err := rg.Check("app", tt.data); err != tt.expected {
+				t.Errorf("Check() = %v, want %v", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestReplayGuardNonces(t *testing.T) {
+
+	rg := NewReplayGuard(time.Minute, false)
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		appID    string
+		nonce    string
+		expected error
+	}{
+		{"first use", "app", "n1", nil},
+		{"replayed", "app", "n1", ErrReplayedRequest},
+		{"another nonce", "app", "n2", nil},
+		{"same nonce of another app", "other", "n1", nil},
+		{"replayed by another app", "other", "n1", ErrReplayedRequest},
+	}
+
+	// Cases share one guard and run in order
+	for _, tt := range tests {
+		data := AppendNonce([]byte{}, now, []byte(tt.nonce))
+		if err := rg.Check(tt.appID, data); err != tt.expected {
+			t.Errorf("%s: Check(%s, %s) = %v, want %v", tt.name, tt.appID, tt.nonce, err, tt.expected)
+		}
+	}
+}
+
+func TestReplayGuardPrune(t *testing.T) {
+
+	rg := NewReplayGuard(time.Minute, false)
+	now := time.Now()
+
+	rg.nonces["app/expired"] = now.Add(-time.Second)
+	rg.nonces["app/valid"] = now.Add(time.Minute)
+
+	// Pruning is throttled
+	rg.lastPruned = now
+	rg.prune(now.Add(500 * time.Millisecond))
+	if len(rg.nonces) != 2 {
+		t.Fatalf("nonces were pruned within a second: %v", rg.nonces)
+	}
+
+	rg.prune(now.Add(2 * time.Second))
+	if _, ok := rg.nonces["app/expired"]; ok {
+		t.Error("expired nonce was not pruned")
+	}
+
+	if _, ok := rg.nonces["app/valid"]; !ok {
+		t.Error("valid nonce was pruned")
+	}
+}
+
+func TestParseNonceSkipsPayloadFields(t *testing.T) {
+
+	// Fields of payload itself come before timestamp and nonce
+	data := protowire.AppendTag(nil, 1, protowire.BytesType)
+	data = protowire.AppendString(data, "event")
+	data = protowire.AppendTag(data, 2, protowire.VarintType)
+	data = protowire.AppendVarint(data, 42)
+
+	sentAt := time.Unix(1600000000, 123000000)
+	data = AppendNonce(data, sentAt, []byte("nonce"))
+
+	timestamp, nonce, err := parseNonce(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if timestamp != 1600000000123 {
+		t.Errorf("timestamp = %d, want 1600000000123", timestamp)
+	}
+
+	if string(nonce) != "nonce" {
+		t.Errorf("nonce = %s, want nonce", nonce)
+	}
+}
@@ -7,7 +7,6 @@ import (
 
 	"github.com/BrobridgeOrg/broc"
 	log "github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
 )
 
 type PipelineManager struct {
@@ -27,8 +26,7 @@ func NewPipelineManager(controller *Controller) *PipelineManager {
 func (pm *PipelineManager) Initialize() error {
 
 	// Initializing pipelines
-	viper.SetDefault("controller.pipelineCount", 256)
-	pipelineCount := viper.GetUint64("controller.pipelineCount")
+	pipelineCount := pm.controller.getConfig().Controller.PipelineCount
 	pm.pendingTasks = make(chan *Task, pipelineCount)
 	for i := uint64(0); i < pipelineCount; i++ {
 
@@ -85,15 +83,21 @@ func (pm *PipelineManager) assignPipeline(synchronizer *Synchronizer, pipeline *
 
 	pipeline.Assign(synchronizer.id)
 
+	pm.controller.events.PublishPipeline(EventPipelineAssigned, synchronizer.id, pipeline.id)
+
 	return nil
 }
 
 func (pm *PipelineManager) releasePipeline(pipeline *Pipeline) error {
 
+	synchronizerID := pipeline.synchronizerID
+
 	// Release pipeline back to pool
 	pipeline.Release()
 	pm.pendingTasks <- NewTask(nil, pipeline)
 
+	pm.controller.events.PublishPipeline(EventPipelineReleased, synchronizerID, pipeline.id)
+
 	return nil
 }
 
@@ -148,6 +152,10 @@ func (pm *PipelineManager) DispatchPipeline(pipeline *Pipeline) bool {
 		return false
 	}
 
+	pipeline.Assign(found.id)
+
+	pm.controller.events.PublishPipeline(EventPipelineAssigned, found.id, pipeline.id)
+
 	return true
 }
 
@@ -163,7 +171,10 @@ func (pm *PipelineManager) AssignPipeline(synchronizerID string, pipelineID uint
 		return errors.New("No such pipeline: " + fmt.Sprintf("%d", pipelineID))
 	}
 
-	return pm.assignPipeline(synchronizer, pipeline)
+	err := pm.assignPipeline(synchronizer, pipeline)
+	pm.audit("pipeline_manager.assignPipeline", synchronizerID, pipelineID, err)
+
+	return err
 }
 
 func (pm *PipelineManager) ReleasePipeline(synchronizerID string, pipelineID uint64) error {
@@ -182,7 +193,10 @@ func (pm *PipelineManager) ReleasePipeline(synchronizerID string, pipelineID uin
 		return nil
 	}
 
-	return pm.releasePipeline(pipeline)
+	err := pm.releasePipeline(pipeline)
+	pm.audit("pipeline_manager.releasePipeline", synchronizerID, pipelineID, err)
+
+	return err
 }
 
 func (pm *PipelineManager) RevokePipeline(synchronizerID string, pipelineID uint64) error {
@@ -197,7 +211,26 @@ func (pm *PipelineManager) RevokePipeline(synchronizerID string, pipelineID uint
 		return errors.New("No such pipeline: " + fmt.Sprintf("%d", pipelineID))
 	}
 
-	return synchronizer.RevokePipeline(pipeline.id)
+	err := synchronizer.RevokePipeline(pipeline.id)
+	pm.audit("pipeline_manager.revokePipeline", synchronizerID, pipelineID, err)
+	if err != nil {
+		return err
+	}
+
+	pm.controller.events.PublishPipeline(EventPipelineRevoked, synchronizerID, pipelineID)
+
+	return nil
+}
+
+func (pm *PipelineManager) audit(action string, synchronizerID string, pipelineID uint64, err error) {
+
+	reason := ""
+	if err != nil {
+		reason = err.Error()
+	}
+
+	target := fmt.Sprintf("%s/%d", synchronizerID, pipelineID)
+	pm.controller.audit.Record(pm.controller.clientID, action, target, err == nil, reason)
 }
 
 func (pm *PipelineManager) GetCount() int {
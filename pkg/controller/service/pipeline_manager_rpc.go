@@ -9,18 +9,12 @@ import (
 	"github.com/BrobridgeOrg/broc"
 	packet_pb "github.com/BrobridgeOrg/gravity-api/packet"
 	pb "github.com/BrobridgeOrg/gravity-api/service/pipeline_manager"
-	"github.com/BrobridgeOrg/gravity-controller/pkg/controller/service/middleware"
 )
 
 func (pm *PipelineManager) initializeRPC() error {
 
 	// Initializing authentication middleware
-	m := middleware.NewMiddleware(map[string]interface{}{
-		"Authentication": &middleware.Authentication{
-			Enabled: true,
-			Keyring: pm.controller.keyring,
-		},
-	})
+	m := pm.controller.newMiddleware()
 
 	// Initializing RPC engine to handle requests
 	pm.rpcEngine = broc.NewBroc(pm.controller.gravityClient.GetConnection())
@@ -28,7 +22,11 @@ func (pm *PipelineManager) initializeRPC() error {
 	pm.rpcEngine.SetPrefix(fmt.Sprintf("%s.pipeline_manager.", pm.controller.domain))
 
 	// Register methods
-	pm.rpcEngine.Register("getCount", m.RequiredAuth("SYSTEM", "SUBSCRIBER"), pm.rpc_getCount)
+	pm.rpcEngine.Register("getCount",
+		m.RequiredMethod("pipeline_manager.getCount"),
+		m.RateLimit("pipeline_manager.getCount"),
+		pm.rpc_getCount,
+	)
 
 	return pm.rpcEngine.Apply()
 }
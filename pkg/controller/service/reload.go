@@ -0,0 +1,224 @@
+package controller
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/BrobridgeOrg/gravity-controller/pkg/config"
+	"github.com/BrobridgeOrg/gravity-controller/pkg/controller/service/middleware"
+	"github.com/BrobridgeOrg/gravity-sdk/core/keyring"
+	log "github.com/sirupsen/logrus"
+)
+
+// getConfig returns current configurations, they are shared between goroutines so they must not be modified
+func (controller *Controller) getConfig() *config.Config {
+	return controller.config.Load().(*config.Config)
+}
+
+func (controller *Controller) getRequestTimeout() time.Duration {
+	return time.Duration(controller.getConfig().Gravity.RequestTimeout) * time.Second
+}
+
+// ApplyConfig applies settings which are safe to change at runtime and keeps the rest untouched
+func (controller *Controller) ApplyConfig(next *config.Config) {
+
+	// Reloads which are triggered at the same time are applied one by one
+	controller.reloadMutex.Lock()
+	defer controller.reloadMutex.Unlock()
+
+	current := controller.getConfig()
+
+	// Settings which need a restart
+	changes := current.RestartRequired(next)
+	if len(changes) > 0 {
+		log.WithFields(log.Fields{
+			"settings": strings.Join(changes, ","),
+		}).Warn("Ignored configuration changes, these settings are only applied at startup so a restart is required")
+	}
+
+	applied := *current
+
+	// Log level
+	if current.Log.Level != next.Log.Level {
+		applied.Log.Level = next.Log.Level
+		log.SetLevel(next.GetLogLevel())
+		log.WithFields(log.Fields{
+			"level": next.Log.Level,
+		}).Info("Applied log level")
+	}
+
+	// Timeouts
+	if current.Gravity.RequestTimeout != next.Gravity.RequestTimeout {
+		applied.Gravity.RequestTimeout = next.Gravity.RequestTimeout
+		log.WithFields(log.Fields{
+			"requestTimeout": next.Gravity.RequestTimeout,
+		}).Info("Applied request timeout")
+	}
+
+	if current.AuthService.KeyRotationGracePeriod != next.AuthService.KeyRotationGracePeriod {
+		applied.AuthService.KeyRotationGracePeriod = next.AuthService.KeyRotationGracePeriod
+		log.WithFields(log.Fields{
+			"keyRotationGracePeriod": next.AuthService.KeyRotationGracePeriod,
+		}).Info("Applied key rotation grace period")
+	}
+
+	// Replay protection
+	if current.Security.ReplayWindow != next.Security.ReplayWindow {
+		applied.Security.ReplayWindow = next.Security.ReplayWindow
+		controller.replayGuard.SetWindow(time.Duration(next.Security.ReplayWindow) * time.Second)
+		log.WithFields(log.Fields{
+			"replayWindow": next.Security.ReplayWindow,
+		}).Info("Applied replay window")
+	}
+
+	if current.Security.AllowLegacyPackets != next.Security.AllowLegacyPackets {
+		applied.Security.AllowLegacyPackets = next.Security.AllowLegacyPackets
+		controller.replayGuard.SetAllowLegacy(next.Security.AllowLegacyPackets)
+		log.WithFields(log.Fields{
+			"allowLegacyPackets": next.Security.AllowLegacyPackets,
+		}).Info("Applied legacy packet setting")
+	}
+
+	if current.AuthService.CacheSize != next.AuthService.CacheSize ||
+		current.AuthService.CacheTTL != next.AuthService.CacheTTL ||
+		current.AuthService.NegativeCacheTTL != next.AuthService.NegativeCacheTTL {
+		applied.AuthService.CacheSize = next.AuthService.CacheSize
+		applied.AuthService.CacheTTL = next.AuthService.CacheTTL
+		applied.AuthService.NegativeCacheTTL = next.AuthService.NegativeCacheTTL
+		controller.auth.SetCacheOptions(&next.AuthService)
+		log.WithFields(log.Fields{
+			"cacheSize":        next.AuthService.CacheSize,
+			"cacheTTL":         next.AuthService.CacheTTL,
+			"negativeCacheTTL": next.AuthService.NegativeCacheTTL,
+		}).Info("Applied authentication cache settings")
+	}
+
+	// Rate limits and quotas
+	if !reflect.DeepEqual(current.RateLimit, next.RateLimit) {
+		applied.RateLimit = next.RateLimit
+		controller.applyRateLimit(&next.RateLimit)
+		log.WithFields(log.Fields{
+			"enabled": next.RateLimit.Enabled,
+		}).Info("Applied rate limits")
+	}
+
+	if current.Quota != next.Quota {
+		applied.Quota = next.Quota
+		log.WithFields(log.Fields{
+			"maxSubscribersPerApp":        next.Quota.MaxSubscribersPerApp,
+			"maxCollectionsPerSubscriber": next.Quota.MaxCollectionsPerSubscriber,
+		}).Info("Applied quotas")
+	}
+
+	if current.Session != next.Session {
+		applied.Session = next.Session
+		log.WithFields(log.Fields{
+			"ttl": next.Session.TTL,
+		}).Info("Applied session TTL")
+	}
+
+	if current.Audit.RetentionDays != next.Audit.RetentionDays {
+		applied.Audit.RetentionDays = next.Audit.RetentionDays
+		log.WithFields(log.Fields{
+			"retentionDays": next.Audit.RetentionDays,
+		}).Info("Applied audit retention")
+	}
+
+	// Anonymous access
+	if current.AdapterManager.AllowAnonymous != next.AdapterManager.AllowAnonymous {
+		applied.AdapterManager.AllowAnonymous = next.AdapterManager.AllowAnonymous
+		controller.adapterManager.SetAllowAnonymous(next.AdapterManager.AllowAnonymous)
+	}
+
+	if current.AdapterManager.StaleTimeout != next.AdapterManager.StaleTimeout {
+		applied.AdapterManager.StaleTimeout = next.AdapterManager.StaleTimeout
+		log.WithFields(log.Fields{
+			"staleTimeout": next.AdapterManager.StaleTimeout,
+		}).Info("Applied adapter stale timeout")
+	}
+
+	if current.AdapterManager.Retention != next.AdapterManager.Retention {
+		applied.AdapterManager.Retention = next.AdapterManager.Retention
+		log.WithFields(log.Fields{
+			"retention": next.AdapterManager.Retention,
+		}).Info("Applied retention of unregistered adapters")
+	}
+
+	if current.SubscriberManager.AllowAnonymous != next.SubscriberManager.AllowAnonymous {
+		applied.SubscriberManager.AllowAnonymous = next.SubscriberManager.AllowAnonymous
+		controller.subscriberManager.SetAllowAnonymous(next.SubscriberManager.AllowAnonymous)
+	}
+
+	// Authentication service
+	if current.AuthService.Enabled != next.AuthService.Enabled {
+		applied.AuthService.Enabled = next.AuthService.Enabled
+		controller.auth.SetAuthServiceEnabled(next.AuthService.Enabled)
+		log.WithFields(log.Fields{
+			"enabled": next.AuthService.Enabled,
+		}).Info("Applied authentication service setting")
+	}
+
+	controller.config.Store(&applied)
+}
+
+// Anonymous apps are not limited to specific collections
+var anonymousCollections = []string{"*"}
+
+// setAnonymousPermission grants or revokes permission on the shared anonymous key
+func (controller *Controller) setAnonymousPermission(permission string, enabled bool) *keyring.KeyInfo {
+
+	key := controller.keyring.Get("anonymous")
+
+	if enabled {
+		if key == nil {
+			key = controller.keyring.Put("anonymous", "")
+		}
+
+		key.Permission().AddPermissions([]string{permission})
+		key.Collection().AddCollections(anonymousCollections)
+
+		return key
+	}
+
+	if key == nil {
+		return nil
+	}
+
+	// Rebuild anonymous key without specific permission
+	permissions := make([]string, 0)
+	for _, perm := range key.Permission().GetPermissions() {
+		if perm == permission {
+			continue
+		}
+
+		permissions = append(permissions, perm)
+	}
+
+	newKey := keyring.NewKey("anonymous", "")
+	newKey.Permission().AddPermissions(permissions)
+	newKey.Collection().AddCollections(anonymousCollections)
+	controller.keyring.GetKeys().Store("anonymous", newKey)
+
+	return newKey
+}
+
+func (controller *Controller) applyRateLimit(rateLimit *config.RateLimitConfig) {
+
+	methods := make(map[string]middleware.Limit)
+	for _, limit := range rateLimit.Methods {
+		methods[limit.Method] = middleware.Limit{
+			Rate:  limit.Rate,
+			Burst: limit.Burst,
+		}
+	}
+
+	controller.rateLimiter.SetLimits(
+		rateLimit.Enabled,
+		middleware.Limit{
+			Rate:  rateLimit.Rate,
+			Burst: rateLimit.Burst,
+		},
+		methods,
+	)
+}
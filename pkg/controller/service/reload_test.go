@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/BrobridgeOrg/gravity-controller/pkg/controller/service/middleware"
+	"github.com/BrobridgeOrg/gravity-sdk/core/keyring"
+)
+
+func TestAnonymousKeyCollections(t *testing.T) {
+
+	controller := &Controller{
+		keyring: keyring.NewKeyring(),
+	}
+
+	tests := []struct {
+		name       string
+		permission string
+		enabled    bool
+	}{
+		{"subscriber allowed", "SUBSCRIBER", true},
+		{"adapter allowed", "ADAPTER", true},
+		{"subscriber revoked", "SUBSCRIBER", false},
+	}
+
+	// Cases share one keyring and run in order
+	for _, tt := range tests {
+		key := controller.setAnonymousPermission(tt.permission, tt.enabled)
+		if key == nil {
+			t.Fatalf("%s: anonymous key is missing", tt.name)
+		}
+
+		if key.Permission().Check(tt.permission) != tt.enabled {
+			t.Errorf("%s: permission %s = %v, want %v", tt.name, tt.permission, !tt.enabled, tt.enabled)
+		}
+
+		for _, collection := range []string{"orders", "orders.items", "accounts"} {
+			if !middleware.CheckCollection(key, collection) {
+				t.Errorf("%s: anonymous key is denied to access %s", tt.name, collection)
+			}
+		}
+	}
+}
@@ -0,0 +1,479 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"path"
+	"sync"
+
+	"github.com/BrobridgeOrg/broc"
+	"github.com/BrobridgeOrg/gravity-sdk/core/keyring"
+	log "github.com/sirupsen/logrus"
+)
+
+// Role grants access to RPC methods, method can be a wildcard pattern such as "collection_manager.*"
+type Role struct {
+	Name    string   `json:"name"`
+	Methods []string `json:"methods"`
+}
+
+// Default roles are seeded from the permissions which were hard-coded on RPC methods
+var defaultRoles = []*Role{
+	{
+		Name: "SYSTEM",
+		Methods: []string{
+			"adapter_manager.getAdapters",
+			"adapter_manager.healthCheck",
+			"adapter_manager.listAdapters",
+			"adapter_manager.setAdapterLabels",
+			"adapter_manager.updateAdapterCollections",
+			"audit.getAuditLog",
+			"authentication_manager.*",
+			"collection_manager.*",
+			"pipeline_manager.getCount",
+			"subscriber_manager.updateSubscriberProps",
+			"subscriber_manager.getSubscribers",
+			"subscriber_manager.listSubscribers",
+			"subscriber_manager.setSubscriberLabels",
+			"synchronizer_manager.*",
+		},
+	},
+	{
+		Name: "ADMIN",
+		Methods: []string{
+			"audit.getAuditLog",
+			"authentication_manager.*",
+		},
+	},
+	{
+		Name: "AUTHENTICATION_MANAGER_ADMIN",
+		Methods: []string{
+			"authentication_manager.*",
+		},
+	},
+	{
+		Name: "ADAPTER",
+		Methods: []string{
+			"adapter_manager.healthCheck",
+			"adapter_manager.register",
+			"adapter_manager.unregister",
+			"adapter_manager.updateAdapterCollections",
+		},
+	},
+	{
+		Name: "ADAPTER_MANAGER",
+		Methods: []string{
+			"adapter_manager.getAdapters",
+			"adapter_manager.listAdapters",
+			"adapter_manager.setAdapterLabels",
+			"collection_manager.getCollectionConsumers",
+			"collection_manager.getLineage",
+		},
+	},
+	{
+		Name: "SUBSCRIBER",
+		Methods: []string{
+			"collection_manager.getCollection",
+			"collection_manager.getCollections",
+			"collection_manager.getCollectionVersion",
+			"collection_manager.getSchemaVersions",
+			"collection_manager.searchCollections",
+			"pipeline_manager.getCount",
+			"subscriber_manager.unregisterSubscriber",
+			"subscriber_manager.updateSubscriberProps",
+			"subscriber_manager.healthCheck",
+			"subscriber_manager.subscribeToCollections",
+		},
+	},
+	{
+		Name: "SUBSCRIBER_MANAGER",
+		Methods: []string{
+			"subscriber_manager.updateSubscriberProps",
+			"subscriber_manager.getSubscribers",
+			"subscriber_manager.listSubscribers",
+			"subscriber_manager.setSubscriberLabels",
+			"collection_manager.getCollectionConsumers",
+			"collection_manager.getLineage",
+		},
+	},
+}
+
+type RoleManager struct {
+	controller *Controller
+	roles      map[string]*Role
+	mutex      sync.RWMutex
+	rpcEngine  *broc.Broc
+}
+
+func NewRoleManager(controller *Controller) *RoleManager {
+	return &RoleManager{
+		controller: controller,
+		roles:      make(map[string]*Role),
+	}
+}
+
+func (rm *RoleManager) Initialize() error {
+
+	store, err := rm.controller.store.GetEngine().GetStore("gravity_controller")
+	if err != nil {
+		return err
+	}
+
+	err = store.RegisterColumns([]string{"roles", "role_seeds"})
+	if err != nil {
+		return err
+	}
+
+	log.Info("Trying to restoring roles...")
+
+	err = store.List("roles", []byte(""), func(key []byte, value []byte) bool {
+
+		var role Role
+		err := json.Unmarshal(value, &role)
+		if err != nil {
+			log.Errorf("Unrecognized role: %s", string(key))
+			return true
+		}
+
+		rm.roles[role.Name] = &role
+
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	return rm.seedDefaultRoles()
+}
+
+// seedDefaultRoles creates default roles which were not defined yet and adds
+// default methods introduced by newer versions into existing ones. Methods
+// which were seeded before are recorded, so those removed by administrators
+// are not added again.
+func (rm *RoleManager) seedDefaultRoles() error {
+
+	store, err := rm.controller.store.GetEngine().GetStore("gravity_controller")
+	if err != nil {
+		return err
+	}
+
+	for _, defaultRole := range defaultRoles {
+
+		seeded := make([]string, 0)
+		data, err := store.GetBytes("role_seeds", []byte(defaultRole.Name))
+		if err != nil {
+			return err
+		}
+
+		if len(data) > 0 {
+			err = json.Unmarshal(data, &seeded)
+			if err != nil {
+				return err
+			}
+		}
+
+		role := &Role{
+			Name:    defaultRole.Name,
+			Methods: make([]string, 0, len(defaultRole.Methods)),
+		}
+
+		// Missing roles are created with all default methods
+		current := rm.GetRole(defaultRole.Name)
+		if current == nil {
+			seeded = seeded[:0]
+		} else {
+			role.Methods = append(role.Methods, current.Methods...)
+		}
+
+		added := make([]string, 0)
+		for _, method := range defaultRole.Methods {
+			if containsString(seeded, method) || containsString(role.Methods, method) {
+				continue
+			}
+
+			role.Methods = append(role.Methods, method)
+			added = append(added, method)
+		}
+
+		if current == nil || len(added) > 0 {
+			err = rm.PutRole(role)
+			if err != nil {
+				return err
+			}
+
+			log.WithFields(log.Fields{
+				"role":    role.Name,
+				"methods": added,
+			}).Info("Seeded default methods of role")
+		}
+
+		data, err = json.Marshal(defaultRole.Methods)
+		if err != nil {
+			return err
+		}
+
+		err = store.Put("role_seeds", []byte(defaultRole.Name), data)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func isDefaultRole(name string) bool {
+
+	for _, role := range defaultRoles {
+		if role.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsString(list []string, s string) bool {
+
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (rm *RoleManager) PutRole(role *Role) error {
+
+	if len(role.Name) == 0 {
+		return errors.New("InvalidRoleName")
+	}
+
+	for _, method := range role.Methods {
+		if _, err := path.Match(method, ""); err != nil {
+			return errors.New("InvalidMethodPattern")
+		}
+	}
+
+	store, err := rm.controller.store.GetEngine().GetStore("gravity_controller")
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(role)
+	if err != nil {
+		return err
+	}
+
+	err = store.Put("roles", []byte(role.Name), data)
+	if err != nil {
+		return err
+	}
+
+	rm.mutex.Lock()
+	rm.roles[role.Name] = role
+	rm.mutex.Unlock()
+
+	log.WithFields(log.Fields{
+		"role": role.Name,
+	}).Info("Updated role")
+
+	return nil
+}
+
+func (rm *RoleManager) DeleteRole(name string) error {
+
+	// Default roles would be seeded again on restart
+	if isDefaultRole(name) {
+		return errors.New("Forbidden")
+	}
+
+	rm.mutex.RLock()
+	_, ok := rm.roles[name]
+	rm.mutex.RUnlock()
+	if !ok {
+		return errors.New("NotFoundRole")
+	}
+
+	store, err := rm.controller.store.GetEngine().GetStore("gravity_controller")
+	if err != nil {
+		return err
+	}
+
+	err = store.Delete("roles", []byte(name))
+	if err != nil {
+		return err
+	}
+
+	rm.mutex.Lock()
+	delete(rm.roles, name)
+	rm.mutex.Unlock()
+
+	log.WithFields(log.Fields{
+		"role": name,
+	}).Info("Deleted role")
+
+	return nil
+}
+
+func (rm *RoleManager) GetRole(name string) *Role {
+
+	rm.mutex.RLock()
+	defer rm.mutex.RUnlock()
+
+	role, ok := rm.roles[name]
+	if !ok {
+		return nil
+	}
+
+	return role
+}
+
+func (rm *RoleManager) GetRoles() []*Role {
+
+	rm.mutex.RLock()
+	defer rm.mutex.RUnlock()
+
+	roles := make([]*Role, 0, len(rm.roles))
+	for _, role := range rm.roles {
+		roles = append(roles, role)
+	}
+
+	return roles
+}
+
+// CheckMethod returns true if one of roles grants access to method
+func (rm *RoleManager) CheckMethod(roles []string, method string) bool {
+
+	rm.mutex.RLock()
+	defer rm.mutex.RUnlock()
+
+	for _, name := range roles {
+		role, ok := rm.roles[name]
+		if !ok {
+			continue
+		}
+
+		for _, pattern := range role.Methods {
+			matched, err := path.Match(pattern, method)
+			if err != nil {
+				continue
+			}
+
+			if matched {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// GrantRoles adds roles to entity and its key which is loaded in keyring
+func (rm *RoleManager) GrantRoles(appID string, roles []string) error {
+
+	for _, name := range roles {
+		if rm.GetRole(name) == nil {
+			return errors.New("NotFoundRole")
+		}
+	}
+
+	return rm.updateRoles(appID, func(current []string) []string {
+
+		granted := make(map[string]bool)
+		for _, name := range current {
+			granted[name] = true
+		}
+
+		for _, name := range roles {
+			if granted[name] {
+				continue
+			}
+
+			granted[name] = true
+			current = append(current, name)
+		}
+
+		return current
+	})
+}
+
+// RevokeRoles removes roles from entity and its key which is loaded in keyring
+func (rm *RoleManager) RevokeRoles(appID string, roles []string) error {
+
+	revoked := make(map[string]bool)
+	for _, name := range roles {
+		revoked[name] = true
+	}
+
+	return rm.updateRoles(appID, func(current []string) []string {
+
+		results := make([]string, 0, len(current))
+		for _, name := range current {
+			if revoked[name] {
+				continue
+			}
+
+			results = append(results, name)
+		}
+
+		return results
+	})
+}
+
+func (rm *RoleManager) updateRoles(appID string, update func([]string) []string) error {
+
+	// Keys from configurations are not managed by roles
+	if appID == "gravity" || appID == "anonymous" {
+		return errors.New("Forbidden")
+	}
+
+	auth := rm.controller.auth
+
+	// Update entity so roles apply on next authentication
+	entity, err := auth.getAuthenticator().GetEntity(appID)
+	if err != nil {
+		return err
+	}
+
+	// Properties decoded from remote authenticator come with []interface{}
+	entity.Properties = normalizeProperties(entity.Properties)
+
+	current := make([]string, 0)
+	if v, ok := entity.Properties["permissions"].([]string); ok {
+		current = v
+	}
+
+	roles := update(current)
+	entity.Properties["permissions"] = roles
+
+	err = auth.getAuthenticator().UpdateEntity(entity)
+	if err != nil {
+		return err
+	}
+
+	auth.InvalidateCache(appID)
+
+	key := rm.controller.keyring.Get(appID)
+	if key == nil {
+		return nil
+	}
+
+	// Rebuild key because permissions cannot be removed from keyring
+	newKey := keyring.NewKey(appID, string(key.Encryption().GetKey()))
+	newKey.Permission().AddPermissions(roles)
+	newKey.Collection().AddCollections(key.Collection().GetCollections())
+	rm.controller.keyring.GetKeys().Store(appID, newKey)
+
+	err = rm.controller.keyringStore.Update(newKey)
+	if err != nil {
+		log.Error(err)
+	}
+
+	log.WithFields(log.Fields{
+		"appID": appID,
+		"roles": roles,
+	}).Info("Updated roles of entity")
+
+	return rm.controller.synchronizerManager.UpdateKeyring(newKey)
+}
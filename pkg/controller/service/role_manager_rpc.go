@@ -0,0 +1,291 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/BrobridgeOrg/broc"
+	packet_pb "github.com/BrobridgeOrg/gravity-api/packet"
+	log "github.com/sirupsen/logrus"
+)
+
+type GetRolesRequest struct {
+}
+
+type GetRolesReply struct {
+	Success bool    `json:"success"`
+	Reason  string  `json:"reason,omitempty"`
+	Roles   []*Role `json:"roles"`
+}
+
+type PutRoleRequest struct {
+	Role *Role `json:"role"`
+}
+
+type PutRoleReply struct {
+	Success bool   `json:"success"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+type DeleteRoleRequest struct {
+	Name string `json:"name"`
+}
+
+type DeleteRoleReply struct {
+	Success bool   `json:"success"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+type UpdateEntityRolesRequest struct {
+	AppID string   `json:"appID"`
+	Roles []string `json:"roles"`
+}
+
+type UpdateEntityRolesReply struct {
+	Success bool   `json:"success"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+func (rm *RoleManager) initializeRPC() error {
+
+	log.Info("Initializing RPC Handlers for RoleManager")
+
+	// Initializing authentication middleware
+	m := rm.controller.newMiddleware()
+
+	// Initializing RPC engine to handle requests
+	rm.rpcEngine = broc.NewBroc(rm.controller.gravityClient.GetConnection())
+	rm.rpcEngine.Use(m.PacketHandler)
+	rm.rpcEngine.SetPrefix(fmt.Sprintf("%s.authentication_manager.json.", rm.controller.domain))
+
+	// Register methods
+	rm.rpcEngine.Register("getRoles",
+		m.RequiredMethod("authentication_manager.getRoles"),
+		m.RateLimit("authentication_manager.getRoles"),
+		rm.rpc_getRoles,
+	)
+	rm.rpcEngine.Register("putRole",
+		m.RequiredMethod("authentication_manager.putRole"),
+		m.RateLimit("authentication_manager.putRole"),
+		rm.rpc_putRole,
+	)
+	rm.rpcEngine.Register("deleteRole",
+		m.RequiredMethod("authentication_manager.deleteRole"),
+		m.RateLimit("authentication_manager.deleteRole"),
+		rm.rpc_deleteRole,
+	)
+	rm.rpcEngine.Register("grantRoles",
+		m.RequiredMethod("authentication_manager.grantRoles"),
+		m.RateLimit("authentication_manager.grantRoles"),
+		rm.rpc_grantRoles,
+	)
+	rm.rpcEngine.Register("revokeRoles",
+		m.RequiredMethod("authentication_manager.revokeRoles"),
+		m.RateLimit("authentication_manager.revokeRoles"),
+		rm.rpc_revokeRoles,
+	)
+
+	return rm.rpcEngine.Apply()
+}
+
+func (rm *RoleManager) rpc_getRoles(ctx *broc.Context) (returnedValue interface{}, err error) {
+
+	// Reply
+	reply := GetRolesReply{
+		Success: true,
+	}
+	defer func() {
+		data, e := json.Marshal(&reply)
+		returnedValue = data
+		err = e
+	}()
+
+	// Parsing request data
+	var req GetRolesRequest
+	payload := ctx.Get("payload").(*packet_pb.Payload)
+	err = json.Unmarshal(payload.Data, &req)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = "UnknownParameter"
+		return
+	}
+
+	reply.Roles = rm.GetRoles()
+
+	return
+}
+
+func (rm *RoleManager) rpc_putRole(ctx *broc.Context) (returnedValue interface{}, err error) {
+
+	// Reply
+	reply := PutRoleReply{
+		Success: true,
+	}
+	defer func() {
+		data, e := json.Marshal(&reply)
+		returnedValue = data
+		err = e
+	}()
+
+	var req PutRoleRequest
+
+	// Audit trail
+	defer func() {
+		target := ""
+		if req.Role != nil {
+			target = req.Role.Name
+		}
+
+		rm.controller.audit.RecordContext(ctx, "authentication_manager.putRole", target, reply.Success, reply.Reason)
+	}()
+
+	// Parsing request data
+	payload := ctx.Get("payload").(*packet_pb.Payload)
+	err = json.Unmarshal(payload.Data, &req)
+	if err != nil || req.Role == nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = "UnknownParameter"
+		return
+	}
+
+	err = rm.PutRole(req.Role)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = err.Error()
+		return
+	}
+
+	return
+}
+
+func (rm *RoleManager) rpc_deleteRole(ctx *broc.Context) (returnedValue interface{}, err error) {
+
+	// Reply
+	reply := DeleteRoleReply{
+		Success: true,
+	}
+	defer func() {
+		data, e := json.Marshal(&reply)
+		returnedValue = data
+		err = e
+	}()
+
+	var req DeleteRoleRequest
+
+	// Audit trail
+	defer func() {
+		rm.controller.audit.RecordContext(ctx, "authentication_manager.deleteRole", req.Name, reply.Success, reply.Reason)
+	}()
+
+	// Parsing request data
+	payload := ctx.Get("payload").(*packet_pb.Payload)
+	err = json.Unmarshal(payload.Data, &req)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = "UnknownParameter"
+		return
+	}
+
+	err = rm.DeleteRole(req.Name)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = err.Error()
+		return
+	}
+
+	return
+}
+
+func (rm *RoleManager) rpc_grantRoles(ctx *broc.Context) (returnedValue interface{}, err error) {
+
+	// Reply
+	reply := UpdateEntityRolesReply{
+		Success: true,
+	}
+	defer func() {
+		data, e := json.Marshal(&reply)
+		returnedValue = data
+		err = e
+	}()
+
+	var req UpdateEntityRolesRequest
+
+	// Audit trail
+	defer func() {
+		rm.controller.audit.RecordContext(ctx, "authentication_manager.grantRoles", req.AppID, reply.Success, reply.Reason)
+	}()
+
+	// Parsing request data
+	payload := ctx.Get("payload").(*packet_pb.Payload)
+	err = json.Unmarshal(payload.Data, &req)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = "UnknownParameter"
+		return
+	}
+
+	err = rm.GrantRoles(req.AppID, req.Roles)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = err.Error()
+		return
+	}
+
+	return
+}
+
+func (rm *RoleManager) rpc_revokeRoles(ctx *broc.Context) (returnedValue interface{}, err error) {
+
+	// Reply
+	reply := UpdateEntityRolesReply{
+		Success: true,
+	}
+	defer func() {
+		data, e := json.Marshal(&reply)
+		returnedValue = data
+		err = e
+	}()
+
+	var req UpdateEntityRolesRequest
+
+	// Audit trail
+	defer func() {
+		rm.controller.audit.RecordContext(ctx, "authentication_manager.revokeRoles", req.AppID, reply.Success, reply.Reason)
+	}()
+
+	// Parsing request data
+	payload := ctx.Get("payload").(*packet_pb.Payload)
+	err = json.Unmarshal(payload.Data, &req)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = "UnknownParameter"
+		return
+	}
+
+	err = rm.RevokeRoles(req.AppID, req.Roles)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = err.Error()
+		return
+	}
+
+	return
+}
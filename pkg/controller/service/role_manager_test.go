@@ -0,0 +1,34 @@
+package controller
+
+import "testing"
+
+func TestDeleteRoleForbidsDefaultRoles(t *testing.T) {
+
+	rm := NewRoleManager(&Controller{})
+	for _, role := range defaultRoles {
+		rm.roles[role.Name] = role
+	}
+
+	tests := []struct {
+		name string
+		role string
+		err  string
+	}{
+		{"default role", "SUBSCRIBER", "Forbidden"},
+		{"another default role", "SYSTEM", "Forbidden"},
+		{"unknown role", "AUDITOR", "NotFoundRole"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := rm.DeleteRole(tt.role)
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("DeleteRole(%s) = %v, want %s", tt.role, err, tt.err)
+			}
+
+			if tt.err == "Forbidden" && rm.GetRole(tt.role) == nil {
+				t.Errorf("role %s was deleted", tt.role)
+			}
+		})
+	}
+}
@@ -0,0 +1,389 @@
+package controller
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BrobridgeOrg/broc"
+	"github.com/BrobridgeOrg/gravity-controller/pkg/controller/service/middleware"
+	"github.com/BrobridgeOrg/gravity-sdk/core/keyring"
+	log "github.com/sirupsen/logrus"
+)
+
+type Session struct {
+	ID          string    `json:"id"`
+	AppID       string    `json:"appID"`
+	Key         []byte    `json:"key"`
+	Permissions []string  `json:"permissions"`
+	Collections []string  `json:"collections"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+
+	keyInfo *keyring.KeyInfo
+}
+
+type sessionClaims struct {
+	ID        string `json:"sid"`
+	AppID     string `json:"appID"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// SessionManager issues short-lived credentials in exchange for entity tokens.
+// Session token is signed by controller and carried in packet as appID, the
+// session key is used to encrypt payload instead of the entity key.
+type SessionManager struct {
+	controller *Controller
+	secret     []byte
+	sessions   map[string]*Session
+	mutex      sync.RWMutex
+	rpcEngine  *broc.Broc
+}
+
+func NewSessionManager(controller *Controller) *SessionManager {
+	return &SessionManager{
+		controller: controller,
+		sessions:   make(map[string]*Session),
+	}
+}
+
+func (sm *SessionManager) Initialize() error {
+
+	store, err := sm.controller.store.GetEngine().GetStore("gravity_controller")
+	if err != nil {
+		return err
+	}
+
+	err = store.RegisterColumns([]string{"sessions"})
+	if err != nil {
+		return err
+	}
+
+	err = sm.loadSecret()
+	if err != nil {
+		return err
+	}
+
+	systemKey, err := sm.controller.keyringStore.getSystemKey()
+	if err != nil {
+		return err
+	}
+
+	log.Info("Trying to restoring sessions...")
+
+	now := time.Now()
+	return store.List("sessions", []byte("session-"), func(key []byte, value []byte) bool {
+
+		var session Session
+		err := json.Unmarshal(value, &session)
+		if err != nil {
+			log.Errorf("Unrecognized session: %s", string(key))
+			return true
+		}
+
+		if now.After(session.ExpiresAt) {
+			store.Delete("sessions", key)
+			return true
+		}
+
+		sessionKey, err := systemKey.Encryption().Decrypt(session.Key)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"appID": session.AppID,
+			}).Error("Failed to decrypt session key")
+			return true
+		}
+
+		session.keyInfo = sm.buildKey(&session, string(sessionKey))
+		sm.sessions[session.ID] = &session
+
+		return true
+	})
+}
+
+// loadSecret loads signing secret, a new one is generated for the first time
+func (sm *SessionManager) loadSecret() error {
+
+	store, err := sm.controller.store.GetEngine().GetStore("gravity_controller")
+	if err != nil {
+		return err
+	}
+
+	systemKey, err := sm.controller.keyringStore.getSystemKey()
+	if err != nil {
+		return err
+	}
+
+	data, err := store.GetBytes("sessions", []byte("secret"))
+	if err != nil {
+		return err
+	}
+
+	if len(data) > 0 {
+		secret, err := systemKey.Encryption().Decrypt(data)
+		if err != nil {
+			return err
+		}
+
+		sm.secret = secret
+
+		return nil
+	}
+
+	secret := make([]byte, 32)
+	_, err = rand.Read(secret)
+	if err != nil {
+		return err
+	}
+
+	encrypted, err := systemKey.Encryption().Encrypt(secret)
+	if err != nil {
+		return err
+	}
+
+	sm.secret = secret
+
+	return store.Put("sessions", []byte("secret"), encrypted)
+}
+
+func (sm *SessionManager) getTTL() time.Duration {
+	return time.Duration(sm.controller.getConfig().Session.TTL) * time.Second
+}
+
+func (sm *SessionManager) buildKey(session *Session, sessionKey string) *keyring.KeyInfo {
+	key := keyring.NewKey(session.AppID, sessionKey)
+	key.Permission().AddPermissions(session.Permissions)
+	key.Collection().AddCollections(session.Collections)
+	return key
+}
+
+func (sm *SessionManager) sign(data string) string {
+	mac := hmac.New(sha256.New, sm.secret)
+	mac.Write([]byte(data))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (sm *SessionManager) encodeToken(session *Session) string {
+
+	claims, _ := json.Marshal(&sessionClaims{
+		ID:        session.ID,
+		AppID:     session.AppID,
+		ExpiresAt: session.ExpiresAt.Unix(),
+	})
+
+	data := base64.RawURLEncoding.EncodeToString(claims)
+
+	return middleware.SessionPrefix + data + "." + sm.sign(data)
+}
+
+func (sm *SessionManager) decodeToken(token string) (*sessionClaims, error) {
+
+	parts := strings.Split(strings.TrimPrefix(token, middleware.SessionPrefix), ".")
+	if len(parts) != 2 {
+		return nil, middleware.ErrInvalidSession
+	}
+
+	if !hmac.Equal([]byte(sm.sign(parts[0])), []byte(parts[1])) {
+		return nil, middleware.ErrInvalidSession
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, middleware.ErrInvalidSession
+	}
+
+	var claims sessionClaims
+	err = json.Unmarshal(data, &claims)
+	if err != nil {
+		return nil, middleware.ErrInvalidSession
+	}
+
+	if time.Now().Unix() > claims.ExpiresAt {
+		return nil, middleware.ErrSessionExpired
+	}
+
+	return &claims, nil
+}
+
+func (sm *SessionManager) save(session *Session, sessionKey string) error {
+
+	store, err := sm.controller.store.GetEngine().GetStore("gravity_controller")
+	if err != nil {
+		return err
+	}
+
+	systemKey, err := sm.controller.keyringStore.getSystemKey()
+	if err != nil {
+		return err
+	}
+
+	encrypted, err := systemKey.Encryption().Encrypt([]byte(sessionKey))
+	if err != nil {
+		return err
+	}
+
+	s := *session
+	s.Key = encrypted
+
+	data, err := json.Marshal(&s)
+	if err != nil {
+		return err
+	}
+
+	return store.Put("sessions", []byte("session-"+session.ID), data)
+}
+
+func (sm *SessionManager) delete(sessionID string) {
+
+	store, err := sm.controller.store.GetEngine().GetStore("gravity_controller")
+	if err != nil {
+		log.Error(err)
+		return
+	}
+
+	err = store.Delete("sessions", []byte("session-"+sessionID))
+	if err != nil {
+		log.Error(err)
+	}
+}
+
+// Issue creates a session for app with permissions and collections, it returns session token and key
+func (sm *SessionManager) Issue(appID string, permissions []string, collections []string) (*Session, string, string, error) {
+
+	id, err := generateKey()
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	sessionKey, err := generateKey()
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	session := &Session{
+		ID:          id,
+		AppID:       appID,
+		Permissions: permissions,
+		Collections: collections,
+		ExpiresAt:   time.Now().Add(sm.getTTL()),
+	}
+	session.keyInfo = sm.buildKey(session, sessionKey)
+
+	err = sm.save(session, sessionKey)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	sm.mutex.Lock()
+	sm.sessions[id] = session
+	sm.prune()
+	sm.mutex.Unlock()
+
+	log.WithFields(log.Fields{
+		"appID":     appID,
+		"session":   id,
+		"expiresAt": session.ExpiresAt,
+	}).Info("Issued session")
+
+	return session, sm.encodeToken(session), sessionKey, nil
+}
+
+// prune drops expired sessions, caller must hold the lock
+func (sm *SessionManager) prune() {
+
+	now := time.Now()
+	for id, session := range sm.sessions {
+		if now.After(session.ExpiresAt) {
+			delete(sm.sessions, id)
+			sm.delete(id)
+		}
+	}
+}
+
+// GetSession verifies token and returns session
+func (sm *SessionManager) GetSession(token string) (*Session, error) {
+
+	claims, err := sm.decodeToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	sm.mutex.RLock()
+	session, ok := sm.sessions[claims.ID]
+	sm.mutex.RUnlock()
+	if !ok {
+		// Revoked
+		return nil, middleware.ErrInvalidSession
+	}
+
+	return session, nil
+}
+
+// Resolve returns key of session, it implements middleware.SessionResolver
+func (sm *SessionManager) Resolve(token string) (*keyring.KeyInfo, error) {
+
+	session, err := sm.GetSession(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return session.keyInfo, nil
+}
+
+// Refresh replaces session with a new one which has the same scope
+func (sm *SessionManager) Refresh(token string) (*Session, string, string, error) {
+
+	session, err := sm.GetSession(token)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	newSession, newToken, sessionKey, err := sm.Issue(session.AppID, session.Permissions, session.Collections)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	sm.Revoke(session.ID)
+
+	return newSession, newToken, sessionKey, nil
+}
+
+func (sm *SessionManager) Revoke(sessionID string) {
+
+	sm.mutex.Lock()
+	session, ok := sm.sessions[sessionID]
+	delete(sm.sessions, sessionID)
+	sm.mutex.Unlock()
+
+	if !ok {
+		return
+	}
+
+	sm.delete(sessionID)
+
+	log.WithFields(log.Fields{
+		"appID":   session.AppID,
+		"session": sessionID,
+	}).Info("Revoked session")
+}
+
+// RevokeApp revokes all sessions of app
+func (sm *SessionManager) RevokeApp(appID string) {
+
+	sm.mutex.RLock()
+	ids := make([]string, 0)
+	for id, session := range sm.sessions {
+		if session.AppID == appID {
+			ids = append(ids, id)
+		}
+	}
+	sm.mutex.RUnlock()
+
+	for _, id := range ids {
+		sm.Revoke(id)
+	}
+}
@@ -0,0 +1,280 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/BrobridgeOrg/broc"
+	packet_pb "github.com/BrobridgeOrg/gravity-api/packet"
+	"github.com/BrobridgeOrg/gravity-controller/pkg/controller/service/middleware"
+	"github.com/BrobridgeOrg/gravity-sdk/core/keyring"
+	"github.com/golang/protobuf/proto"
+	log "github.com/sirupsen/logrus"
+)
+
+type LoginRequest struct {
+	Token       string   `json:"token"`
+	Permissions []string `json:"permissions"`
+}
+
+type SessionReply struct {
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason,omitempty"`
+	Token     string    `json:"token,omitempty"`
+	Key       string    `json:"key,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt,omitempty"`
+}
+
+type RevokeSessionsRequest struct {
+	AppID string `json:"appID"`
+}
+
+type RevokeSessionsReply struct {
+	Success bool   `json:"success"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+func (sm *SessionManager) initializeRPC() error {
+
+	log.Info("Initializing RPC Handlers for SessionManager")
+
+	// Initializing authentication middleware
+	m := sm.controller.newMiddleware()
+
+	// Initializing RPC engine to handle requests
+	sm.rpcEngine = broc.NewBroc(sm.controller.gravityClient.GetConnection())
+	sm.rpcEngine.Use(m.PacketHandler)
+	sm.rpcEngine.SetPrefix(fmt.Sprintf("%s.authentication_manager.json.", sm.controller.domain))
+
+	// Register methods, login payload is encrypted by entity key
+	sm.rpcEngine.Register("login",
+		m.RateLimit("authentication_manager.login"),
+		sm.rpc_login,
+	)
+	sm.rpcEngine.Register("refreshSession",
+		m.RequiredAuth(),
+		m.RateLimit("authentication_manager.refreshSession"),
+		sm.rpc_refreshSession,
+	)
+	sm.rpcEngine.Register("revokeSession",
+		m.RequiredAuth(),
+		m.RateLimit("authentication_manager.revokeSession"),
+		sm.rpc_revokeSession,
+	)
+	sm.rpcEngine.Register("revokeSessions",
+		m.RequiredMethod("authentication_manager.revokeSessions"),
+		m.RateLimit("authentication_manager.revokeSessions"),
+		sm.rpc_revokeSessions,
+	)
+
+	return sm.rpcEngine.Apply()
+}
+
+func (sm *SessionManager) rpc_login(ctx *broc.Context) (interface{}, error) {
+
+	packet := ctx.Get("request").(*packet_pb.Packet)
+	appID := packet.AppID
+
+	entity, err := sm.controller.auth.getAuthenticator().GetEntity(appID)
+	if err != nil || entity == nil {
+		log.WithFields(log.Fields{
+			"appID": appID,
+		}).Warn("Denied login from unknown app")
+
+		return nil, middleware.ErrUnknownApp
+	}
+
+	// Payload is encrypted by entity key
+	entityKey := keyring.NewKey(appID, entity.AccessKey)
+	data, err := entityKey.Encryption().Decrypt(packet.Payload)
+	if err != nil {
+		return nil, middleware.ErrInvalidKey
+	}
+
+	err = sm.controller.replayGuard.Check(appID, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload packet_pb.Payload
+	err = proto.Unmarshal(data, &payload)
+	if err != nil {
+		return nil, middleware.ErrInvalidPayload
+	}
+
+	reply := sm.login(appID, payload.Data)
+
+	// Audit trail
+	sm.controller.audit.Record(appID, "authentication_manager.login", appID, reply.Success, reply.Reason)
+
+	returnedData, err := json.Marshal(reply)
+	if err != nil {
+		return nil, err
+	}
+
+	return entityKey.Encryption().Encrypt(returnedData)
+}
+
+func (sm *SessionManager) login(appID string, data []byte) *SessionReply {
+
+	reply := &SessionReply{
+		Success: true,
+	}
+
+	var req LoginRequest
+	err := json.Unmarshal(data, &req)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = "UnknownParameter"
+		return reply
+	}
+
+	entity, err := sm.controller.auth.authenticate(appID, []byte(req.Token))
+	if err != nil {
+		reply.Success = false
+		reply.Reason = "Forbidden"
+		return reply
+	}
+
+	// Session is able to be scoped down to part of permissions
+	permissions := getStrings(entity.Properties, "permissions")
+	if len(req.Permissions) > 0 {
+		granted := make(map[string]bool)
+		for _, perm := range permissions {
+			granted[perm] = true
+		}
+
+		permissions = make([]string, 0, len(req.Permissions))
+		for _, perm := range req.Permissions {
+			if !granted[perm] {
+				reply.Success = false
+				reply.Reason = "PermissionDenied"
+				return reply
+			}
+
+			permissions = append(permissions, perm)
+		}
+	}
+
+	session, token, sessionKey, err := sm.Issue(appID, permissions, getStrings(entity.Properties, "collections"))
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = err.Error()
+		return reply
+	}
+
+	reply.Token = token
+	reply.Key = sessionKey
+	reply.ExpiresAt = session.ExpiresAt
+
+	return reply
+}
+
+func (sm *SessionManager) rpc_refreshSession(ctx *broc.Context) (returnedValue interface{}, err error) {
+
+	// Reply
+	reply := SessionReply{
+		Success: true,
+	}
+	defer func() {
+		data, e := json.Marshal(&reply)
+		returnedValue = data
+		err = e
+	}()
+
+	// Only sessions are able to be refreshed
+	packet := ctx.Get("request").(*packet_pb.Packet)
+	if !strings.HasPrefix(packet.AppID, middleware.SessionPrefix) {
+		reply.Success = false
+		reply.Reason = middleware.ErrInvalidSession.Error()
+		return
+	}
+
+	session, token, sessionKey, err := sm.Refresh(packet.AppID)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = err.Error()
+		return
+	}
+
+	reply.Token = token
+	reply.Key = sessionKey
+	reply.ExpiresAt = session.ExpiresAt
+
+	return
+}
+
+func (sm *SessionManager) rpc_revokeSession(ctx *broc.Context) (returnedValue interface{}, err error) {
+
+	// Reply
+	reply := SessionReply{
+		Success: true,
+	}
+	defer func() {
+		data, e := json.Marshal(&reply)
+		returnedValue = data
+		err = e
+	}()
+
+	// Session revokes itself
+	packet := ctx.Get("request").(*packet_pb.Packet)
+	if !strings.HasPrefix(packet.AppID, middleware.SessionPrefix) {
+		reply.Success = false
+		reply.Reason = middleware.ErrInvalidSession.Error()
+		return
+	}
+
+	session, err := sm.GetSession(packet.AppID)
+	if err != nil {
+		reply.Success = false
+		reply.Reason = err.Error()
+		return
+	}
+
+	sm.Revoke(session.ID)
+
+	return
+}
+
+func (sm *SessionManager) rpc_revokeSessions(ctx *broc.Context) (returnedValue interface{}, err error) {
+
+	// Reply
+	reply := RevokeSessionsReply{
+		Success: true,
+	}
+	defer func() {
+		data, e := json.Marshal(&reply)
+		returnedValue = data
+		err = e
+	}()
+
+	var req RevokeSessionsRequest
+
+	// Audit trail
+	defer func() {
+		sm.controller.audit.RecordContext(ctx, "authentication_manager.revokeSessions", req.AppID, reply.Success, reply.Reason)
+	}()
+
+	// Parsing request data
+	payload := ctx.Get("payload").(*packet_pb.Payload)
+	err = json.Unmarshal(payload.Data, &req)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = "UnknownParameter"
+		return
+	}
+
+	sm.RevokeApp(req.AppID)
+
+	return
+}
@@ -3,13 +3,11 @@ package controller
 import (
 	gravity_store "github.com/BrobridgeOrg/gravity-sdk/core/store"
 	log "github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
 )
 
 func (controller *Controller) initializeStore() error {
 
-	viper.SetDefault("controller.storePath", "./datastore")
-	storePath := viper.GetString("controller.storePath")
+	storePath := controller.getConfig().Controller.StorePath
 
 	log.WithFields(log.Fields{
 		"path": storePath,
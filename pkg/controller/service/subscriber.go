@@ -21,6 +21,7 @@ type Subscriber struct {
 	collections    sync.Map
 	lastCheck      time.Time
 	properties     map[string]interface{}
+	labels         map[string]string
 }
 
 func NewSubscriber(controller *Controller, subscriberType subscriber_manager_pb.SubscriberType, component string, id string, name string, properties map[string]interface{}) *Subscriber {
@@ -32,6 +33,7 @@ func NewSubscriber(controller *Controller, subscriberType subscriber_manager_pb.
 		subscriberType: subscriberType,
 		lastCheck:      time.Now(),
 		properties:     make(map[string]interface{}),
+		labels:         make(map[string]string),
 	}
 
 	for key, value := range properties {
@@ -63,6 +65,7 @@ func (sc *Subscriber) save() error {
 		"type":        int32(sc.subscriberType),
 		"collections": collections,
 		"properties":  sc.properties,
+		"labels":      sc.labels,
 	})
 	if err != nil {
 		return err
@@ -107,6 +110,8 @@ func (sc *Subscriber) addCollections(collections []string) []string {
 		results = append(results, col)
 	}
 
+	sc.controller.collectionIndex.AddSubscriber(sc.id, results)
+
 	return results
 }
 
@@ -137,8 +142,44 @@ func (sc *Subscriber) subscribeToCollections(eventstoreID string, collections []
 	return nil
 }
 
+// checkQuota makes sure subscriber doesn't subscribe to too many collections
+func (sc *Subscriber) checkQuota(collections []string) error {
+
+	max := sc.controller.getConfig().Quota.MaxCollectionsPerSubscriber
+	if max == 0 {
+		return nil
+	}
+
+	count := len(sc.GetCollections())
+	added := make(map[string]bool)
+	for _, col := range collections {
+		if _, ok := sc.collections.Load(col); ok || added[col] {
+			continue
+		}
+
+		added[col] = true
+		count++
+	}
+
+	if count > max {
+		log.WithFields(log.Fields{
+			"subscriber": sc.id,
+			"max":        max,
+		}).Warn("Exceeded collection quota")
+
+		return ErrQuotaExceeded
+	}
+
+	return nil
+}
+
 func (sc *Subscriber) SubscribeToCollections(collections []string) ([]string, error) {
 
+	err := sc.checkQuota(collections)
+	if err != nil {
+		return nil, err
+	}
+
 	results := sc.addCollections(collections)
 
 	// Call all synchronizers to subscribe
@@ -153,7 +194,7 @@ func (sc *Subscriber) SubscribeToCollections(collections []string) ([]string, er
 	}
 
 	// Save state
-	err := sc.save()
+	err = sc.save()
 	if err != nil {
 		log.Error(err)
 	}
@@ -161,13 +202,57 @@ func (sc *Subscriber) SubscribeToCollections(collections []string) ([]string, er
 	return results, nil
 }
 
+func (sc *Subscriber) unsubscribeFromCollections(eventstoreID string, collections []string) error {
+
+	request := synchronizer_pb.UnsubscribeFromCollectionsRequest{
+		SubscriberID: sc.id,
+		Collections:  collections,
+	}
+
+	msg, _ := proto.Marshal(&request)
+
+	respData, err := sc.controller.synchronizerManager.Request(eventstoreID, "unsubscribeFromCollections", msg)
+	if err != nil {
+		return err
+	}
+
+	var reply synchronizer_pb.UnsubscribeFromCollectionsReply
+	err = proto.Unmarshal(respData, &reply)
+	if err != nil {
+		return err
+	}
+
+	if !reply.Success {
+		return errors.New(reply.Reason)
+	}
+
+	return nil
+}
+
 func (sc *Subscriber) UnsubscribeFromCollections(collections []string) ([]string, error) {
 
 	for _, col := range collections {
 		sc.collections.Delete(col)
 	}
 
-	// TODO: call synchronizer
+	sc.controller.collectionIndex.RemoveSubscriber(sc.id, collections)
+
+	// Call all synchronizers to unsubscribe
+	for synchronizerID, _ := range sc.controller.synchronizerManager.GetSynchronizers() {
+		err := sc.unsubscribeFromCollections(synchronizerID, collections)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"synchronizer": synchronizerID,
+			}).Error(err)
+			return nil, err
+		}
+	}
+
+	// Save state
+	err := sc.save()
+	if err != nil {
+		log.Error(err)
+	}
 
 	return collections, nil
 }
@@ -10,52 +10,44 @@ import (
 	synchronizer_pb "github.com/BrobridgeOrg/gravity-api/service/synchronizer"
 	"github.com/golang/protobuf/proto"
 	log "github.com/sirupsen/logrus"
-	"github.com/spf13/viper"
 )
 
 var (
 	ErrSubscriberNotFound = errors.New("subscriber manager: subscriber not found")
+	ErrQuotaExceeded      = errors.New("QuotaExceeded")
 )
 
 type SubscriberManager struct {
-	controller     *Controller
-	allowAnonymous bool
-	rpcEngine      *broc.Broc
-	subscribers    map[string]*Subscriber
-	mutex          sync.RWMutex
+	controller  *Controller
+	rpcEngine   *broc.Broc
+	jsonEngine  *broc.Broc
+	subscribers map[string]*Subscriber
+	mutex       sync.RWMutex
 }
 
 func NewSubscriberManager(controller *Controller) *SubscriberManager {
 	return &SubscriberManager{
-		controller:     controller,
-		allowAnonymous: false,
-		subscribers:    make(map[string]*Subscriber),
+		controller:  controller,
+		subscribers: make(map[string]*Subscriber),
 	}
 }
 
 func (sm *SubscriberManager) Initialize() error {
 
 	// Load configurations
-	viper.SetDefault("subscriber_manager.allowAnonymous", true)
-	sm.allowAnonymous = viper.GetBool("subscriber_manager.allowAnonymous")
-	if sm.allowAnonymous {
-		key := sm.controller.keyring.Get("anonymous")
-		if key == nil {
-			key = sm.controller.keyring.Put("anonymous", "")
-		}
-
-		key.Permission().AddPermissions([]string{"SUBSCRIBER"})
+	if sm.isAnonymousAllowed() {
+		sm.controller.setAnonymousPermission("SUBSCRIBER", true)
 	}
 
 	// Restore states from store
 	store, err := sm.controller.store.GetEngine().GetStore("gravity_subscriber_manager")
 	if err != nil {
-		return nil
+		return err
 	}
 
 	err = store.RegisterColumns([]string{"subscribers"})
 	if err != nil {
-		return nil
+		return err
 	}
 
 	log.Info("Trying to restoring subscribers...")
@@ -98,6 +90,8 @@ func (sm *SubscriberManager) Initialize() error {
 			"type":      subscriber_manager_pb.SubscriberType_name[int32(subscriber.subscriberType)],
 		}).Info("Restored subscriber")
 
+		subscriber.labels = parseLabels(data["labels"])
+
 		if data["collections"] != nil {
 			cols := data["collections"].([]interface{})
 
@@ -125,11 +119,52 @@ func (sm *SubscriberManager) Initialize() error {
 	return nil
 }
 
+func (sm *SubscriberManager) isAnonymousAllowed() bool {
+	return sm.controller.getConfig().SubscriberManager.AllowAnonymous
+}
+
+// SetAllowAnonymous updates permission of anonymous key, the setting itself is kept in configurations
+func (sm *SubscriberManager) SetAllowAnonymous(allowAnonymous bool) {
+
+	key := sm.controller.setAnonymousPermission("SUBSCRIBER", allowAnonymous)
+	if key != nil {
+		sm.controller.synchronizerManager.UpdateKeyring(key)
+	}
+
+	log.WithFields(log.Fields{
+		"allowAnonymous": allowAnonymous,
+	}).Info("Applied anonymous access setting for subscribers")
+}
+
 func (sm *SubscriberManager) addSubscriber(subscriberType subscriber_manager_pb.SubscriberType, component string, subscriberID string, name string, properties map[string]interface{}) (*Subscriber, error) {
 
 	sm.mutex.Lock()
 	defer sm.mutex.Unlock()
 
+	return sm.putSubscriber(subscriberType, component, subscriberID, name, properties)
+}
+
+// addSubscriberWithQuota adds subscriber of app if quota allows, quota is
+// checked under the same lock so concurrent registrations cannot exceed it.
+func (sm *SubscriberManager) addSubscriberWithQuota(appID string, subscriberType subscriber_manager_pb.SubscriberType, component string, subscriberID string, name string, properties map[string]interface{}) (*Subscriber, error) {
+
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	// Existing subscriber is able to register again
+	if _, ok := sm.subscribers[subscriberID]; !ok {
+		err := sm.checkQuota(appID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return sm.putSubscriber(subscriberType, component, subscriberID, name, properties)
+}
+
+// putSubscriber creates subscriber, mutex must be held by caller
+func (sm *SubscriberManager) putSubscriber(subscriberType subscriber_manager_pb.SubscriberType, component string, subscriberID string, name string, properties map[string]interface{}) (*Subscriber, error) {
+
 	_, ok := sm.subscribers[subscriberID]
 	if ok {
 		return nil, errors.New("Exists")
@@ -142,6 +177,33 @@ func (sm *SubscriberManager) addSubscriber(subscriberType subscriber_manager_pb.
 	return subscriber, nil
 }
 
+// checkQuota makes sure app doesn't own too many subscribers, mutex must be held by caller
+func (sm *SubscriberManager) checkQuota(appID string) error {
+
+	max := sm.controller.getConfig().Quota.MaxSubscribersPerApp
+	if max == 0 {
+		return nil
+	}
+
+	count := 0
+	for _, subscriber := range sm.subscribers {
+		if v, ok := subscriber.properties["auth.appID"]; ok && v == appID {
+			count++
+		}
+	}
+
+	if count >= max {
+		log.WithFields(log.Fields{
+			"appID": appID,
+			"max":   max,
+		}).Warn("Exceeded subscriber quota")
+
+		return ErrQuotaExceeded
+	}
+
+	return nil
+}
+
 func (sm *SubscriberManager) register(eventstoreID string, subscriberID string, appID string, accessKey string) error {
 
 	request := synchronizer_pb.RegisterSubscriberRequest{
@@ -174,29 +236,40 @@ func (sm *SubscriberManager) register(eventstoreID string, subscriberID string,
 
 func (sm *SubscriberManager) Register(subscriberType subscriber_manager_pb.SubscriberType, component string, appID string, token []byte, subscriberID string, name string, properties map[string]interface{}) error {
 
-	key := sm.controller.auth.Authenticate(appID, token, sm.allowAnonymous)
+	key := sm.controller.auth.Authenticate(appID, token, sm.isAnonymousAllowed())
 	if key == nil {
 		return errors.New("Forbidden")
 	}
 
-	properties["auth.appID"] = appID
+	// Key may be resolved to another app, such as anonymous
+	properties["auth.appID"] = key.GetAppID()
 	properties["auth.appKey"] = string(key.Encryption().GetKey())
 
-	// Update keyring to syncronizer
-	sm.controller.synchronizerManager.UpdateKeyring(key)
-
-	subscriber, err := sm.addSubscriber(subscriberType, component, subscriberID, name, properties)
+	// Subscribers are counted by resolved app
+	subscriber, err := sm.addSubscriberWithQuota(key.GetAppID(), subscriberType, component, subscriberID, name, properties)
 	if err != nil {
 		if err.Error() == "Exists" {
 			log.WithFields(log.Fields{
 				"subscriber": subscriberID,
 			}).Warn("Subscriber exists already")
+
+			// Update keyring to syncronizer
+			sm.controller.synchronizerManager.UpdateKeyring(key)
 			return nil
 		}
 
 		return err
 	}
 
+	// Update keyring to syncronizer
+	sm.controller.synchronizerManager.UpdateKeyring(key)
+
+	// Persist key so it survives restarts, it is released on unregister
+	err = sm.controller.keyringStore.Ref(key)
+	if err != nil {
+		log.Error(err)
+	}
+
 	log.WithFields(log.Fields{
 		"subscriberID": subscriberID,
 		"name":         name,
@@ -220,29 +293,49 @@ func (sm *SubscriberManager) Register(subscriberType subscriber_manager_pb.Subsc
 		log.Error(err)
 	}
 
+	sm.controller.events.PublishSubscriber(EventSubscriberRegistered, subscriber)
+
 	return nil
 }
 
 func (sm *SubscriberManager) Unregister(subscriberID string) error {
 
 	sm.mutex.Lock()
-	defer sm.mutex.Unlock()
 
 	// Release
 	subscriber, ok := sm.subscribers[subscriberID]
 	if !ok {
+		sm.mutex.Unlock()
 		return nil
 	}
 
-	if sm.controller.auth.enabledAuthService {
-		appID := subscriber.properties["auth.appID"].(string)
-		sm.controller.keyring.Unref(appID)
-	}
-
 	subscriber.release()
 
 	// Remove subscriber from registry
 	delete(sm.subscribers, subscriberID)
+	sm.controller.collectionIndex.RemoveSubscriber(subscriberID, subscriber.GetCollections())
+
+	sm.mutex.Unlock()
+
+	// Keys of entities are referenced by subscribers
+	if appID, ok := subscriber.properties["auth.appID"].(string); ok && !isConfigurationKey(appID) {
+		sm.controller.keyring.Unref(appID)
+
+		released, err := sm.controller.keyringStore.Unref(appID)
+		if err != nil {
+			log.Error(err)
+		}
+
+		// Nobody uses this key anymore
+		if released {
+			err = sm.controller.RevokeKey(appID)
+			if err != nil {
+				log.Error(err)
+			}
+		}
+	}
+
+	sm.controller.events.PublishSubscriber(EventSubscriberUnregistered, subscriber)
 
 	return nil
 }
@@ -271,6 +364,32 @@ func (sm *SubscriberManager) UpdateSubscriberProps(subscriberID string, props ma
 	return nil
 }
 
+// SetLabels changes labels of subscriber and returns the result
+func (sm *SubscriberManager) SetLabels(subscriberID string, changes map[string]*string) (map[string]string, error) {
+
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	s, ok := sm.subscribers[subscriberID]
+	if !ok {
+		return nil, ErrSubscriberNotFound
+	}
+
+	labels, err := PatchLabels(s.labels, changes)
+	if err != nil {
+		return nil, err
+	}
+
+	s.labels = labels
+
+	err = s.save()
+	if err != nil {
+		return nil, err
+	}
+
+	return copyLabels(labels), nil
+}
+
 func (sm *SubscriberManager) HealthCheck(subscriberID string) error {
 
 	sm.mutex.RLock()
@@ -306,3 +425,21 @@ func (sm *SubscriberManager) GetSubscribers() ([]*Subscriber, error) {
 
 	return subscribers, nil
 }
+
+// GetCollectionSubscribers returns subscribers which subscribed to collection
+func (sm *SubscriberManager) GetCollectionSubscribers(collectionID string) []*Subscriber {
+
+	refs := sm.controller.collectionIndex.GetRefs(collectionID)
+
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	subscribers := make([]*Subscriber, 0, len(refs.Subscribers))
+	for _, subscriberID := range refs.Subscribers {
+		if subscriber, ok := sm.subscribers[subscriberID]; ok {
+			subscribers = append(subscribers, subscriber)
+		}
+	}
+
+	return subscribers
+}
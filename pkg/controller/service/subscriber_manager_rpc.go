@@ -1,7 +1,10 @@
 package controller
 
 import (
+	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/BrobridgeOrg/broc"
 	packet_pb "github.com/BrobridgeOrg/gravity-api/packet"
@@ -13,38 +16,90 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+type SubscriberInfo struct {
+	SubscriberID string            `json:"subscriberID"`
+	Name         string            `json:"name"`
+	Type         string            `json:"type"`
+	Component    string            `json:"component"`
+	AppID        string            `json:"appID,omitempty"`
+	Collections  []string          `json:"collections"`
+	Labels       map[string]string `json:"labels"`
+	LastCheck    time.Time         `json:"lastCheck"`
+}
+
+type ListSubscribersReply struct {
+	Success     bool              `json:"success"`
+	Reason      string            `json:"reason,omitempty"`
+	Subscribers []*SubscriberInfo `json:"subscribers"`
+}
+
 func (sm *SubscriberManager) initializeRPC() error {
 
 	log.Info("Initializing RPC Handlers for SubscriberManager")
 
 	// Initializing authentication middleware
-	m := middleware.NewMiddleware(map[string]interface{}{
-		"Authentication": &middleware.Authentication{
-			Enabled: true,
-			Keyring: sm.controller.keyring,
-		},
-	})
+	m := sm.controller.newMiddleware()
 
 	// Initializing RPC engine to handle requests
 	sm.rpcEngine = broc.NewBroc(sm.controller.gravityClient.GetConnection())
 	sm.rpcEngine.Use(m.PacketHandler)
 	sm.rpcEngine.SetPrefix(fmt.Sprintf("%s.subscriber_manager.", sm.controller.domain))
 
+	// Methods which are not defined by gravity-api are encoded in JSON, they are
+	// served under a prefix of their own
+	sm.jsonEngine = broc.NewBroc(sm.controller.gravityClient.GetConnection())
+	sm.jsonEngine.Use(m.PacketHandler)
+	sm.jsonEngine.SetPrefix(fmt.Sprintf("%s.subscriber_manager.json.", sm.controller.domain))
+
 	// Register methods
-	sm.rpcEngine.Register("registerSubscriber", m.RequiredAuth(), sm.rpc_registerSubscriber)
-	sm.rpcEngine.Register("unregisterSubscriber", m.RequiredAuth("SUBSCRIBER"), sm.rpc_unregisterSubscriber)
+	// Any known app is able to register subscriber
+	sm.rpcEngine.Register("registerSubscriber",
+		m.RequiredAuth(),
+		m.RateLimit("subscriber_manager.registerSubscriber"),
+		sm.rpc_registerSubscriber,
+	)
+	sm.rpcEngine.Register("unregisterSubscriber",
+		m.RequiredMethod("subscriber_manager.unregisterSubscriber"),
+		m.RateLimit("subscriber_manager.unregisterSubscriber"),
+		sm.rpc_unregisterSubscriber,
+	)
 	sm.rpcEngine.Register("updateSubscriberProps",
-		m.RequiredAuth("SYSTEM", "SUBSCRIBER_MANAGER", "SUBSCRIBER"),
+		m.RequiredMethod("subscriber_manager.updateSubscriberProps"),
+		m.RateLimit("subscriber_manager.updateSubscriberProps"),
 		sm.rpc_updateSubscriberProps,
 	)
-	sm.rpcEngine.Register("healthCheck", m.RequiredAuth("SUBSCRIBER"), sm.rpc_healthCheck)
+	sm.rpcEngine.Register("healthCheck",
+		m.RequiredMethod("subscriber_manager.healthCheck"),
+		m.RateLimit("subscriber_manager.healthCheck"),
+		sm.rpc_healthCheck,
+	)
 	sm.rpcEngine.Register("getSubscribers",
-		m.RequiredAuth("SYSTEM", "SUBSCRIBER_MANAGER"),
+		m.RequiredMethod("subscriber_manager.getSubscribers"),
+		m.RateLimit("subscriber_manager.getSubscribers"),
 		sm.rpc_getSubscribers,
 	)
-	sm.rpcEngine.Register("subscribeToCollections", m.RequiredAuth("SUBSCRIBER"), sm.rpc_subscribeToCollections)
+	sm.rpcEngine.Register("subscribeToCollections",
+		m.RequiredMethod("subscriber_manager.subscribeToCollections"),
+		m.RateLimit("subscriber_manager.subscribeToCollections"),
+		sm.rpc_subscribeToCollections,
+	)
+	sm.jsonEngine.Register("setSubscriberLabels",
+		m.RequiredMethod("subscriber_manager.setSubscriberLabels"),
+		m.RateLimit("subscriber_manager.setSubscriberLabels"),
+		sm.rpc_setSubscriberLabels,
+	)
+	sm.jsonEngine.Register("listSubscribers",
+		m.RequiredMethod("subscriber_manager.listSubscribers"),
+		m.RateLimit("subscriber_manager.listSubscribers"),
+		sm.rpc_listSubscribers,
+	)
 
-	return sm.rpcEngine.Apply()
+	err := sm.rpcEngine.Apply()
+	if err != nil {
+		return err
+	}
+
+	return sm.jsonEngine.Apply()
 }
 
 func (sm *SubscriberManager) rpc_registerSubscriber(ctx *broc.Context) (returnedValue interface{}, err error) {
@@ -59,8 +114,14 @@ func (sm *SubscriberManager) rpc_registerSubscriber(ctx *broc.Context) (returned
 		err = e
 	}()
 
-	// Parsing request data
 	var req subscriber_manager_pb.RegisterSubscriberRequest
+
+	// Audit trail
+	defer func() {
+		sm.controller.audit.RecordContext(ctx, "subscriber_manager.registerSubscriber", req.SubscriberID, reply.Success, reply.Reason)
+	}()
+
+	// Parsing request data
 	payload := ctx.Get("payload").(*packet_pb.Payload)
 	err = proto.Unmarshal(payload.Data, &req)
 	if err != nil {
@@ -107,8 +168,14 @@ func (sm *SubscriberManager) rpc_unregisterSubscriber(ctx *broc.Context) (return
 		err = e
 	}()
 
-	// Parsing request data
 	var req subscriber_manager_pb.UnregisterSubscriberRequest
+
+	// Audit trail
+	defer func() {
+		sm.controller.audit.RecordContext(ctx, "subscriber_manager.unregisterSubscriber", req.SubscriberID, reply.Success, reply.Reason)
+	}()
+
+	// Parsing request data
 	payload := ctx.Get("payload").(*packet_pb.Payload)
 	err = proto.Unmarshal(payload.Data, &req)
 	if err != nil {
@@ -144,8 +211,14 @@ func (sm *SubscriberManager) rpc_updateSubscriberProps(ctx *broc.Context) (retur
 		err = e
 	}()
 
-	// Parsing request data
 	var req subscriber_manager_pb.UpdateSubscriberPropsRequest
+
+	// Audit trail
+	defer func() {
+		sm.controller.audit.RecordContext(ctx, "subscriber_manager.updateSubscriberProps", req.SubscriberID, reply.Success, reply.Reason)
+	}()
+
+	// Parsing request data
 	payload := ctx.Get("payload").(*packet_pb.Payload)
 	err = proto.Unmarshal(payload.Data, &req)
 	if err != nil {
@@ -256,8 +329,8 @@ func (sm *SubscriberManager) rpc_getSubscribers(ctx *broc.Context) (returnedValu
 	}
 
 	// Preparing results
-	subscribers := make([]*subscriber_manager_pb.Subscriber, len(results))
-	for i, subscriber := range results {
+	subscribers := make([]*subscriber_manager_pb.Subscriber, 0, len(results))
+	for _, subscriber := range results {
 
 		lastCheck, _ := ptypes.TimestampProto(subscriber.lastCheck)
 
@@ -297,7 +370,7 @@ func (sm *SubscriberManager) rpc_getSubscribers(ctx *broc.Context) (returnedValu
 			s.Pipelines = pipelines
 		}
 
-		subscribers[i] = s
+		subscribers = append(subscribers, s)
 	}
 
 	reply.Subscribers = subscribers
@@ -317,8 +390,14 @@ func (sm *SubscriberManager) rpc_subscribeToCollections(ctx *broc.Context) (retu
 		err = e
 	}()
 
-	// Parsing request data
 	var req subscriber_manager_pb.SubscribeToCollectionsRequest
+
+	// Audit trail
+	defer func() {
+		sm.controller.audit.RecordContext(ctx, "subscriber_manager.subscribeToCollections", req.SubscriberID, reply.Success, reply.Reason)
+	}()
+
+	// Parsing request data
 	payload := ctx.Get("payload").(*packet_pb.Payload)
 	err = proto.Unmarshal(payload.Data, &req)
 	if err != nil {
@@ -335,22 +414,18 @@ func (sm *SubscriberManager) rpc_subscribeToCollections(ctx *broc.Context) (retu
 		return
 	}
 
-	// Check collection permission
+	// Request is rejected if any of collections is not granted, reason carries
+	// names of the denied ones
 	key := ctx.Get("key").(*keyring.KeyInfo)
-	targetCollections := make([]string, 0)
-	for _, collection := range req.Collections {
+	targetCollections, denied := middleware.FilterCollections(key, req.Collections)
+	if len(denied) > 0 {
+		log.WithFields(log.Fields{
+			"appID":       key.GetAppID(),
+			"collections": strings.Join(denied, ","),
+		}).Warn("Forbidden to subscribe to collections")
 
-		// Ignore collection that no permission to access
-		if !key.Collection().Check(collection) {
-			continue
-		}
-
-		targetCollections = append(targetCollections, collection)
-	}
-
-	if len(targetCollections) == 0 {
 		reply.Success = false
-		reply.Reason = "NoPermission"
+		reply.Reason = "Forbidden: " + strings.Join(denied, ",")
 		return
 	}
 
@@ -363,7 +438,11 @@ func (sm *SubscriberManager) rpc_subscribeToCollections(ctx *broc.Context) (retu
 		return
 	}
 
-	collections, err := subscriber.SubscribeToCollections(req.Collections)
+	var collections []string
+	err = sm.controller.collectionManager.Reference(func() error {
+		collections, err = subscriber.SubscribeToCollections(targetCollections)
+		return err
+	})
 	if err != nil {
 		log.Error(err)
 
@@ -376,3 +455,107 @@ func (sm *SubscriberManager) rpc_subscribeToCollections(ctx *broc.Context) (retu
 
 	return
 }
+
+func (sm *SubscriberManager) rpc_setSubscriberLabels(ctx *broc.Context) (returnedValue interface{}, err error) {
+
+	// Reply
+	reply := SetLabelsReply{
+		Success: true,
+	}
+	defer func() {
+		data, e := json.Marshal(&reply)
+		returnedValue = data
+		err = e
+	}()
+
+	var req SetLabelsRequest
+
+	// Audit trail
+	defer func() {
+		sm.controller.audit.RecordContext(ctx, "subscriber_manager.setSubscriberLabels", req.ID, reply.Success, reply.Reason)
+	}()
+
+	// Parsing request data
+	payload := ctx.Get("payload").(*packet_pb.Payload)
+	err = json.Unmarshal(payload.Data, &req)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = "UnknownParameter"
+		return
+	}
+
+	labels, err := sm.SetLabels(req.ID, req.Labels)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = err.Error()
+		return
+	}
+
+	reply.Labels = labels
+
+	return
+}
+
+func (sm *SubscriberManager) rpc_listSubscribers(ctx *broc.Context) (returnedValue interface{}, err error) {
+
+	// Reply
+	reply := ListSubscribersReply{
+		Success: true,
+	}
+	defer func() {
+		data, e := json.Marshal(&reply)
+		returnedValue = data
+		err = e
+	}()
+
+	// Parsing request data
+	var req ListRequest
+	payload := ctx.Get("payload").(*packet_pb.Payload)
+	err = json.Unmarshal(payload.Data, &req)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = "UnknownParameter"
+		return
+	}
+
+	selector, err := ParseLabelSelector(req.Selector)
+	if err != nil {
+		reply.Success = false
+		reply.Reason = err.Error()
+		return
+	}
+
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	subscribers := make([]*SubscriberInfo, 0, len(sm.subscribers))
+	for _, subscriber := range sm.subscribers {
+
+		if !selector.Matches(subscriber.labels) {
+			continue
+		}
+
+		appID, _ := subscriber.properties["auth.appID"].(string)
+
+		subscribers = append(subscribers, &SubscriberInfo{
+			SubscriberID: subscriber.id,
+			Name:         subscriber.name,
+			Type:         subscriber_manager_pb.SubscriberType_name[int32(subscriber.subscriberType)],
+			Component:    subscriber.component,
+			AppID:        appID,
+			Collections:  subscriber.GetCollections(),
+			Labels:       copyLabels(subscriber.labels),
+			LastCheck:    subscriber.lastCheck,
+		})
+	}
+
+	reply.Subscribers = subscribers
+
+	return
+}
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	subscriber_manager_pb "github.com/BrobridgeOrg/gravity-api/service/subscriber_manager"
+	"github.com/BrobridgeOrg/gravity-controller/pkg/config"
+)
+
+func newQuotaSubscriberManager(max int) *SubscriberManager {
+
+	controller := &Controller{}
+
+	c := &config.Config{}
+	c.Quota.MaxSubscribersPerApp = max
+	controller.config.Store(c)
+
+	return NewSubscriberManager(controller)
+}
+
+func addQuotaSubscriber(sm *SubscriberManager, appID string, subscriberID string) error {
+
+	properties := map[string]interface{}{
+		"auth.appID": appID,
+	}
+
+	_, err := sm.addSubscriberWithQuota(appID, subscriber_manager_pb.SubscriberType(0), "test", subscriberID, subscriberID, properties)
+
+	return err
+}
+
+func TestAddSubscriberWithQuotaConcurrently(t *testing.T) {
+
+	sm := newQuotaSubscriberManager(3)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- addQuotaSubscriber(sm, "app", fmt.Sprintf("subscriber-%d", i))
+		}(i)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	added := 0
+	for err := range errs {
+		switch err {
+		case nil:
+			added++
+		case ErrQuotaExceeded:
+		default:
+			t.Fatalf("addSubscriberWithQuota() error = %v", err)
+		}
+	}
+
+	if added != 3 {
+		t.Errorf("%d subscribers were added, want 3", added)
+	}
+}
+
+func TestAddSubscriberWithQuota(t *testing.T) {
+
+	sm := newQuotaSubscriberManager(1)
+
+	err := addQuotaSubscriber(sm, "app", "subscriber-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		appID        string
+		subscriberID string
+		err          string
+	}{
+		{"quota exceeded", "app", "subscriber-2", ErrQuotaExceeded.Error()},
+		{"existing subscriber", "app", "subscriber-1", "Exists"},
+		{"another app", "other", "subscriber-3", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := addQuotaSubscriber(sm, tt.appID, tt.subscriberID)
+			if len(tt.err) == 0 {
+				if err != nil {
+					t.Errorf("addSubscriberWithQuota() = %v, want nil", err)
+				}
+				return
+			}
+
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("addSubscriberWithQuota() = %v, want %s", err, tt.err)
+			}
+		})
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"time"
 
 	packet_pb "github.com/BrobridgeOrg/gravity-api/packet"
 	synchronizer_pb "github.com/BrobridgeOrg/gravity-api/service/synchronizer"
@@ -17,6 +16,7 @@ type Synchronizer struct {
 	synchronizerManager *SynchronizerManager
 	id                  string
 	pipelines           []uint64
+	labels              map[string]string
 }
 
 func NewSynchronizer(sm *SynchronizerManager, id string) *Synchronizer {
@@ -24,6 +24,7 @@ func NewSynchronizer(sm *SynchronizerManager, id string) *Synchronizer {
 		synchronizerManager: sm,
 		id:                  id,
 		pipelines:           make([]uint64, 0),
+		labels:              make(map[string]string),
 	}
 }
 
@@ -64,7 +65,7 @@ func (synchronizer *Synchronizer) request(eventstoreID string, method string, da
 
 	// Send request
 	channel := fmt.Sprintf("%s.eventstore.%s.%s", synchronizer.synchronizerManager.controller.domain, eventstoreID, method)
-	resp, err := conn.Request(channel, msg, time.Second*10)
+	resp, err := conn.Request(channel, msg, synchronizer.synchronizerManager.controller.getRequestTimeout())
 	if err != nil {
 		return []byte(""), err
 	}
@@ -101,6 +102,7 @@ func (synchronizer *Synchronizer) save() error {
 	data, err := json.Marshal(map[string]interface{}{
 		"id":        synchronizer.id,
 		"pipelines": synchronizer.pipelines,
+		"labels":    synchronizer.labels,
 	})
 	if err != nil {
 		return err
@@ -114,6 +116,17 @@ func (synchronizer *Synchronizer) save() error {
 	return nil
 }
 
+func (synchronizer *Synchronizer) release() error {
+
+	// Update store
+	store, err := synchronizer.synchronizerManager.controller.store.GetEngine().GetStore("gravity_synchronizer_manager")
+	if err != nil {
+		return nil
+	}
+
+	return store.Delete("synchronizers", []byte(synchronizer.id))
+}
+
 func (synchronizer *Synchronizer) getConnection() *nats.Conn {
 	return synchronizer.synchronizerManager.controller.gravityClient.GetConnection()
 }
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"sync"
@@ -13,11 +14,16 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+var (
+	ErrSynchronizerNotFound = errors.New("synchronizer manager: synchronizer not found")
+)
+
 type SynchronizerManager struct {
 	controller    *Controller
 	synchronizers map[string]*Synchronizer
 	eventstore    *eventstore.EventStore
 	rpcEngine     *broc.Broc
+	jsonEngine    *broc.Broc
 	mutex         sync.RWMutex
 }
 
@@ -39,12 +45,12 @@ func (sm *SynchronizerManager) Initialize() error {
 	// Restore states from store
 	store, err := sm.controller.store.GetEngine().GetStore("gravity_synchronizer_manager")
 	if err != nil {
-		return nil
+		return err
 	}
 
 	err = store.RegisterColumns([]string{"synchronizers"})
 	if err != nil {
-		return nil
+		return err
 	}
 
 	log.Info("Trying to restoring synchronizers...")
@@ -66,6 +72,8 @@ func (sm *SynchronizerManager) Initialize() error {
 			"id": synchronizer.id,
 		}).Info("Restored synchronizer")
 
+		synchronizer.labels = parseLabels(data["labels"])
+
 		// Update pipelines
 		if data["pipelines"] != nil {
 			ps := data["pipelines"].([]interface{})
@@ -125,6 +133,8 @@ func (sm *SynchronizerManager) Register(synchronizerID string) error {
 		return err
 	}
 
+	sm.controller.events.PublishSynchronizer(EventSynchronizerRegistered, synchronizerID)
+
 	// Update keyring
 	keys := sm.controller.keyring.GetKeys()
 	keys.Range(func(k interface{}, v interface{}) bool {
@@ -138,47 +148,110 @@ func (sm *SynchronizerManager) Register(synchronizerID string) error {
 		return true
 	})
 
+	// Revoked keys
+	revocations, err := sm.controller.keyringStore.GetRevocations()
+	if err != nil {
+		log.Error(err)
+		return nil
+	}
+
+	if len(revocations) > 0 {
+		sm.RevokeKeyringBySynchronizer(synchronizerID, revocations)
+	}
+
 	return nil
 }
 
 func (sm *SynchronizerManager) Unregister(synchronizerID string) error {
 
 	sm.mutex.Lock()
-	defer sm.mutex.Unlock()
 
 	synchronizer, ok := sm.synchronizers[synchronizerID]
-	if ok {
+	if !ok {
+		sm.mutex.Unlock()
 		return nil
 	}
 
+	// Take off synchronizer from registry
+	delete(sm.synchronizers, synchronizerID)
+
+	sm.mutex.Unlock()
+
+	err := synchronizer.release()
+	if err != nil {
+		return err
+	}
+
 	// Release pipelines
 	for _, pipelineID := range synchronizer.pipelines {
 
 		// Getting pipeline by ID
 		pipeline := sm.controller.pipelineManager.GetPipeline(pipelineID)
 		if pipeline == nil {
-			return nil
+			continue
 		}
 
 		sm.controller.pipelineManager.releasePipeline(pipeline)
 	}
 
-	// Take off synchronizer from registry
-	delete(sm.synchronizers, synchronizerID)
+	sm.controller.events.PublishSynchronizer(EventSynchronizerExpired, synchronizerID)
 
 	return nil
 }
 
+// SetLabels changes labels of synchronizer and returns the result
+func (sm *SynchronizerManager) SetLabels(synchronizerID string, changes map[string]*string) (map[string]string, error) {
+
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	synchronizer, ok := sm.synchronizers[synchronizerID]
+	if !ok {
+		return nil, ErrSynchronizerNotFound
+	}
+
+	labels, err := PatchLabels(synchronizer.labels, changes)
+	if err != nil {
+		return nil, err
+	}
+
+	synchronizer.labels = labels
+
+	err = synchronizer.save()
+	if err != nil {
+		return nil, err
+	}
+
+	return copyLabels(labels), nil
+}
+
 func (sm *SynchronizerManager) GetCount() int {
+
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
 	return len(sm.synchronizers)
 }
 
+// GetSynchronizers returns a snapshot of registered synchronizers
 func (sm *SynchronizerManager) GetSynchronizers() map[string]*Synchronizer {
-	return sm.synchronizers
+
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	synchronizers := make(map[string]*Synchronizer, len(sm.synchronizers))
+	for id, synchronizer := range sm.synchronizers {
+		synchronizers[id] = synchronizer
+	}
+
+	return synchronizers
 }
 
 func (sm *SynchronizerManager) GetSynchronizer(synchronizerID string) *Synchronizer {
 
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
 	synchronizer, ok := sm.synchronizers[synchronizerID]
 	if !ok {
 		return nil
@@ -201,23 +274,95 @@ func (sm *SynchronizerManager) UpdateKeyring(key *keyring.KeyInfo) error {
 		}
 	}
 
+	sm.controller.events.PublishKeyring(EventKeyringUpdated, key.GetAppID(), key.Permission().GetPermissions())
+
 	return nil
 }
 
 func (sm *SynchronizerManager) UpdateKeyringBySynchronizer(synchronizerID string, key *keyring.KeyInfo) error {
 
 	request := synchronizer_pb.UpdateKeyringRequest{
-		Keys: make([]*synchronizer_pb.Key, 1),
+		Keys: make([]*synchronizer_pb.Key, 0, 2),
 	}
 
-	entry := synchronizer_pb.Key{
+	// Previous key goes first during rotation so current key wins on synchronizers which keep one key per app.
+	// It is withdrawn by pushing current key only once rotation expires or is finalized.
+	prevKey := sm.controller.keyRotation.GetPreviousKey(key.GetAppID())
+	if prevKey != nil {
+		request.Keys = append(request.Keys, &synchronizer_pb.Key{
+			AppID:       key.GetAppID(),
+			Key:         prevKey.Encryption().GetKey(),
+			Permissions: key.Permission().GetPermissions(),
+			Collections: key.Collection().GetCollections(),
+		})
+	}
+
+	request.Keys = append(request.Keys, &synchronizer_pb.Key{
 		AppID:       key.GetAppID(),
 		Key:         key.Encryption().GetKey(),
 		Permissions: key.Permission().GetPermissions(),
 		Collections: key.Collection().GetCollections(),
+	})
+
+	msg, _ := proto.Marshal(&request)
+
+	respData, err := sm.Request(synchronizerID, "updateKeyring", msg)
+	if err != nil {
+		log.Error(err)
+		return err
 	}
 
-	request.Keys[0] = &entry
+	var reply synchronizer_pb.UpdateKeyringReply
+	err = proto.Unmarshal(respData, &reply)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	if !reply.Success {
+		log.Error(reply.Reason)
+		return errors.New(reply.Reason)
+	}
+
+	return nil
+}
+
+func (sm *SynchronizerManager) RevokeKeyring(appID string) error {
+
+	for synchronizerID, _ := range sm.GetSynchronizers() {
+
+		err := sm.RevokeKeyringBySynchronizer(synchronizerID, []string{appID})
+		if err != nil {
+			continue
+		}
+	}
+
+	return nil
+}
+
+// RevokeKeyringBySynchronizer replaces keys of apps on synchronizer with random
+// ones without any permission, so that nobody is able to use them
+func (sm *SynchronizerManager) RevokeKeyringBySynchronizer(synchronizerID string, appIDs []string) error {
+
+	request := synchronizer_pb.UpdateKeyringRequest{
+		Keys: make([]*synchronizer_pb.Key, 0, len(appIDs)),
+	}
+
+	for _, appID := range appIDs {
+
+		key := make([]byte, 32)
+		_, err := rand.Read(key)
+		if err != nil {
+			return err
+		}
+
+		request.Keys = append(request.Keys, &synchronizer_pb.Key{
+			AppID:       appID,
+			Key:         key,
+			Permissions: []string{},
+			Collections: []string{},
+		})
+	}
 
 	msg, _ := proto.Marshal(&request)
 
@@ -239,5 +384,10 @@ func (sm *SynchronizerManager) UpdateKeyringBySynchronizer(synchronizerID string
 		return errors.New(reply.Reason)
 	}
 
+	log.WithFields(log.Fields{
+		"synchronizer": synchronizerID,
+		"count":        len(appIDs),
+	}).Info("Revoked keys on synchronizer")
+
 	return nil
 }
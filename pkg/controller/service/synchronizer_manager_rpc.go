@@ -1,39 +1,79 @@
 package controller
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"github.com/BrobridgeOrg/broc"
 	packet_pb "github.com/BrobridgeOrg/gravity-api/packet"
 	synchronizer_manager_pb "github.com/BrobridgeOrg/gravity-api/service/synchronizer_manager"
-	"github.com/BrobridgeOrg/gravity-controller/pkg/controller/service/middleware"
 	"github.com/golang/protobuf/proto"
 	log "github.com/sirupsen/logrus"
 )
 
+type SynchronizerInfo struct {
+	SynchronizerID string            `json:"synchronizerID"`
+	Pipelines      []uint64          `json:"pipelines"`
+	Labels         map[string]string `json:"labels"`
+}
+
+type ListSynchronizersReply struct {
+	Success       bool                `json:"success"`
+	Reason        string              `json:"reason,omitempty"`
+	Synchronizers []*SynchronizerInfo `json:"synchronizers"`
+}
+
 func (sm *SynchronizerManager) initializeRPC() error {
 
 	log.Info("Initializing RPC Handlers for SynchronizerManager")
 
 	// Initializing authentication middleware
-	m := middleware.NewMiddleware(map[string]interface{}{
-		"Authentication": &middleware.Authentication{
-			Enabled: true,
-			Keyring: sm.controller.keyring,
-		},
-	})
+	m := sm.controller.newMiddleware()
 
 	// Initializing RPC engine to handle requests
 	sm.rpcEngine = broc.NewBroc(sm.controller.gravityClient.GetConnection())
 	sm.rpcEngine.Use(m.PacketHandler)
 	sm.rpcEngine.SetPrefix(fmt.Sprintf("%s.synchronizer_manager.", sm.controller.domain))
 
+	// Methods which are not defined by gravity-api are encoded in JSON, they are
+	// served under a prefix of their own
+	sm.jsonEngine = broc.NewBroc(sm.controller.gravityClient.GetConnection())
+	sm.jsonEngine.Use(m.PacketHandler)
+	sm.jsonEngine.SetPrefix(fmt.Sprintf("%s.synchronizer_manager.json.", sm.controller.domain))
+
 	// Register methods
-	sm.rpcEngine.Register("register", m.RequiredAuth("SYSTEM"), sm.rpc_register)
-	sm.rpcEngine.Register("unregister", m.RequiredAuth("SYSTEM"), sm.rpc_unregister)
-	sm.rpcEngine.Register("getPipelines", m.RequiredAuth("SYSTEM"), sm.rpc_getPipelines)
+	sm.rpcEngine.Register("register",
+		m.RequiredMethod("synchronizer_manager.register"),
+		m.RateLimit("synchronizer_manager.register"),
+		sm.rpc_register,
+	)
+	sm.rpcEngine.Register("unregister",
+		m.RequiredMethod("synchronizer_manager.unregister"),
+		m.RateLimit("synchronizer_manager.unregister"),
+		sm.rpc_unregister,
+	)
+	sm.rpcEngine.Register("getPipelines",
+		m.RequiredMethod("synchronizer_manager.getPipelines"),
+		m.RateLimit("synchronizer_manager.getPipelines"),
+		sm.rpc_getPipelines,
+	)
+	sm.jsonEngine.Register("setSynchronizerLabels",
+		m.RequiredMethod("synchronizer_manager.setSynchronizerLabels"),
+		m.RateLimit("synchronizer_manager.setSynchronizerLabels"),
+		sm.rpc_setSynchronizerLabels,
+	)
+	sm.jsonEngine.Register("listSynchronizers",
+		m.RequiredMethod("synchronizer_manager.listSynchronizers"),
+		m.RateLimit("synchronizer_manager.listSynchronizers"),
+		sm.rpc_listSynchronizers,
+	)
+
+	err := sm.rpcEngine.Apply()
+	if err != nil {
+		return err
+	}
 
-	return sm.rpcEngine.Apply()
+	return sm.jsonEngine.Apply()
 }
 
 func (sm *SynchronizerManager) rpc_register(ctx *broc.Context) (returnedValue interface{}, err error) {
@@ -48,8 +88,14 @@ func (sm *SynchronizerManager) rpc_register(ctx *broc.Context) (returnedValue in
 		err = e
 	}()
 
-	// Parsing request data
 	var req synchronizer_manager_pb.RegisterSynchronizerRequest
+
+	// Audit trail
+	defer func() {
+		sm.controller.audit.RecordContext(ctx, "synchronizer_manager.register", req.SynchronizerID, reply.Success, reply.Reason)
+	}()
+
+	// Parsing request data
 	payload := ctx.Get("payload").(*packet_pb.Payload)
 	err = proto.Unmarshal(payload.Data, &req)
 	if err != nil {
@@ -89,8 +135,14 @@ func (sm *SynchronizerManager) rpc_unregister(ctx *broc.Context) (returnedValue
 		err = e
 	}()
 
-	// Parsing request data
 	var req synchronizer_manager_pb.UnregisterSynchronizerRequest
+
+	// Audit trail
+	defer func() {
+		sm.controller.audit.RecordContext(ctx, "synchronizer_manager.unregister", req.SynchronizerID, reply.Success, reply.Reason)
+	}()
+
+	// Parsing request data
 	payload := ctx.Get("payload").(*packet_pb.Payload)
 	err = proto.Unmarshal(payload.Data, &req)
 	if err != nil {
@@ -153,3 +205,100 @@ func (sm *SynchronizerManager) rpc_getPipelines(ctx *broc.Context) (returnedValu
 
 	return
 }
+
+func (sm *SynchronizerManager) rpc_setSynchronizerLabels(ctx *broc.Context) (returnedValue interface{}, err error) {
+
+	// Reply
+	reply := SetLabelsReply{
+		Success: true,
+	}
+	defer func() {
+		data, e := json.Marshal(&reply)
+		returnedValue = data
+		err = e
+	}()
+
+	var req SetLabelsRequest
+
+	// Audit trail
+	defer func() {
+		sm.controller.audit.RecordContext(ctx, "synchronizer_manager.setSynchronizerLabels", req.ID, reply.Success, reply.Reason)
+	}()
+
+	// Parsing request data
+	payload := ctx.Get("payload").(*packet_pb.Payload)
+	err = json.Unmarshal(payload.Data, &req)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = "UnknownParameter"
+		return
+	}
+
+	labels, err := sm.SetLabels(req.ID, req.Labels)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = err.Error()
+		return
+	}
+
+	reply.Labels = labels
+
+	return
+}
+
+func (sm *SynchronizerManager) rpc_listSynchronizers(ctx *broc.Context) (returnedValue interface{}, err error) {
+
+	// Reply
+	reply := ListSynchronizersReply{
+		Success: true,
+	}
+	defer func() {
+		data, e := json.Marshal(&reply)
+		returnedValue = data
+		err = e
+	}()
+
+	// Parsing request data
+	var req ListRequest
+	payload := ctx.Get("payload").(*packet_pb.Payload)
+	err = json.Unmarshal(payload.Data, &req)
+	if err != nil {
+		log.Error(err)
+
+		reply.Success = false
+		reply.Reason = "UnknownParameter"
+		return
+	}
+
+	selector, err := ParseLabelSelector(req.Selector)
+	if err != nil {
+		reply.Success = false
+		reply.Reason = err.Error()
+		return
+	}
+
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	synchronizers := make([]*SynchronizerInfo, 0, len(sm.synchronizers))
+	for _, synchronizer := range sm.synchronizers {
+
+		if !selector.Matches(synchronizer.labels) {
+			continue
+		}
+
+		synchronizers = append(synchronizers, &SynchronizerInfo{
+			SynchronizerID: synchronizer.id,
+			Pipelines:      append([]uint64{}, synchronizer.pipelines...),
+			Labels:         copyLabels(synchronizer.labels),
+		})
+	}
+
+	reply.Synchronizers = synchronizers
+
+	return
+}